@@ -0,0 +1,320 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Armazenamento guarda os blocos da cadeia principal de forma ordenada.
+// Anexar só retorna depois que os dados estão em disco, e Truncar mantém
+// apenas os blocos [0, altura), usado quando a cadeia é substituída.
+type Armazenamento interface {
+	Carregar() ([]Bloco, error)
+	Anexar(blocos ...Bloco) error
+	Truncar(altura int) error
+	Fechar() error
+}
+
+type ArmazenamentoMemoria struct {
+	mu     sync.Mutex
+	blocos []Bloco
+}
+
+func NovoArmazenamentoMemoria() *ArmazenamentoMemoria {
+	return &ArmazenamentoMemoria{}
+}
+
+func (a *ArmazenamentoMemoria) Carregar() ([]Bloco, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return append([]Bloco(nil), a.blocos...), nil
+}
+
+func (a *ArmazenamentoMemoria) Anexar(blocos ...Bloco) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.blocos = append(a.blocos, blocos...)
+	return nil
+}
+
+func (a *ArmazenamentoMemoria) Truncar(altura int) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if altura < len(a.blocos) {
+		a.blocos = a.blocos[:altura]
+	}
+	return nil
+}
+
+func (a *ArmazenamentoMemoria) Fechar() error {
+	return nil
+}
+
+const (
+	arquivoLogBlocos    = "blocos.log"
+	arquivoIndiceBlocos = "blocos.idx"
+	cabecalhoRegistro   = 8 // tamanho (uint32) + crc32 (uint32)
+	// Um bloco maior não caberia numa mensagem entre peers; um tamanho acima
+	// disso no log só pode ser um cabeçalho corrompido.
+	maxTamanhoRegistro = maxTamanhoMensagem
+)
+
+// ArmazenamentoArquivo mantém um log somente-anexação de blocos e um índice
+// com o deslocamento de cada bloco no log. Cada registro do log é
+// [tamanho][crc32][json do bloco]; um registro incompleto ou corrompido no
+// final do arquivo (escrita interrompida) é descartado na abertura. O índice
+// poupa a abertura de percorrer o log inteiro: só os registros depois do
+// último indexado são lidos.
+type ArmazenamentoArquivo struct {
+	mu      sync.Mutex
+	log     *os.File
+	indice  *os.File
+	offsets []int64
+	tamanho int64
+}
+
+func AbrirArmazenamentoArquivo(diretorio string) (*ArmazenamentoArquivo, error) {
+	if err := os.MkdirAll(diretorio, 0o755); err != nil {
+		return nil, fmt.Errorf("criando diretório de dados: %w", err)
+	}
+	logArq, err := os.OpenFile(filepath.Join(diretorio, arquivoLogBlocos), os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("abrindo log de blocos: %w", err)
+	}
+	indiceArq, err := os.OpenFile(filepath.Join(diretorio, arquivoIndiceBlocos), os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		logArq.Close()
+		return nil, fmt.Errorf("abrindo índice de blocos: %w", err)
+	}
+	a := &ArmazenamentoArquivo{log: logArq, indice: indiceArq}
+	if err := a.recuperar(); err != nil {
+		a.Fechar()
+		return nil, err
+	}
+	return a, nil
+}
+
+// recuperar parte dos registros do índice, percorre o log depois deles
+// validando cada registro, corta o que sobrar depois do último registro
+// íntegro e reescreve o índice.
+func (a *ArmazenamentoArquivo) recuperar() error {
+	info, err := a.log.Stat()
+	if err != nil {
+		return err
+	}
+	var offset int64
+	a.offsets, offset = a.lerIndice(info.Size())
+	leitor := bufio.NewReader(io.NewSectionReader(a.log, offset, info.Size()-offset))
+	for {
+		_, n, err := lerRegistro(leitor)
+		if err != nil {
+			break
+		}
+		a.offsets = append(a.offsets, offset)
+		offset += n
+	}
+	if info.Size() != offset {
+		if err := a.log.Truncate(offset); err != nil {
+			return fmt.Errorf("descartando registro incompleto: %w", err)
+		}
+		if err := a.log.Sync(); err != nil {
+			return err
+		}
+	}
+	a.tamanho = offset
+	return a.reescreverIndice()
+}
+
+// lerIndice devolve os deslocamentos gravados no índice e onde termina no log
+// o último registro indexado. Um índice que não confere com o log (gravação
+// do índice que falhou, arquivo corrompido) é ignorado, e o log é percorrido
+// desde o início.
+func (a *ArmazenamentoArquivo) lerIndice(tamanhoLog int64) ([]int64, int64) {
+	info, err := a.indice.Stat()
+	if err != nil {
+		return nil, 0
+	}
+	dados := make([]byte, info.Size()/8*8)
+	if _, err := a.indice.ReadAt(dados, 0); err != nil {
+		return nil, 0
+	}
+	offsets := make([]int64, 0, len(dados)/8)
+	for i := 0; i < len(dados); i += 8 {
+		off := int64(binary.BigEndian.Uint64(dados[i:]))
+		anterior := int64(-cabecalhoRegistro)
+		if len(offsets) > 0 {
+			anterior = offsets[len(offsets)-1]
+		}
+		if off < anterior+cabecalhoRegistro || off >= tamanhoLog || (len(offsets) == 0 && off != 0) {
+			return nil, 0
+		}
+		offsets = append(offsets, off)
+	}
+	if len(offsets) == 0 {
+		return nil, 0
+	}
+	ultimo := offsets[len(offsets)-1]
+	_, n, err := lerRegistro(io.NewSectionReader(a.log, ultimo, tamanhoLog-ultimo))
+	if err != nil {
+		return nil, 0
+	}
+	return offsets, ultimo + n
+}
+
+func lerRegistro(leitor io.Reader) (Bloco, int64, error) {
+	var cabecalho [cabecalhoRegistro]byte
+	if _, err := io.ReadFull(leitor, cabecalho[:]); err != nil {
+		if err == io.EOF {
+			return Bloco{}, 0, io.EOF
+		}
+		return Bloco{}, 0, errors.New("cabeçalho de registro incompleto")
+	}
+	tamanho := binary.BigEndian.Uint32(cabecalho[0:4])
+	soma := binary.BigEndian.Uint32(cabecalho[4:8])
+	if tamanho > maxTamanhoRegistro {
+		return Bloco{}, 0, fmt.Errorf("registro de %d bytes excede o limite", tamanho)
+	}
+	dados := make([]byte, tamanho)
+	if _, err := io.ReadFull(leitor, dados); err != nil {
+		return Bloco{}, 0, errors.New("registro incompleto")
+	}
+	if crc32.ChecksumIEEE(dados) != soma {
+		return Bloco{}, 0, errors.New("checksum do registro não confere")
+	}
+	var bloco Bloco
+	if err := json.Unmarshal(dados, &bloco); err != nil {
+		return Bloco{}, 0, err
+	}
+	return bloco, int64(cabecalhoRegistro) + int64(tamanho), nil
+}
+
+func codificarRegistro(bloco Bloco) ([]byte, error) {
+	dados, err := json.Marshal(bloco)
+	if err != nil {
+		return nil, err
+	}
+	if len(dados) > maxTamanhoRegistro {
+		return nil, fmt.Errorf("bloco de %d bytes excede o limite do registro", len(dados))
+	}
+	registro := make([]byte, cabecalhoRegistro+len(dados))
+	binary.BigEndian.PutUint32(registro[0:4], uint32(len(dados)))
+	binary.BigEndian.PutUint32(registro[4:8], crc32.ChecksumIEEE(dados))
+	copy(registro[cabecalhoRegistro:], dados)
+	return registro, nil
+}
+
+func (a *ArmazenamentoArquivo) reescreverIndice() error {
+	buf := make([]byte, 8*len(a.offsets))
+	for i, off := range a.offsets {
+		binary.BigEndian.PutUint64(buf[i*8:], uint64(off))
+	}
+	if err := a.indice.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := a.indice.WriteAt(buf, 0); err != nil {
+		return err
+	}
+	return a.indice.Sync()
+}
+
+func (a *ArmazenamentoArquivo) Carregar() ([]Bloco, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	leitor := bufio.NewReader(io.NewSectionReader(a.log, 0, a.tamanho))
+	blocos := make([]Bloco, 0, len(a.offsets))
+	var offset int64
+	for _, esperado := range a.offsets {
+		if offset != esperado {
+			return nil, fmt.Errorf("bloco %d no deslocamento %d, o índice diz %d", len(blocos), offset, esperado)
+		}
+		bloco, n, err := lerRegistro(leitor)
+		if err != nil {
+			return nil, fmt.Errorf("lendo bloco %d: %w", len(blocos), err)
+		}
+		blocos = append(blocos, bloco)
+		offset += n
+	}
+	return blocos, nil
+}
+
+func (a *ArmazenamentoArquivo) Anexar(blocos ...Bloco) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	var dados []byte
+	novosOffsets := make([]int64, 0, len(blocos))
+	offset := a.tamanho
+	for _, bloco := range blocos {
+		registro, err := codificarRegistro(bloco)
+		if err != nil {
+			return err
+		}
+		novosOffsets = append(novosOffsets, offset)
+		offset += int64(len(registro))
+		dados = append(dados, registro...)
+	}
+	if _, err := a.log.WriteAt(dados, a.tamanho); err != nil {
+		return fmt.Errorf("gravando blocos: %w", err)
+	}
+	if err := a.log.Sync(); err != nil {
+		return fmt.Errorf("sincronizando log de blocos: %w", err)
+	}
+	// O log já é a fonte da verdade e os blocos estão gravados; se o índice
+	// falhar aqui, a abertura seguinte não confia nele e relê o log.
+	buf := make([]byte, 8*len(novosOffsets))
+	for i, off := range novosOffsets {
+		binary.BigEndian.PutUint64(buf[i*8:], uint64(off))
+	}
+	posicao := int64(8 * len(a.offsets))
+	a.offsets = append(a.offsets, novosOffsets...)
+	a.tamanho = offset
+	if _, err := a.indice.WriteAt(buf, posicao); err != nil {
+		log.Printf("Erro ao gravar o índice de blocos: %v", err)
+	} else if err := a.indice.Sync(); err != nil {
+		log.Printf("Erro ao sincronizar o índice de blocos: %v", err)
+	}
+	return nil
+}
+
+func (a *ArmazenamentoArquivo) Truncar(altura int) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if altura >= len(a.offsets) {
+		return nil
+	}
+	offset := a.offsets[altura]
+	if err := a.log.Truncate(offset); err != nil {
+		return fmt.Errorf("truncando log de blocos: %w", err)
+	}
+	if err := a.log.Sync(); err != nil {
+		return err
+	}
+	if err := a.indice.Truncate(int64(8 * altura)); err != nil {
+		return fmt.Errorf("truncando índice: %w", err)
+	}
+	if err := a.indice.Sync(); err != nil {
+		return err
+	}
+	a.offsets = a.offsets[:altura]
+	a.tamanho = offset
+	return nil
+}
+
+func (a *ArmazenamentoArquivo) Fechar() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	errLog := a.log.Close()
+	errIndice := a.indice.Close()
+	if errLog != nil {
+		return errLog
+	}
+	return errIndice
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func abrirBlockchainEm(t *testing.T, diretorio string) (*Blockchain, *ArmazenamentoArquivo) {
+	t.Helper()
+	armazenamento, err := AbrirArmazenamentoArquivo(diretorio)
+	if err != nil {
+		t.Fatalf("Erro ao abrir armazenamento: %v", err)
+	}
+	bc, err := CarregarBlockchain(nil, armazenamento, GenesisPadrao)
+	if err != nil {
+		t.Fatalf("Erro ao carregar blockchain: %v", err)
+	}
+	return bc, armazenamento
+}
+
+// Testa que a cadeia é recuperada inteira depois de reabrir o diretório
+func TestArmazenamentoReabrir(t *testing.T) {
+	diretorio := t.TempDir()
+	bc, armazenamento := abrirBlockchainEm(t, diretorio)
+	bc.AdicionarRegistro("Evento1")
+	bc.AdicionarRegistro("Evento2")
+	armazenamento.Fechar()
+
+	recuperada, armazenamento := abrirBlockchainEm(t, diretorio)
+	defer armazenamento.Fechar()
+	if len(recuperada.Blocos) != 3 {
+		t.Fatalf("Esperado 3 blocos, obtido %d", len(recuperada.Blocos))
+	}
+	for i := range bc.Blocos {
+		if recuperada.Blocos[i].HashAtual != bc.Blocos[i].HashAtual {
+			t.Errorf("Bloco %d difere após reabrir", i)
+		}
+	}
+}
+
+// Testa a recuperação quando o processo morre no meio da escrita de um bloco
+func TestArmazenamentoEscritaInterrompida(t *testing.T) {
+	diretorio := t.TempDir()
+	bc, armazenamento := abrirBlockchainEm(t, diretorio)
+	bc.AdicionarRegistro("Evento1")
+	bc.AdicionarRegistro("Evento2")
+	bc.AdicionarRegistro("Evento3")
+	armazenamento.Fechar()
+
+	// Corta o log no meio do último bloco
+	caminho := filepath.Join(diretorio, arquivoLogBlocos)
+	info, err := os.Stat(caminho)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Truncate(caminho, info.Size()-20); err != nil {
+		t.Fatal(err)
+	}
+
+	recuperada, armazenamento := abrirBlockchainEm(t, diretorio)
+	if len(recuperada.Blocos) != 3 {
+		t.Fatalf("Esperado 3 blocos após recuperação, obtido %d", len(recuperada.Blocos))
+	}
+	if !recuperada.ValidarBlockchain() {
+		t.Fatal("Blockchain recuperada deveria ser válida")
+	}
+
+	// A cadeia recuperada continua aceitando blocos e eles sobrevivem a outro reinício
+	recuperada.AdicionarRegistro("Evento4")
+	armazenamento.Fechar()
+	final, armazenamento := abrirBlockchainEm(t, diretorio)
+	defer armazenamento.Fechar()
+	if len(final.Blocos) != 4 {
+		t.Fatalf("Esperado 4 blocos, obtido %d", len(final.Blocos))
+	}
+	if !final.ValidarBlockchain() {
+		t.Error("Blockchain deveria ser válida após novo bloco")
+	}
+}
+
+// Testa que um cabeçalho de registro com tamanho absurdo no final do log é tratado como escrita interrompida
+func TestArmazenamentoTamanhoCorrompido(t *testing.T) {
+	diretorio := t.TempDir()
+	bc, armazenamento := abrirBlockchainEm(t, diretorio)
+	bc.AdicionarRegistro("Evento1")
+	armazenamento.Fechar()
+
+	caminho := filepath.Join(diretorio, arquivoLogBlocos)
+	arquivo, err := os.OpenFile(caminho, os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cabecalho [cabecalhoRegistro]byte
+	binary.BigEndian.PutUint32(cabecalho[0:4], 0xFFFFFFFF)
+	arquivo.Write(cabecalho[:])
+	arquivo.Close()
+
+	recuperada, armazenamento := abrirBlockchainEm(t, diretorio)
+	defer armazenamento.Fechar()
+	if len(recuperada.Blocos) != 2 {
+		t.Fatalf("Esperado 2 blocos após recuperação, obtido %d", len(recuperada.Blocos))
+	}
+	if info, err := os.Stat(caminho); err != nil || info.Size() != armazenamento.tamanho {
+		t.Errorf("O cabeçalho corrompido deveria ser cortado do log")
+	}
+}
+
+// Testa que a abertura completa um índice atrasado e ignora um índice que não confere com o log
+func TestArmazenamentoIndice(t *testing.T) {
+	diretorio := t.TempDir()
+	bc, armazenamento := abrirBlockchainEm(t, diretorio)
+	bc.AdicionarRegistro("Evento1")
+	bc.AdicionarRegistro("Evento2")
+	offsets := append([]int64(nil), armazenamento.offsets...)
+	armazenamento.Fechar()
+	caminho := filepath.Join(diretorio, arquivoIndiceBlocos)
+
+	// Índice sem os dois últimos blocos, como se a gravação dele tivesse falhado
+	if err := os.Truncate(caminho, 8); err != nil {
+		t.Fatal(err)
+	}
+	recuperada, armazenamento := abrirBlockchainEm(t, diretorio)
+	if len(recuperada.Blocos) != 3 || !reflect.DeepEqual(armazenamento.offsets, offsets) {
+		t.Fatalf("Índice atrasado deveria ser completado pelo log, obtido %d blocos e %v", len(recuperada.Blocos), armazenamento.offsets)
+	}
+	armazenamento.Fechar()
+	if info, err := os.Stat(caminho); err != nil || info.Size() != 8*3 {
+		t.Errorf("O índice deveria ser regravado com os 3 blocos")
+	}
+
+	// Índice com deslocamentos que não apontam para registros do log
+	if err := os.WriteFile(caminho, bytes.Repeat([]byte{0xFF}, 8*3), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	recuperada, armazenamento = abrirBlockchainEm(t, diretorio)
+	defer armazenamento.Fechar()
+	if len(recuperada.Blocos) != 3 || !reflect.DeepEqual(armazenamento.offsets, offsets) {
+		t.Fatalf("Índice corrompido deveria ser refeito a partir do log, obtido %d blocos e %v", len(recuperada.Blocos), armazenamento.offsets)
+	}
+}
+
+// Testa que blocos gravados no log continuam na cadeia mesmo quando a gravação do índice falha
+func TestArmazenamentoIndiceComFalha(t *testing.T) {
+	diretorio := t.TempDir()
+	bc, armazenamento := abrirBlockchainEm(t, diretorio)
+	armazenamento.indice.Close()
+	bc.AdicionarRegistro("Evento1")
+	bc.AdicionarRegistro("Evento2")
+	if len(bc.Blocos) != 3 {
+		t.Fatalf("Falha no índice não deveria recusar blocos, obtido %d", len(bc.Blocos))
+	}
+	armazenamento.Fechar()
+
+	recuperada, armazenamento := abrirBlockchainEm(t, diretorio)
+	defer armazenamento.Fechar()
+	if len(recuperada.Blocos) != 3 || recuperada.ponta.bloco.HashAtual != bc.ponta.bloco.HashAtual {
+		t.Fatalf("Esperado 3 blocos após reabrir, obtido %d", len(recuperada.Blocos))
+	}
+}
@@ -1,16 +1,79 @@
 package main
 
 import (
+	"errors"
+	"log"
+	"strconv"
 	"sync"
 	"testing"
 )
 
+// genesisTeste é o gênesis padrão com a dificuldade fixa, para os testes que
+// mineram dezenas de blocos em poucos segundos: com o ajuste ligado ela
+// subiria até o máximo e a mineração ficaria lenta.
+func genesisTeste() EspecificacaoGenesis {
+	especificacao := GenesisPadrao
+	especificacao.DificuldadeMaxima = especificacao.Dificuldade
+	return especificacao
+}
+
+func novoBlockchainTeste(t *testing.T) *Blockchain {
+	t.Helper()
+	bc, err := CarregarBlockchain(nil, NovoArmazenamentoMemoria(), genesisTeste())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bc
+}
+
+// AdicionarBloco minera imediatamente um bloco com uma única transação,
+// assinada por uma carteira descartável criada só para ela.
+func (bc *Blockchain) AdicionarBloco(evento string, resultado interface{}) Bloco {
+	tx, err := NovaTransacao(evento, resultado)
+	if err != nil {
+		return Bloco{}
+	}
+	carteira, err := NovaCarteira()
+	if err != nil {
+		return Bloco{}
+	}
+	tx.ChainID = bc.genesis.ChainID
+	carteira.Assinar(&tx, 0)
+	return bc.AdicionarTransacao(tx)
+}
+
+// AdicionarRegistro minera um bloco que só faz a cadeia andar: uma delegação
+// entre carteiras descartáveis, válida em qualquer estado, na categoria
+// rotulo.
+func (bc *Blockchain) AdicionarRegistro(rotulo string) Bloco {
+	delegado, err := NovaCarteira()
+	if err != nil {
+		return Bloco{}
+	}
+	return bc.AdicionarBloco("delegar", Delegacao{Para: delegado.Endereco, Categoria: rotulo})
+}
+
+// AdicionarTransacao minera imediatamente um bloco com a transação já
+// assinada, sem passar pelo mempool. Só os testes mineram assim; o nó
+// junta as transações no mempool.
+func (bc *Blockchain) AdicionarTransacao(tx Transacao) Bloco {
+	novoBloco, err := bc.minerarBloco([]Transacao{tx})
+	for errors.Is(err, errPontaMudou) {
+		novoBloco, err = bc.minerarBloco([]Transacao{tx})
+	}
+	if err != nil {
+		log.Printf("Erro ao gravar bloco: %v", err)
+		return Bloco{}
+	}
+	return novoBloco
+}
+
 // Testa a adição de blocos sequencialmente
 func TestAdicionarBlocosSequencial(t *testing.T) {
-	bc := NovoBlockchain()
+	bc := NovoBlockchain(nil)
 
-	bc.AdicionarBloco("Evento1", "Resultado1")
-	bc.AdicionarBloco("Evento2", "Resultado2")
+	bc.AdicionarRegistro("Evento1")
+	bc.AdicionarRegistro("Evento2")
 
 	if len(bc.Blocos) != 3 { // Genesis + 2 blocos
 		t.Errorf("Esperado 3 blocos, obtido %d", len(bc.Blocos))
@@ -23,7 +86,7 @@ func TestAdicionarBlocosSequencial(t *testing.T) {
 
 // Testa a adição de blocos concorrente
 func TestAdicionarBlocosConcorrente(t *testing.T) {
-	bc := NovoBlockchain()
+	bc := novoBlockchainTeste(t)
 	var wg sync.WaitGroup
 	numBlocos := 100
 	wg.Add(numBlocos)
@@ -31,9 +94,7 @@ func TestAdicionarBlocosConcorrente(t *testing.T) {
 	for i := 0; i < numBlocos; i++ {
 		go func(i int) {
 			defer wg.Done()
-			evento := "EventoConcorrente"
-			resultado := "Resultado" + string(i)
-			bc.AdicionarBloco(evento, resultado)
+			bc.AdicionarRegistro("EventoConcorrente" + strconv.Itoa(i))
 		}(i)
 	}
 
@@ -51,9 +112,21 @@ func TestAdicionarBlocosConcorrente(t *testing.T) {
 
 // Testa a integridade após adições concorrentes e apostas
 func TestIntegridadeComApostasConcorrentes(t *testing.T) {
-	bc := NovoBlockchain()
-	var wg sync.WaitGroup
 	numOperations := 100
+	// Cada apostador começa com saldo no gênesis para cobrir a aposta
+	carteiras := make([]*Carteira, numOperations)
+	especificacao := genesisTeste()
+	especificacao.Saldos = make(map[string]Quantia)
+	for i := range carteiras {
+		carteiras[i], _ = NovaCarteira()
+		especificacao.Saldos[carteiras[i].Endereco] = Reais(int64(i + 1))
+	}
+	bc, err := CarregarBlockchain(nil, NovoArmazenamentoMemoria(), especificacao)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bc.AdicionarBloco("criar_evento", Evento{Nome: "Evento", Opcoes: []string{"Escolha0", "Escolha1"}})
+	var wg sync.WaitGroup
 
 	wg.Add(2 * numOperations)
 
@@ -61,28 +134,45 @@ func TestIntegridadeComApostasConcorrentes(t *testing.T) {
 	for i := 0; i < numOperations; i++ {
 		go func(i int) {
 			defer wg.Done()
-			AdicionarAposta("usuario"+string(i), float64(i), "Escolha"+string(i), i)
+			carteira := carteiras[i]
+			tx, err := NovaTransacao("apostar", Aposta{
+				Usuario:  carteira.Endereco,
+				Valor:    Reais(int64(i + 1)),
+				EventoID: 1,
+				Opcao:    "Escolha" + strconv.Itoa(i%2),
+			})
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			tx.ChainID = bc.genesis.ChainID
+			carteira.Assinar(&tx, 0)
+			bc.AdicionarTransacao(tx)
 		}(i)
 
 		go func(i int) {
 			defer wg.Done()
-			evento := "Evento" + string(i)
-			resultado := "Resultado" + string(i)
-			bc.AdicionarBloco(evento, resultado)
+			bc.AdicionarRegistro("Evento" + strconv.Itoa(i))
 		}(i)
 	}
 
 	wg.Wait()
 
 	// Verifica o número de apostas
-	apostasMutex.Lock()
-	if len(apostas) != numOperations {
-		t.Errorf("Esperado %d apostas, obtido %d", numOperations, len(apostas))
+	numApostas := 0
+	for _, bloco := range bc.Blocos {
+		for _, tx := range transacoesDoBloco(bloco) {
+			if tx.Tipo == "apostar" {
+				numApostas++
+			}
+		}
+	}
+	if numApostas != numOperations {
+		t.Errorf("Esperado %d apostas, obtido %d", numOperations, numApostas)
 	}
-	apostasMutex.Unlock()
 
 	// Verifica o número de blocos
-	expectedBlocos := 1 + numOperations // Genesis + blocos adicionados
+	expectedBlocos := 2 + 2*numOperations // Genesis + criação do evento + apostas + blocos adicionados
 	if len(bc.Blocos) != expectedBlocos {
 		t.Errorf("Esperado %d blocos, obtido %d", expectedBlocos, len(bc.Blocos))
 	}
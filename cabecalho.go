@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"time"
+)
+
+// Versões do cabeçalho de bloco. A versão 1 é o formato antigo, que
+// concatenava os campos como texto e não incluía o hash do bloco anterior;
+// blocos v1 já gravados continuam verificáveis, mas todo bloco novo é v2 e
+// nenhum bloco v1 pode vir depois de um v2.
+const (
+	versaoCabecalhoLegado = 1
+	versaoCabecalhoAtual  = 2
+)
+
+// tamanhoHash é o tamanho, em bytes, de um hash SHA-256.
+const tamanhoHash = sha256.Size
+
+// versaoDe trata blocos gravados antes do campo versao existir como v1.
+func versaoDe(bloco Bloco) int {
+	if bloco.Versao == 0 {
+		return versaoCabecalhoLegado
+	}
+	return bloco.Versao
+}
+
+func calculaHash(bloco Bloco) string {
+	switch versaoDe(bloco) {
+	case versaoCabecalhoLegado:
+		return calculaHashLegado(bloco)
+	case versaoCabecalhoAtual:
+		cabecalho, err := codificarCabecalho(bloco)
+		if err != nil {
+			return ""
+		}
+		hash := sha256.Sum256(cabecalho)
+		return hex.EncodeToString(hash[:])
+	}
+	return ""
+}
+
+func calculaHashLegado(bloco Bloco) string {
+	dados := fmt.Sprintf("%d%s%s%s%d%d", bloco.Indice, bloco.Timestamp, bloco.Evento, bloco.Resultado, bloco.Nonce, bloco.Dificuldade)
+	if bloco.RaizMerkle != "" {
+		dados += bloco.RaizMerkle
+	}
+	hash := sha256.Sum256([]byte(dados))
+	return hex.EncodeToString(hash[:])
+}
+
+// codificarCabecalho monta o cabeçalho binário v2, com inteiros big-endian:
+//
+//	versao        uint32
+//	chain_id      uint16 (tamanho) + bytes
+//	hash_anterior 32 bytes (zeros no gênesis)
+//	hash_conteudo 32 bytes (ver hashConteudo)
+//	timestamp     int64, segundos Unix
+//	dificuldade   uint32
+//	nonce         uint64
+//
+// Cada bloco tem uma única codificação: o timestamp precisa estar em RFC 3339
+// UTC e os hashes em hexadecimal minúsculo.
+func codificarCabecalho(bloco Bloco) ([]byte, error) {
+	if len(bloco.ChainID) > 0xffff {
+		return nil, fmt.Errorf("chain_id longo demais")
+	}
+	anterior := make([]byte, tamanhoHash)
+	if bloco.HashAnterior != "" {
+		var err error
+		anterior, err = decodificarHash(bloco.HashAnterior)
+		if err != nil {
+			return nil, fmt.Errorf("hash_anterior: %w", err)
+		}
+	}
+	instante, err := time.Parse(time.RFC3339, bloco.Timestamp)
+	if err != nil || instante.UTC().Format(time.RFC3339) != bloco.Timestamp {
+		return nil, fmt.Errorf("timestamp %q não está em RFC 3339 UTC", bloco.Timestamp)
+	}
+	if bloco.Dificuldade < 0 || bloco.Nonce < 0 {
+		return nil, fmt.Errorf("dificuldade e nonce não podem ser negativos")
+	}
+	conteudo := hashConteudo(bloco)
+
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.BigEndian, uint32(versaoCabecalhoAtual))
+	binary.Write(&buf, binary.BigEndian, uint16(len(bloco.ChainID)))
+	buf.WriteString(bloco.ChainID)
+	buf.Write(anterior)
+	buf.Write(conteudo[:])
+	binary.Write(&buf, binary.BigEndian, instante.Unix())
+	binary.Write(&buf, binary.BigEndian, uint32(bloco.Dificuldade))
+	binary.Write(&buf, binary.BigEndian, uint64(bloco.Nonce))
+	return buf.Bytes(), nil
+}
+
+// hashConteudo resume o que o bloco carrega: Evento, Resultado e a raiz de
+// Merkle das transações, cada um precedido do tamanho (uint32).
+func hashConteudo(bloco Bloco) [tamanhoHash]byte {
+	var buf bytes.Buffer
+	for _, campo := range []string{bloco.Evento, bloco.Resultado, bloco.RaizMerkle} {
+		binary.Write(&buf, binary.BigEndian, uint32(len(campo)))
+		buf.WriteString(campo)
+	}
+	return sha256.Sum256(buf.Bytes())
+}
+
+func decodificarHash(texto string) ([]byte, error) {
+	hash, err := hex.DecodeString(texto)
+	if err != nil || len(hash) != tamanhoHash || hex.EncodeToString(hash) != texto {
+		return nil, fmt.Errorf("%q não é um hash SHA-256 em hexadecimal minúsculo", texto)
+	}
+	return hash, nil
+}
+
+// validarVersao confere a versão e o chain ID do bloco em relação ao pai.
+func (bc *Blockchain) validarVersao(bloco, pai Bloco) error {
+	versao := versaoDe(bloco)
+	if versao != versaoCabecalhoLegado && versao != versaoCabecalhoAtual {
+		return rejeitar(MotivoVersao, "versão de cabeçalho %d desconhecida", versao)
+	}
+	if versao < versaoDe(pai) {
+		return rejeitar(MotivoVersao, "bloco v%d depois de um bloco v%d", versao, versaoDe(pai))
+	}
+	if versao == versaoCabecalhoLegado {
+		if bloco.ChainID != "" {
+			return rejeitar(MotivoVersao, "bloco v1 não tem chain_id")
+		}
+		return nil
+	}
+	if bloco.ChainID != bc.genesis.ChainID {
+		return rejeitar(MotivoChainID, "chain_id %q, esperado %q", bloco.ChainID, bc.genesis.ChainID)
+	}
+	return nil
+}
+
+// timestampCanonico devolve o instante atual em RFC 3339 UTC, sem ficar antes
+// do timestamp do pai.
+func timestampCanonico(pai Bloco) string {
+	agora := time.Now().UTC()
+	if instantePai, err := time.Parse(time.RFC3339, pai.Timestamp); err == nil && agora.Before(instantePai) {
+		// Relógio local atrasado em relação ao do peer que minerou o pai
+		agora = instantePai.UTC()
+	}
+	return agora.Format(time.RFC3339)
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+// Testa a codificação canônica do cabeçalho v2 e o hash legado v1 contra valores fixos
+func TestVetoresCabecalho(t *testing.T) {
+	v2 := Bloco{
+		Versao:       versaoCabecalhoAtual,
+		ChainID:      "pbl3-apostas",
+		Indice:       1,
+		Timestamp:    "2024-01-01T00:00:10Z",
+		Evento:       "transacoes",
+		HashAnterior: "00ab" + strings.Repeat("0", 60),
+		Nonce:        42,
+		Dificuldade:  3,
+		RaizMerkle:   "ff",
+	}
+	cabecalho, err := codificarCabecalho(v2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	esperado := "00000002" + "000c" + hex.EncodeToString([]byte("pbl3-apostas")) +
+		"00ab" + strings.Repeat("0", 60) +
+		"2dfb0bc0c6c0f533987b90eceeb64af89b3c4de27bbf26670eb886617b6271b5" +
+		"000000006592008a" + "00000003" + "000000000000002a"
+	if hex.EncodeToString(cabecalho) != esperado {
+		t.Errorf("Cabeçalho v2 codificado como %x", cabecalho)
+	}
+	if hash := calculaHash(v2); hash != "e0f8a2dc1b091ea32230240a95f0be82b6e316a3f56e6901f795ee360b4f53e7" {
+		t.Errorf("Hash v2 inesperado: %s", hash)
+	}
+
+	v1 := Bloco{Indice: 1, Timestamp: "2024-01-01T00:00:10Z", Evento: "apostar", Resultado: "{}", Nonce: 42, Dificuldade: 3}
+	if hash := calculaHash(v1); hash != "340199351b30a1dd68833b2b32d247b043f50fba5a1617b4aafaf8d8ccb51915" {
+		t.Errorf("Hash v1 inesperado: %s", hash)
+	}
+}
+
+// Testa que o hash v2 depende do pai e que formas alternativas do mesmo cabeçalho são recusadas
+func TestCabecalhoV2CobreHashAnterior(t *testing.T) {
+	bc := NovoBlockchain(nil)
+	bc.AdicionarRegistro("registro")
+	bloco := bc.AdicionarRegistro("registro")
+	if bloco.Versao != versaoCabecalhoAtual || bloco.ChainID != GenesisPadrao.ChainID {
+		t.Fatalf("Blocos novos deveriam ser v%d da rede %s, obtido v%d %q", versaoCabecalhoAtual, GenesisPadrao.ChainID, bloco.Versao, bloco.ChainID)
+	}
+
+	reparentado := bloco
+	reparentado.HashAnterior = bc.Blocos[0].HashAtual
+	if calculaHash(reparentado) == bloco.HashAtual {
+		t.Error("Trocar o pai deveria mudar o hash do bloco")
+	}
+
+	outroFuso := bloco
+	outroFuso.Timestamp = strings.Replace(bloco.Timestamp, "Z", "+00:00", 1)
+	if calculaHash(outroFuso) != "" {
+		t.Error("Timestamp fora do formato canônico deveria ser recusado")
+	}
+	maiusculo := bloco
+	maiusculo.HashAnterior = strings.ToUpper(bloco.HashAnterior)
+	if calculaHash(maiusculo) != "" {
+		t.Error("Hash anterior fora do formato canônico deveria ser recusado")
+	}
+}
+
+// Testa que um bloco legado v1 não é aceito depois de um bloco v2
+func TestBlocoLegadoDepoisDeV2Rejeitado(t *testing.T) {
+	bc := NovoBlockchain(nil)
+	bc.AdicionarRegistro("registro")
+
+	bc.mu.Lock()
+	pai := bc.ponta.bloco
+	dificuldade, _ := bc.dificuldadeEsperada(bc.ponta)
+	legado := Bloco{
+		Indice:       pai.Indice + 1,
+		Timestamp:    pai.Timestamp,
+		Evento:       "registro",
+		Resultado:    "2",
+		HashAnterior: pai.HashAtual,
+		Dificuldade:  dificuldade,
+	}
+	legado.Nonce, legado.HashAtual = provaDeTrabalho(legado, legado.Dificuldade)
+	_, err := bc.guardarBloco(legado)
+	bc.mu.Unlock()
+	if motivoDe(err) != MotivoVersao {
+		t.Errorf("Esperado motivo %q, obtido %v", MotivoVersao, err)
+	}
+}
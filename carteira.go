@@ -0,0 +1,214 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// Carteira guarda o par de chaves de uma conta. O endereço da conta é
+// derivado da chave pública e é ele que identifica o usuário no livro de
+// saldos.
+type Carteira struct {
+	privada  ed25519.PrivateKey
+	Publica  ed25519.PublicKey
+	Endereco string
+}
+
+func EnderecoDe(publica ed25519.PublicKey) string {
+	hash := sha256.Sum256(publica)
+	return hex.EncodeToString(hash[:20])
+}
+
+func NovaCarteira() (*Carteira, error) {
+	publica, privada, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return &Carteira{privada: privada, Publica: publica, Endereco: EnderecoDe(publica)}, nil
+}
+
+// CarregarCarteira lê a semente da chave privada gravada em caminho, ou gera
+// e grava uma nova se o arquivo não existir.
+func CarregarCarteira(caminho string) (*Carteira, error) {
+	dados, err := os.ReadFile(caminho)
+	if errors.Is(err, os.ErrNotExist) {
+		carteira, err := NovaCarteira()
+		if err != nil {
+			return nil, err
+		}
+		if err := os.MkdirAll(filepath.Dir(caminho), 0o755); err != nil {
+			return nil, err
+		}
+		semente := hex.EncodeToString(carteira.privada.Seed())
+		if err := os.WriteFile(caminho, []byte(semente), 0o600); err != nil {
+			return nil, fmt.Errorf("gravando carteira do nó: %w", err)
+		}
+		return carteira, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("lendo carteira do nó: %w", err)
+	}
+	semente, err := hex.DecodeString(string(dados))
+	if err != nil || len(semente) != ed25519.SeedSize {
+		return nil, fmt.Errorf("carteira do nó em %s está corrompida", caminho)
+	}
+	privada := ed25519.NewKeyFromSeed(semente)
+	publica := privada.Public().(ed25519.PublicKey)
+	return &Carteira{privada: privada, Publica: publica, Endereco: EnderecoDe(publica)}, nil
+}
+
+// Assinar preenche a chave pública, o nonce e a assinatura da transação. A
+// assinatura cobre o ID, que por sua vez cobre todos os outros campos,
+// inclusive o ChainID, que deve ser preenchido antes.
+func (c *Carteira) Assinar(tx *Transacao, nonce uint64) {
+	tx.ChavePublica = hex.EncodeToString(c.Publica)
+	tx.Nonce = nonce
+	tx.ID = calculaIDTransacao(*tx)
+	tx.Assinatura = hex.EncodeToString(ed25519.Sign(c.privada, []byte(tx.ID)))
+}
+
+// mensagemDesafio é o que um nó assina para provar que tem a chave. O prefixo
+// impede que um peer use o desafio para obter a assinatura de uma transação.
+func mensagemDesafio(desafio string) []byte {
+	return []byte(protocoloP2P + " desafio " + desafio)
+}
+
+// AssinarDesafio assina o desafio recebido de um peer no handshake.
+func (c *Carteira) AssinarDesafio(desafio string) string {
+	return hex.EncodeToString(ed25519.Sign(c.privada, mensagemDesafio(desafio)))
+}
+
+// remetente devolve o endereço de quem assinou a transação.
+func remetente(tx Transacao) string {
+	publica, err := hex.DecodeString(tx.ChavePublica)
+	if err != nil || len(publica) != ed25519.PublicKeySize {
+		return ""
+	}
+	return EnderecoDe(publica)
+}
+
+func verificarAssinatura(tx Transacao) bool {
+	publica, err := hex.DecodeString(tx.ChavePublica)
+	if err != nil || len(publica) != ed25519.PublicKeySize {
+		return false
+	}
+	assinatura, err := hex.DecodeString(tx.Assinatura)
+	if err != nil {
+		return false
+	}
+	return ed25519.Verify(publica, []byte(tx.ID), assinatura)
+}
+
+// verificarAutorizacao garante que só o dono de uma conta debita o saldo dela
+// ou aposta e vota em nome dela. Quem pode creditar saldo depende do estado
+// (ver EstadoMundo.podeCreditar).
+func verificarAutorizacao(tx Transacao) error {
+	assinante := remetente(tx)
+	switch tx.Tipo {
+	case "ajustar_saldo":
+		var ajuste struct {
+			Usuario string  `json:"usuario"`
+			Valor   Quantia `json:"valor"`
+		}
+		if err := json.Unmarshal([]byte(tx.Dados), &ajuste); err != nil {
+			return fmt.Errorf("ajuste de saldo malformado")
+		}
+		if ajuste.Valor < 0 && ajuste.Usuario != assinante {
+			return fmt.Errorf("débito na conta %s assinado por %s", ajuste.Usuario, assinante)
+		}
+	case "apostar":
+		var aposta Aposta
+		if err := json.Unmarshal([]byte(tx.Dados), &aposta); err != nil {
+			return fmt.Errorf("aposta malformada")
+		}
+		if aposta.Usuario != assinante {
+			return fmt.Errorf("aposta da conta %s assinada por %s", aposta.Usuario, assinante)
+		}
+	case "votar":
+		var voto Voto
+		if err := json.Unmarshal([]byte(tx.Dados), &voto); err != nil {
+			return fmt.Errorf("voto malformado")
+		}
+		if voto.Usuario != assinante {
+			return fmt.Errorf("voto da conta %s assinado por %s", voto.Usuario, assinante)
+		}
+	}
+	return nil
+}
+
+// validarTransacaoAssinada reúne as verificações que não dependem do estado da
+// cadeia: ID, assinatura e autorização.
+func validarTransacaoAssinada(tx Transacao) error {
+	if tx.ID != calculaIDTransacao(tx) {
+		return fmt.Errorf("ID da transação não confere")
+	}
+	if !verificarAssinatura(tx) {
+		return fmt.Errorf("assinatura inválida")
+	}
+	return verificarAutorizacao(tx)
+}
+
+// ProximoNonce considera também as transações da conta que ainda estão no
+// mempool. Deve ser chamado com bc.mu travado.
+func (bc *Blockchain) ProximoNonce(endereco string) uint64 {
+	proximo := bc.estado.Nonces[endereco]
+	for _, tx := range bc.mempool.Pendentes() {
+		if remetente(tx) == endereco && tx.Nonce >= proximo {
+			proximo = tx.Nonce + 1
+		}
+	}
+	return proximo
+}
+
+// NovaTransacaoDoNo cria uma transação assinada pela carteira do próprio nó.
+// proximoNonceNo evita repetir o nonce de uma transação criada mas ainda não
+// colocada no mempool.
+func (bc *Blockchain) NovaTransacaoDoNo(tipo string, dados interface{}) (Transacao, error) {
+	tx, err := NovaTransacao(tipo, dados)
+	if err != nil {
+		return Transacao{}, err
+	}
+	tx.ChainID = bc.genesis.ChainID
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	nonce := bc.ProximoNonce(bc.carteira.Endereco)
+	if nonce < bc.proximoNonceNo {
+		nonce = bc.proximoNonceNo
+	}
+	bc.carteira.Assinar(&tx, nonce)
+	bc.proximoNonceNo = nonce + 1
+	return tx, nil
+}
+
+func (bc *Blockchain) HandleConta(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	if r.Method == "OPTIONS" {
+		return
+	}
+	endereco := r.URL.Query().Get("endereco")
+	if endereco == "" {
+		http.Error(w, "Parâmetro 'endereco' é obrigatório", http.StatusBadRequest)
+		return
+	}
+	saldo := bc.CalcularSaldo(endereco)
+	bc.mu.Lock()
+	nonce := bc.ProximoNonce(endereco)
+	bc.mu.Unlock()
+	type ContaResponse struct {
+		Endereco     string  `json:"endereco"`
+		Saldo        Quantia `json:"saldo"`
+		ProximoNonce uint64  `json:"proximo_nonce"`
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ContaResponse{Endereco: endereco, Saldo: saldo, ProximoNonce: nonce})
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+// Testa que alterar qualquer campo de uma transação assinada invalida a assinatura
+func TestTransacaoAdulteradaRejeitada(t *testing.T) {
+	carteira, _ := NovaCarteira()
+	tx := transacaoAssinada(t, carteira, 0, "ajustar_saldo", map[string]interface{}{"usuario": carteira.Endereco, "valor": -5.0})
+	if err := validarTransacaoAssinada(tx); err != nil {
+		t.Fatalf("Transação assinada deveria ser válida: %v", err)
+	}
+
+	adulterada := tx
+	adulterada.Dados = `{"usuario":"` + carteira.Endereco + `","valor":-500}`
+	adulterada.ID = calculaIDTransacao(adulterada)
+	if validarTransacaoAssinada(adulterada) == nil {
+		t.Error("Transação com dados alterados deveria ter assinatura inválida")
+	}
+
+	outra, _ := NovaCarteira()
+	roubada := tx
+	roubada.ChavePublica = outra.Endereco
+	if validarTransacaoAssinada(roubada) == nil {
+		t.Error("Transação com chave pública trocada deveria ser inválida")
+	}
+}
+
+// Testa que só o dono de uma conta pode debitá-la ou apostar em nome dela
+func TestDebitoDeOutraContaRejeitado(t *testing.T) {
+	dono, _ := NovaCarteira()
+	ladrao, _ := NovaCarteira()
+	debito := transacaoAssinada(t, ladrao, 0, "ajustar_saldo", map[string]interface{}{"usuario": dono.Endereco, "valor": -5.0})
+	if validarTransacaoAssinada(debito) == nil {
+		t.Error("Débito assinado por outra conta deveria ser rejeitado")
+	}
+	aposta := transacaoAssinada(t, ladrao, 0, "apostar", Aposta{Usuario: dono.Endereco, EventoID: 1, Opcao: "A", Valor: Reais(1)})
+	if validarTransacaoAssinada(aposta) == nil {
+		t.Error("Aposta em nome de outra conta deveria ser rejeitada")
+	}
+}
+
+// Testa que um bloco que repete o nonce de uma conta é recusado
+func TestNonceRepetidoRejeitado(t *testing.T) {
+	carteira, _ := NovaCarteira()
+	bc := novoBlockchainComSaldos(t, map[*Carteira]Quantia{carteira: Reais(10)})
+	tx := transacaoAssinada(t, carteira, 0, "ajustar_saldo", map[string]interface{}{"usuario": carteira.Endereco, "valor": -1.0})
+	bc.AdicionarTransacao(tx)
+	if len(bc.Blocos) != 2 {
+		t.Fatalf("Esperados 2 blocos, obtidos %d", len(bc.Blocos))
+	}
+
+	bc.AdicionarTransacao(tx)
+	repetida := transacaoAssinada(t, carteira, 0, "ajustar_saldo", map[string]interface{}{"usuario": carteira.Endereco, "valor": -2.0})
+	bc.AdicionarTransacao(repetida)
+	if len(bc.Blocos) != 2 {
+		t.Errorf("Transações com nonce repetido não deveriam entrar na cadeia, cadeia tem %d blocos", len(bc.Blocos))
+	}
+	if bc.CalcularSaldo(carteira.Endereco) != Reais(9) {
+		t.Errorf("Saldo esperado 9, obtido %s", bc.CalcularSaldo(carteira.Endereco))
+	}
+}
+
+// Testa que a carteira do nó é a mesma depois de reabrir o arquivo
+func TestCarregarCarteiraPersistente(t *testing.T) {
+	caminho := filepath.Join(t.TempDir(), "carteira.key")
+	primeira, err := CarregarCarteira(caminho)
+	if err != nil {
+		t.Fatal(err)
+	}
+	segunda, err := CarregarCarteira(caminho)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if primeira.Endereco != segunda.Endereco {
+		t.Errorf("Endereço mudou ao recarregar: %s != %s", primeira.Endereco, segunda.Endereco)
+	}
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"math/big"
+	"time"
+)
+
+// Decisões de uma apelação.
+const (
+	// ApelacaoMantida confirma o resultado; o contestante perde a caução,
+	// que sai de circulação.
+	ApelacaoMantida = "mantida"
+	// ApelacaoRevertida troca o resultado pela opção mais votada; a caução
+	// é devolvida e o contestante fica também com a caução do resolvedor.
+	ApelacaoRevertida = "revertida"
+	// ApelacaoInconclusiva acontece sem quórum ou maioria: o evento é
+	// cancelado, as apostas e a caução são devolvidas.
+	ApelacaoInconclusiva = "inconclusiva"
+)
+
+// Contestacao é a disputa aberta contra o resultado de um evento. Enquanto
+// ela durar os prêmios ficam congelados e cada apostador do evento pode votar
+// na opção que considera correta. O quórum conta votantes e a maioria é
+// calculada sobre o total apostado por eles, para que contas criadas só para
+// votar não decidam nada; ambos são os da rede, em Parametros.
+type Contestacao struct {
+	Contestante string  `json:"contestante"`
+	Opcao       string  `json:"opcao"`
+	Caucao      Quantia `json:"caucao"`
+	// fim da votação de apelação em RFC 3339
+	FimApelacao string            `json:"fim_apelacao"`
+	Votos       map[string]string `json:"votos,omitempty"`
+	Decisao     string            `json:"decisao,omitempty"`
+	Vencedora   string            `json:"vencedora,omitempty"`
+}
+
+// ContestacaoAberta diz se o resultado do evento ainda pode ser contestado no
+// instante: está resolvido e o período de contestação não terminou.
+func ContestacaoAberta(evento *Evento, instante time.Time) bool {
+	if evento.Situacao != SituacaoResolvido || evento.PremiosPagos {
+		return false
+	}
+	libera, err := time.Parse(time.RFC3339, evento.LiberaPremios)
+	return err == nil && instante.Before(libera)
+}
+
+// contestar debita a caução da conta e abre a apelação do evento.
+func (e *EstadoMundo) contestar(evento *Evento, conta, opcao string, instante time.Time, alteracoes *alteracoesBloco) *ErroValidacao {
+	if err := exigirSituacao(evento, SituacaoResolvido); err != nil {
+		return err
+	}
+	if !ContestacaoAberta(evento, instante) {
+		return rejeitar(MotivoPrazoContestacao, "resultado do evento %d não pode mais ser contestado", evento.ID)
+	}
+	if conta == "" {
+		return rejeitar(MotivoNaoAutorizado, "contestação precisa ser assinada")
+	}
+	if opcao == evento.Resultado {
+		return rejeitar(MotivoOpcaoInvalida, "contestação precisa apontar uma opção diferente de %q", evento.Resultado)
+	}
+	caucao := e.Parametros.CaucaoContestacao
+	if e.Saldos[conta] < caucao {
+		return rejeitar(MotivoSaldoInsuficiente, "conta %s não tem %s para a caução", conta, caucao)
+	}
+	if err := e.creditar(conta, -caucao, alteracoes); err != nil {
+		return err
+	}
+	e.mudarSituacao(evento, SituacaoDisputado, alteracoes)
+	fim := instante.Add(time.Duration(e.Parametros.JanelaApelacao) * time.Second)
+	evento.Contestacao = &Contestacao{
+		Contestante: conta,
+		Opcao:       opcao,
+		Caucao:      caucao,
+		FimApelacao: fim.Format(time.RFC3339),
+	}
+	return nil
+}
+
+func fimApelacao(evento *Evento) time.Time {
+	fim, _ := time.Parse(time.RFC3339, evento.Contestacao.FimApelacao)
+	return fim
+}
+
+// caucionarResolucao debita a caução de quem concluiu o evento. Num multisig
+// paga quem completou o mínimo de aprovações.
+func (e *EstadoMundo) caucionarResolucao(evento *Evento, conta string, alteracoes *alteracoesBloco) *ErroValidacao {
+	caucao := e.Parametros.CaucaoResolucao
+	if e.Saldos[conta] < caucao {
+		return rejeitar(MotivoSaldoInsuficiente, "conta %s não tem %s para a caução de resolução", conta, caucao)
+	}
+	if err := e.creditar(conta, -caucao, alteracoes); err != nil {
+		return err
+	}
+	e.registrarEvento(evento, alteracoes)
+	evento.Resolvedor = conta
+	evento.CaucaoResolucao = caucao
+	return nil
+}
+
+// apostado devolve o total que a conta apostou no evento.
+func apostado(evento *Evento, conta string) Quantia {
+	var total Quantia
+	for _, opcao := range evento.Opcoes {
+		for _, aposta := range evento.Votos[opcao] {
+			if aposta.Usuario == conta {
+				total += aposta.Valor
+			}
+		}
+	}
+	return total
+}
+
+// votarApelacao registra o voto de um apostador na apelação, substituindo um
+// voto anterior dele.
+func (e *EstadoMundo) votarApelacao(evento *Evento, conta, opcao string, instante time.Time, alteracoes *alteracoesBloco) *ErroValidacao {
+	if !instante.Before(fimApelacao(evento)) {
+		return rejeitar(MotivoVotacaoEncerrada, "apelação do evento %d encerrada em %s", evento.ID, evento.Contestacao.FimApelacao)
+	}
+	if conta == "" {
+		return rejeitar(MotivoNaoAutorizado, "voto de apelação precisa ser assinado")
+	}
+	if apostado(evento, conta) <= 0 {
+		return rejeitar(MotivoNaoAutorizado, "conta %s não apostou no evento %d", conta, evento.ID)
+	}
+	// A contestação é substituída, não alterada, como os mapas do evento
+	contestacao := *evento.Contestacao
+	contestacao.Votos = make(map[string]string, len(evento.Contestacao.Votos)+1)
+	for votante, anterior := range evento.Contestacao.Votos {
+		contestacao.Votos[votante] = anterior
+	}
+	contestacao.Votos[conta] = opcao
+	e.registrarEvento(evento, alteracoes)
+	evento.Contestacao = &contestacao
+	return nil
+}
+
+// apurarApelacao devolve a opção com a maioria exigida do valor apostado
+// pelos votantes da apelação, ou "" sem quórum ou maioria.
+func (e *EstadoMundo) apurarApelacao(evento *Evento, contestacao *Contestacao) string {
+	if len(contestacao.Votos) < e.Parametros.QuorumApelacao {
+		return ""
+	}
+	total := new(big.Int)
+	pesos := make(map[string]*big.Int)
+	for votante, opcao := range contestacao.Votos {
+		peso := big.NewInt(int64(apostado(evento, votante)))
+		total.Add(total, peso)
+		if pesos[opcao] == nil {
+			pesos[opcao] = new(big.Int)
+		}
+		pesos[opcao].Add(pesos[opcao], peso)
+	}
+	exigido := new(big.Int).Mul(total, big.NewInt(int64(e.Parametros.MaioriaApelacao)))
+	for _, opcao := range evento.Opcoes {
+		if pesos[opcao] != nil && new(big.Int).Mul(pesos[opcao], big.NewInt(100)).Cmp(exigido) >= 0 {
+			return opcao
+		}
+	}
+	return ""
+}
+
+// creditarEm soma valor ao pagamento da conta.
+func creditarEm(pagamentos map[string]Quantia, conta string, valor Quantia) error {
+	if valor == 0 {
+		return nil
+	}
+	total, err := pagamentos[conta].Somar(valor)
+	if err != nil {
+		return err
+	}
+	pagamentos[conta] = total
+	return nil
+}
+
+// encerrarApelacoes decide as apelações cuja votação terminou até o instante
+// do bloco e paga o que a decisão mandar. A decisão é definitiva.
+func (e *EstadoMundo) encerrarApelacoes(instante time.Time, alteracoes *alteracoesBloco) {
+	for id := 1; id <= len(e.Eventos); id++ {
+		evento := e.Eventos[id]
+		if evento.Situacao != SituacaoDisputado || instante.Before(fimApelacao(evento)) {
+			continue
+		}
+		contestacao := *evento.Contestacao
+		contestacao.Vencedora = e.apurarApelacao(evento, &contestacao)
+		premios, err := premiosParimutuel(evento, contestacao.Vencedora)
+		switch {
+		case contestacao.Vencedora == "":
+			contestacao.Decisao = ApelacaoInconclusiva
+			premios, err = devolucoes(evento)
+		case contestacao.Vencedora == evento.Resultado:
+			contestacao.Decisao = ApelacaoMantida
+		default:
+			contestacao.Decisao = ApelacaoRevertida
+		}
+		if err != nil {
+			continue
+		}
+		pagamentos := make(map[string]Quantia, len(premios)+1)
+		for usuario, valor := range premios {
+			pagamentos[usuario] = valor
+		}
+		// A caução do resolvedor vai para o contestante quando o resultado
+		// é revertido e volta para o resolvedor nos outros casos
+		resolucao := evento.Resolvedor
+		if contestacao.Decisao == ApelacaoRevertida {
+			resolucao = contestacao.Contestante
+		}
+		if creditarEm(pagamentos, resolucao, evento.CaucaoResolucao) != nil {
+			continue
+		}
+		if contestacao.Decisao != ApelacaoMantida && creditarEm(pagamentos, contestacao.Contestante, contestacao.Caucao) != nil {
+			continue
+		}
+		if e.pagar(pagamentos, alteracoes) != nil {
+			continue
+		}
+		e.registrarEvento(evento, alteracoes)
+		evento.Contestacao = &contestacao
+		evento.Premios = premios
+		evento.PremiosPagos = true
+		if contestacao.Decisao == ApelacaoInconclusiva {
+			evento.Situacao = SituacaoCancelado
+		} else {
+			evento.Situacao = SituacaoResolvido
+			evento.Resultado = contestacao.Vencedora
+		}
+	}
+}
+
+// liberarPremios paga os eventos resolvidos cujo período de contestação
+// terminou até o instante do bloco sem que ninguém contestasse, e devolve a
+// caução do resolvedor.
+func (e *EstadoMundo) liberarPremios(instante time.Time, alteracoes *alteracoesBloco) {
+	for id := 1; id <= len(e.Eventos); id++ {
+		evento := e.Eventos[id]
+		if evento.Situacao != SituacaoResolvido || evento.PremiosPagos || ContestacaoAberta(evento, instante) {
+			continue
+		}
+		pagamentos := make(map[string]Quantia, len(evento.Premios)+1)
+		for usuario, valor := range evento.Premios {
+			pagamentos[usuario] = valor
+		}
+		if creditarEm(pagamentos, evento.Resolvedor, evento.CaucaoResolucao) != nil {
+			continue
+		}
+		if e.pagar(pagamentos, alteracoes) != nil {
+			continue
+		}
+		e.registrarEvento(evento, alteracoes)
+		evento.PremiosPagos = true
+	}
+}
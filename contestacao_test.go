@@ -0,0 +1,201 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// eventoResolvido monta um estado com um evento concluído em X às 13h: alice
+// apostou 30 em X e depositou a caução de resolução, bob 10 em Y e ficou com
+// 10 para a caução de contestação. Cada apostador extra aposta 10 em Y, com o
+// nonce 0.
+func eventoResolvido(t *testing.T, apostadores ...*Carteira) (*EstadoMundo, *Carteira, *Carteira, time.Time) {
+	alice, _ := NovaCarteira()
+	bob, _ := NovaCarteira()
+	saldos := map[*Carteira]Quantia{alice: Reais(40), bob: Reais(20)}
+	for _, apostador := range apostadores {
+		saldos[apostador] = Reais(10)
+	}
+	estado := estadoComSaldos(t, saldos)
+	inicio := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	prazo := inicio.Add(time.Hour)
+	txs := []Transacao{
+		transacaoAssinada(t, alice, 0, "criar_evento", Evento{Nome: "Final", Opcoes: []string{"X", "Y"}, FechaApostas: prazo.Format(time.RFC3339)}),
+		transacaoAssinada(t, alice, 1, "apostar", Aposta{Usuario: alice.Endereco, Valor: Reais(30), EventoID: 1, Opcao: "X"}),
+		transacaoAssinada(t, bob, 0, "apostar", Aposta{Usuario: bob.Endereco, Valor: Reais(10), EventoID: 1, Opcao: "Y"}),
+	}
+	for _, apostador := range apostadores {
+		txs = append(txs,
+			transacaoAssinada(t, apostador, 0, "apostar", Aposta{Usuario: apostador.Endereco, Valor: Reais(10), EventoID: 1, Opcao: "Y"}),
+		)
+	}
+	if err := estado.Aplicar(blocoEm(inicio, txs...)); err != nil {
+		t.Fatal(err)
+	}
+	if err := estado.Aplicar(blocoEm(prazo, transacaoAssinada(t, alice, 2, "concluir_evento", map[string]interface{}{"evento_id": 1, "opcao_vencedora": "X"}))); err != nil {
+		t.Fatal(err)
+	}
+	return estado, alice, bob, prazo
+}
+
+// apelar contesta o resultado em nome de bob e registra o voto de apelação
+// de cada apostador extra, com o nonce 1.
+func apelar(t *testing.T, estado *EstadoMundo, bob *Carteira, instante time.Time, votos map[*Carteira]string) {
+	txs := []Transacao{transacaoAssinada(t, bob, 1, "contestar_evento", map[string]interface{}{"evento_id": 1, "opcao": "Y"})}
+	for votante, opcao := range votos {
+		txs = append(txs, transacaoAssinada(t, votante, 1, "votar", Voto{Usuario: votante.Endereco, EventoID: 1, Opcao: opcao}))
+	}
+	if err := estado.Aplicar(blocoEm(instante, txs...)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func novasCarteiras(n int) []*Carteira {
+	carteiras := make([]*Carteira, n)
+	for i := range carteiras {
+		carteiras[i], _ = NovaCarteira()
+	}
+	return carteiras
+}
+
+// Testa que sem contestação os prêmios e a caução de resolução só são creditados quando o período termina
+func TestPremiosLiberadosDepoisDaContestacao(t *testing.T) {
+	estado, alice, bob, resolucao := eventoResolvido(t)
+	if err := estado.Aplicar(blocoEm(resolucao.Add(59 * time.Minute))); err != nil {
+		t.Fatal(err)
+	}
+	if estado.Saldos[alice.Endereco] != 0 {
+		t.Fatalf("Prêmio não deveria ser creditado durante a contestação, obtido %s", estado.Saldos[alice.Endereco])
+	}
+	if err := estado.Aplicar(blocoEm(resolucao.Add(time.Hour))); err != nil {
+		t.Fatal(err)
+	}
+	if evento, _ := estado.Evento(1); !evento.PremiosPagos || estado.Saldos[alice.Endereco] != Reais(50) {
+		t.Fatalf("Prêmio de 40 e caução de 10 deveriam ser creditados no fim da contestação, obtido %s", estado.Saldos[alice.Endereco])
+	}
+	tardia := transacaoAssinada(t, bob, 1, "contestar_evento", map[string]interface{}{"evento_id": 1, "opcao": "Y"})
+	if err := estado.Aplicar(blocoEm(resolucao.Add(time.Hour), tardia)); motivoDe(err) != MotivoPrazoContestacao {
+		t.Errorf("Contestação depois do período deveria ser recusada, obtido %v", err)
+	}
+	estado.Desfazer()
+	if evento, _ := estado.Evento(1); evento.PremiosPagos || estado.Saldos[alice.Endereco] != 0 {
+		t.Errorf("Desfazer deveria reter o prêmio de novo, obtido %+v", evento)
+	}
+}
+
+// Testa que a contestação congela os prêmios e que a apelação revertida troca o resultado, devolve a caução e entrega ao contestante a do resolvedor
+func TestApelacaoRevertida(t *testing.T) {
+	carteiras := novasCarteiras(3)
+	estado, alice, bob, resolucao := eventoResolvido(t, carteiras...)
+	mesmaOpcao := transacaoAssinada(t, bob, 1, "contestar_evento", map[string]interface{}{"evento_id": 1, "opcao": "X"})
+	if err := estado.Aplicar(blocoEm(resolucao, mesmaOpcao)); motivoDe(err) != MotivoOpcaoInvalida {
+		t.Errorf("Contestação na opção vencedora deveria ser recusada, obtido %v", err)
+	}
+	apelar(t, estado, bob, resolucao.Add(time.Minute), map[*Carteira]string{carteiras[0]: "Y", carteiras[1]: "Y", carteiras[2]: "X"})
+	if evento, _ := estado.Evento(1); evento.Situacao != SituacaoDisputado || estado.Saldos[bob.Endereco] != 0 {
+		t.Fatalf("Contestação deveria debitar a caução e disputar o evento, obtido %+v", evento)
+	}
+
+	// O período de contestação termina durante a apelação: nada é pago
+	if err := estado.Aplicar(blocoEm(resolucao.Add(2 * time.Hour))); err != nil {
+		t.Fatal(err)
+	}
+	if estado.Saldos[alice.Endereco] != 0 {
+		t.Fatalf("Prêmios deveriam continuar congelados, obtido %s", estado.Saldos[alice.Endereco])
+	}
+
+	// Y tem 20 dos 30 apostados pelos votantes, acima dos 66% padrão
+	if err := estado.Aplicar(blocoEm(resolucao.Add(25 * time.Hour))); err != nil {
+		t.Fatal(err)
+	}
+	evento, _ := estado.Evento(1)
+	if evento.Situacao != SituacaoResolvido || evento.Resultado != "Y" || evento.Contestacao.Decisao != ApelacaoRevertida {
+		t.Fatalf("Apelação deveria reverter o resultado, obtido %+v", evento)
+	}
+	// Bob recebe 17,50 do prêmio, a própria caução e a caução de resolução da alice
+	if estado.Saldos[bob.Endereco] != Quantia(3750) || estado.Saldos[alice.Endereco] != 0 {
+		t.Errorf("Bob deveria receber 37,50 e alice perder a caução, obtido %s e %s", estado.Saldos[bob.Endereco], estado.Saldos[alice.Endereco])
+	}
+	estado.Desfazer()
+	if evento, _ := estado.Evento(1); evento.Situacao != SituacaoDisputado || evento.Resultado != "X" || estado.Saldos[bob.Endereco] != 0 {
+		t.Errorf("Desfazer deveria voltar à disputa, obtido %+v", evento)
+	}
+}
+
+// Testa que a apelação mantida paga o resultado original, devolve a caução do resolvedor e fica com a do contestante
+func TestApelacaoMantidaPerdeCaucao(t *testing.T) {
+	carteiras := novasCarteiras(3)
+	estado, alice, bob, resolucao := eventoResolvido(t, carteiras...)
+	apelar(t, estado, bob, resolucao, map[*Carteira]string{carteiras[0]: "X", carteiras[1]: "X", carteiras[2]: "X"})
+	if err := estado.Aplicar(blocoEm(resolucao.Add(24 * time.Hour))); err != nil {
+		t.Fatal(err)
+	}
+	evento, _ := estado.Evento(1)
+	if evento.Resultado != "X" || evento.Contestacao.Decisao != ApelacaoMantida || !evento.PremiosPagos {
+		t.Fatalf("Apelação deveria manter o resultado, obtido %+v", evento)
+	}
+	if estado.Saldos[alice.Endereco] != Reais(80) || estado.Saldos[bob.Endereco] != 0 {
+		t.Errorf("Alice deveria receber 70 e a caução, e bob perder a dele, obtido %s e %s", estado.Saldos[alice.Endereco], estado.Saldos[bob.Endereco])
+	}
+}
+
+// Testa que sem quórum a apelação cancela o evento e devolve apostas e cauções
+func TestApelacaoInconclusivaCancela(t *testing.T) {
+	carteiras := novasCarteiras(1)
+	estado, alice, bob, resolucao := eventoResolvido(t, carteiras...)
+	apelar(t, estado, bob, resolucao, map[*Carteira]string{carteiras[0]: "Y"})
+	if err := estado.Aplicar(blocoEm(resolucao.Add(24 * time.Hour))); err != nil {
+		t.Fatal(err)
+	}
+	evento, _ := estado.Evento(1)
+	if evento.Situacao != SituacaoCancelado || evento.Contestacao.Decisao != ApelacaoInconclusiva {
+		t.Fatalf("Apelação sem quórum deveria cancelar o evento, obtido %+v", evento)
+	}
+	if estado.Saldos[alice.Endereco] != Reais(40) || estado.Saldos[bob.Endereco] != Reais(20) {
+		t.Errorf("Apostas e cauções deveriam ser devolvidas, obtido %s e %s", estado.Saldos[alice.Endereco], estado.Saldos[bob.Endereco])
+	}
+}
+
+// Testa que só apostadores votam na apelação e que a maioria é pesada pelo valor apostado, não pelo número de contas
+func TestApelacaoPesadaPelasApostas(t *testing.T) {
+	carteiras := novasCarteiras(2)
+	estado, alice, bob, resolucao := eventoResolvido(t, carteiras...)
+	apelar(t, estado, bob, resolucao, map[*Carteira]string{carteiras[0]: "Y", carteiras[1]: "Y"})
+
+	// Contas novas, sem aposta no evento, não votam
+	for _, sybil := range novasCarteiras(3) {
+		voto := transacaoAssinada(t, sybil, 0, "votar", Voto{Usuario: sybil.Endereco, EventoID: 1, Opcao: "Y"})
+		if err := estado.Aplicar(blocoEm(resolucao.Add(time.Minute), voto)); motivoDe(err) != MotivoNaoAutorizado {
+			t.Fatalf("Voto de quem não apostou deveria ser recusado, obtido %v", err)
+		}
+	}
+
+	// Y tem 2 dos 3 votos, mas só 20 dos 50 apostados pelos votantes
+	voto := transacaoAssinada(t, alice, 3, "votar", Voto{Usuario: alice.Endereco, EventoID: 1, Opcao: "X"})
+	if err := estado.Aplicar(blocoEm(resolucao.Add(time.Minute), voto)); err != nil {
+		t.Fatal(err)
+	}
+	if err := estado.Aplicar(blocoEm(resolucao.Add(24 * time.Hour))); err != nil {
+		t.Fatal(err)
+	}
+	if evento, _ := estado.Evento(1); evento.Contestacao.Decisao != ApelacaoInconclusiva {
+		t.Errorf("Maioria de contas sem maioria do valor apostado não deveria reverter o resultado, obtido %+v", evento.Contestacao)
+	}
+}
+
+// Testa que os parâmetros de contestação vêm do gênesis, com padrão para os omitidos
+func TestParametrosDoGenesis(t *testing.T) {
+	especificacao := GenesisPadrao
+	especificacao.PeriodoContestacao = 60
+	estado := NovoEstadoMundo()
+	if err := estado.Aplicar(especificacao.Bloco()); err != nil {
+		t.Fatal(err)
+	}
+	if estado.Parametros.PeriodoContestacao != 60 || estado.Parametros.CaucaoContestacao != caucaoContestacaoPadrao {
+		t.Errorf("Parâmetros inesperados: %+v", estado.Parametros)
+	}
+	especificacao.MaioriaApelacao = 40
+	if err := especificacao.Validar(); err == nil {
+		t.Error("Maioria de apelação abaixo de 51% deveria ser recusada")
+	}
+}
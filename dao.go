@@ -1,8 +1,6 @@
 package main
 
 import (
-	"crypto/sha256"
-	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"log"
@@ -15,14 +13,18 @@ import (
 const dificuldade = 3
 
 type Bloco struct {
-	Indice       int    `json:"index"`
-	Timestamp    string `json:"timestamp"`
-	Evento       string `json:"evento"`
-	Resultado    string `json:"resultado"`
-	HashAnterior string `json:"hash_anterior"`
-	HashAtual    string `json:"hash_atual"`
-	Nonce        int    `json:"nonce"`
-	Dificuldade  int    `json:"dificuldade"`
+	Versao       int         `json:"versao,omitempty"`
+	ChainID      string      `json:"chain_id,omitempty"`
+	Indice       int         `json:"index"`
+	Timestamp    string      `json:"timestamp"`
+	Evento       string      `json:"evento"`
+	Resultado    string      `json:"resultado"`
+	HashAnterior string      `json:"hash_anterior"`
+	HashAtual    string      `json:"hash_atual"`
+	Nonce        int         `json:"nonce"`
+	Dificuldade  int         `json:"dificuldade"`
+	RaizMerkle   string      `json:"raiz_merkle,omitempty"`
+	Transacoes   []Transacao `json:"transacoes,omitempty"`
 }
 
 type Evento struct {
@@ -31,43 +33,175 @@ type Evento struct {
 	Opcoes    []string            `json:"opcoes"`
 	Votos     map[string][]Aposta `json:"votos"`
 	Resultado string              `json:"resultado"`
+	Situacao  SituacaoEvento      `json:"situacao"`
+	// prazo das apostas em RFC 3339; vazio não trava o evento sozinho
+	FechaApostas string `json:"fecha_apostas,omitempty"`
+	// categoria livre, usada pelas delegações de voto por categoria
+	Categoria string `json:"categoria,omitempty"`
+	// quanto cada apostador recebe na liquidação ou recebeu no cancelamento
+	Premios      map[string]Quantia `json:"premios,omitempty"`
+	Criador      string             `json:"criador,omitempty"`
+	Resolvedores *Resolvedores      `json:"resolvedores,omitempty"`
+	// decisão de cada resolvedor de um multisig que ainda não chegou ao mínimo
+	Aprovacoes map[string]string `json:"aprovacoes,omitempty"`
+	// voto atual de cada conta; só decide o resultado em eventos resolvidos
+	// por votação
+	Votacao  map[string]string `json:"votacao,omitempty"`
+	Apuracao *Apuracao         `json:"apuracao,omitempty"`
+	// instante (RFC 3339) em que termina o período de contestação e os
+	// prêmios de um evento resolvido são creditados
+	LiberaPremios string       `json:"libera_premios,omitempty"`
+	PremiosPagos  bool         `json:"premios_pagos,omitempty"`
+	Contestacao   *Contestacao `json:"contestacao,omitempty"`
+	// quem concluiu o evento e a caução que depositou ao concluir; volta
+	// para ele junto com os prêmios, a não ser que a apelação reverta o
+	// resultado
+	Resolvedor      string  `json:"resolvedor,omitempty"`
+	CaucaoResolucao Quantia `json:"caucao_resolucao,omitempty"`
 }
 
 type Aposta struct {
 	Usuario  string  `json:"usuario"`
-	Valor    float64 `json:"valor"`
+	Valor    Quantia `json:"valor"`
 	EventoID int     `json:"evento_id"`
 	Opcao    string  `json:"opcao"`
 }
 
+// Voto é um voto num evento ou, com PropostaID, numa proposta de governança
+// (Opcao VotoSim ou VotoNao).
 type Voto struct {
-	Usuario  string `json:"usuario"`
-	EventoID int    `json:"evento_id"`
-	Opcao    string `json:"opcao"`
+	Usuario    string `json:"usuario"`
+	EventoID   int    `json:"evento_id"`
+	Opcao      string `json:"opcao"`
+	PropostaID int    `json:"proposta_id,omitempty"`
 }
 
 type Blockchain struct {
-	Blocos []Bloco
-	mu     sync.Mutex
-	peers  []string
+	Blocos        []Bloco
+	mu            sync.Mutex
+	peers         *GerenciadorPeers
+	armazenamento Armazenamento
+	genesis       EspecificacaoGenesis
+	hashGenesis   string
+	arvore        *ArvoreBlocos
+	ponta         *noBloco
+	reorgs        []EventoReorg
+	mempool       *Mempool
+	txConfirmadas map[string]int
+	estado        *EstadoMundo
+	// carteira do nó, para transações criadas pelo próprio nó
+	carteira       *Carteira
+	proximoNonceNo uint64
+	// fechado (e trocado por um novo) sempre que a ponta muda
+	novaPonta              chan struct{}
+	muMineracao            sync.Mutex
+	trabalhadoresMineracao int
+	// exigido nos endpoints de administração; vazio desativa-os
+	tokenAdmin string
+	sincronia  sincronizacao
+	// blocos recebidos antes do pai
+	orfaos  *PoolOrfaos
+	sessoes *GerenciadorSessoes
 }
 
 func NovoBlockchain(peers []string) *Blockchain {
-	genesisTimestamp := time.Now().Format(time.RFC3339)
-	genesisBloco := Bloco{
-		Indice:       0,
-		Timestamp:    genesisTimestamp,
-		Evento:       "genesis",
-		Resultado:    "",
-		HashAnterior: "",
-		Nonce:        0,
-		Dificuldade:  dificuldade,
+	bc, err := CarregarBlockchain(peers, NovoArmazenamentoMemoria(), GenesisPadrao)
+	if err != nil {
+		log.Fatalf("Erro ao criar blockchain em memória: %v", err)
+	}
+	return bc
+}
+
+// CarregarBlockchain recupera a cadeia gravada no armazenamento, ou grava o
+// bloco gênesis da especificação se ele estiver vazio. Os blocos carregados são
+// validados de novo e tudo a partir do primeiro bloco inválido é descartado.
+func CarregarBlockchain(peers []string, armazenamento Armazenamento, especificacao EspecificacaoGenesis) (*Blockchain, error) {
+	if err := especificacao.Validar(); err != nil {
+		return nil, err
+	}
+	blocos, err := armazenamento.Carregar()
+	if err != nil {
+		return nil, fmt.Errorf("carregando blocos: %w", err)
+	}
+	genesis := especificacao.Bloco()
+	carteira, err := NovaCarteira()
+	if err != nil {
+		return nil, err
+	}
+	bc := &Blockchain{
+		carteira:      carteira,
+		peers:         NovoGerenciadorPeers(peers),
+		armazenamento: armazenamento,
+		genesis:       especificacao,
+		hashGenesis:   genesis.HashAtual,
+		arvore:        NovaArvoreBlocos(genesis),
+		orfaos:        NovoPoolOrfaos(),
+		sessoes:       NovoGerenciadorSessoes(),
+		mempool:       NovoMempool(),
+		txConfirmadas: make(map[string]int),
+		estado:        NovoEstadoMundo(),
+		novaPonta:     make(chan struct{}),
+		// pode ser alterado antes de iniciar o minerador
+		trabalhadoresMineracao: trabalhadoresPadrao(),
+	}
+	bc.ponta = bc.arvore.nos[genesis.HashAtual]
+	if len(blocos) == 0 {
+		if err := armazenamento.Anexar(genesis); err != nil {
+			return nil, fmt.Errorf("gravando bloco gênesis: %w", err)
+		}
+		bc.Blocos = []Bloco{genesis}
+		if err := bc.estado.Aplicar(genesis); err != nil {
+			return nil, fmt.Errorf("aplicando bloco gênesis: %w", err)
+		}
+		return bc, nil
+	}
+	if blocos[0].HashAtual != bc.hashGenesis {
+		return nil, fmt.Errorf("gênesis gravado (%s) não corresponde ao da rede %s (%s)", blocos[0].HashAtual, especificacao.ChainID, bc.hashGenesis)
+	}
+	validos, estado := bc.prefixoValido(blocos)
+	if validos < len(blocos) {
+		log.Printf("Descartando %d bloco(s) inválido(s) a partir do índice %d", len(blocos)-validos, validos)
+		if err := armazenamento.Truncar(validos); err != nil {
+			return nil, fmt.Errorf("descartando blocos inválidos: %w", err)
+		}
+		blocos = blocos[:validos]
+	}
+	if len(blocos) == 0 {
+		return nil, fmt.Errorf("bloco gênesis gravado é inválido")
 	}
-	genesisBloco.HashAtual = calculaHash(genesisBloco)
-	return &Blockchain{
-		Blocos: []Bloco{genesisBloco},
-		peers:  peers,
+	for _, bloco := range blocos[1:] {
+		no, err := bc.arvore.Inserir(bloco)
+		if err != nil {
+			return nil, fmt.Errorf("montando árvore de blocos: %w", err)
+		}
+		bc.ponta = no
+		bc.indexarTransacoes(bloco)
 	}
+	bc.Blocos = blocos
+	bc.estado = estado
+	log.Printf("Blockchain recuperada com %d bloco(s)", len(blocos))
+	return bc, nil
+}
+
+// prefixoValido devolve quantos blocos do início de blocos formam uma cadeia
+// válida e o estado resultante de aplicá-los.
+func (bc *Blockchain) prefixoValido(blocos []Bloco) (int, *EstadoMundo) {
+	estado := NovoEstadoMundo()
+	if len(blocos) == 0 || blocos[0].HashAtual != bc.hashGenesis || calculaHash(blocos[0]) != bc.hashGenesis {
+		return 0, estado
+	}
+	if estado.Aplicar(blocos[0]) != nil {
+		return 0, estado
+	}
+	for i := 1; i < len(blocos); i++ {
+		if bc.validarCabecalho(blocos[i], blocos[i-1], bc.dificuldadeNaCadeia(blocos, i, estado)) != nil {
+			return i, estado
+		}
+		if estado.Aplicar(blocos[i]) != nil {
+			return i, estado
+		}
+	}
+	return len(blocos), estado
 }
 
 func ServirIndex(w http.ResponseWriter, r *http.Request) {
@@ -80,12 +214,6 @@ func ServirIndex(w http.ResponseWriter, r *http.Request) {
 	http.ServeFile(w, r, "./index.html")
 }
 
-func calculaHash(bloco Bloco) string {
-	dados := fmt.Sprintf("%d%s%s%s%d%d", bloco.Indice, bloco.Timestamp, bloco.Evento, bloco.Resultado, bloco.Nonce, bloco.Dificuldade)
-	hash := sha256.Sum256([]byte(dados))
-	return hex.EncodeToString(hash[:])
-}
-
 func provaDeTrabalho(bloco Bloco, dificuldade int) (int, string) {
 	var nonce int
 	var hash string
@@ -101,74 +229,31 @@ func provaDeTrabalho(bloco Bloco, dificuldade int) (int, string) {
 	return nonce, hash
 }
 
-func (bc *Blockchain) AdicionarBloco(evento string, resultado interface{}) Bloco {
-	bc.mu.Lock()
-	defer bc.mu.Unlock()
-	ultimoBloco := bc.Blocos[len(bc.Blocos)-1]
-	resultadoBytes, err := json.Marshal(resultado)
-	if err != nil {
-		return Bloco{}
-	}
-	novoBloco := Bloco{
-		Indice:       len(bc.Blocos),
-		Timestamp:    time.Now().Format(time.RFC3339),
-		Evento:       evento,
-		Resultado:    string(resultadoBytes),
-		HashAnterior: ultimoBloco.HashAtual,
-		Dificuldade:  dificuldade,
-	}
-	nonce, hash := provaDeTrabalho(novoBloco, dificuldade)
-	novoBloco.Nonce = nonce
-	novoBloco.HashAtual = hash
-	bc.Blocos = append(bc.Blocos, novoBloco)
-	go bc.NotificarPeers(novoBloco)
-	return novoBloco
-}
-
 func (bc *Blockchain) ValidarBlockchain() bool {
 	bc.mu.Lock()
 	defer bc.mu.Unlock()
-	prefixo := strings.Repeat("0", dificuldade)
-	for i := 1; i < len(bc.Blocos); i++ {
-		blocoAtual := bc.Blocos[i]
-		blocoAnterior := bc.Blocos[i-1]
-		if blocoAtual.HashAnterior != blocoAnterior.HashAtual {
-			return false
-		}
-		recalculadoHash := calculaHash(blocoAtual)
-		if blocoAtual.HashAtual != recalculadoHash {
-			return false
-		}
-		if !strings.HasPrefix(blocoAtual.HashAtual, prefixo) {
-			return false
-		}
+	if err := bc.validarCadeia(bc.Blocos); err != nil {
+		log.Printf("Blockchain local inválida: %v", err)
+		return false
 	}
 	return true
 }
 
 func (bc *Blockchain) ValidarNovaBlockchain(novaBlockchain []Bloco) bool {
-	prefixo := strings.Repeat("0", dificuldade)
-	for i := 1; i < len(novaBlockchain); i++ {
-		blocoAtual := novaBlockchain[i]
-		blocoAnterior := novaBlockchain[i-1]
-		if blocoAtual.HashAnterior != blocoAnterior.HashAtual {
-			return false
-		}
-		recalculadoHash := calculaHash(blocoAtual)
-		if blocoAtual.HashAtual != recalculadoHash {
-			return false
-		}
-		if !strings.HasPrefix(blocoAtual.HashAtual, prefixo) {
-			return false
-		}
+	if err := bc.validarCadeia(novaBlockchain); err != nil {
+		log.Printf("Blockchain recebida rejeitada: %v", err)
+		return false
 	}
 	return true
 }
 
 func (bc *Blockchain) ValidarBloco(bloco Bloco) bool {
-	prefixo := strings.Repeat("0", dificuldade)
+	if bloco.Dificuldade < 0 {
+		return false
+	}
+	prefixo := strings.Repeat("0", bloco.Dificuldade)
 	recalculadoHash := calculaHash(bloco)
-	return bloco.HashAtual == recalculadoHash && strings.HasPrefix(bloco.HashAtual, prefixo)
+	return bloco.HashAtual == recalculadoHash && strings.HasPrefix(bloco.HashAtual, prefixo) && validarTransacoesBloco(bloco)
 }
 
 func (bc *Blockchain) ExibirBlockchainHTTP(w http.ResponseWriter, r *http.Request) {
@@ -192,27 +277,6 @@ func (bc *Blockchain) ImprimirBlockchain() {
 	}
 }
 
-func (bc *Blockchain) HandleAdicionarBloco(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-	if r.Method == "OPTIONS" {
-		return
-	}
-	type Request struct {
-		Evento    string `json:"evento"`
-		Resultado string `json:"resultado"`
-	}
-	var req Request
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Dados inválidos", http.StatusBadRequest)
-		return
-	}
-	novoBloco := bc.AdicionarBloco(req.Evento, req.Resultado)
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(novoBloco)
-}
-
 func (bc *Blockchain) HandleValidarBlockchain(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
@@ -242,11 +306,20 @@ func (bc *Blockchain) ReceberBlockchain(w http.ResponseWriter, r *http.Request)
 	}
 	bc.mu.Lock()
 	defer bc.mu.Unlock()
-	if len(novaBlockchain) > len(bc.Blocos) && bc.ValidarNovaBlockchain(novaBlockchain) {
-		bc.Blocos = novaBlockchain
+	if err := bc.validarCadeia(novaBlockchain); err != nil {
+		fmt.Fprintf(w, "Blockchain recebida é inválida: %v\n", err)
+		return
+	}
+	pontaAnterior := bc.ponta
+	if err := bc.incorporarCadeia(novaBlockchain); err != nil {
+		log.Printf("Erro ao incorporar blockchain recebida: %v", err)
+		http.Error(w, "Erro ao gravar blockchain", http.StatusInternalServerError)
+		return
+	}
+	if bc.ponta != pontaAnterior {
 		fmt.Fprintln(w, "Blockchain atualizada com sucesso")
 	} else {
-		fmt.Fprintln(w, "Blockchain recebida é inválida ou não é mais longa")
+		fmt.Fprintln(w, "Blockchain recebida não tem mais trabalho acumulado")
 	}
 }
 
@@ -262,69 +335,73 @@ func (bc *Blockchain) ReceberBloco(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Dados inválidos", http.StatusBadRequest)
 		return
 	}
-	bc.mu.Lock()
-	defer bc.mu.Unlock()
-	ultimoBloco := bc.Blocos[len(bc.Blocos)-1]
-	if novoBloco.Indice == ultimoBloco.Indice+1 && novoBloco.HashAnterior == ultimoBloco.HashAtual && bc.ValidarBloco(novoBloco) {
-		bc.Blocos = append(bc.Blocos, novoBloco)
+	origem := bc.origemDoPeer(r)
+	bc.peers.marcarConhecido(origem, novoBloco.HashAtual)
+	no, faltando, adicionado, err := bc.receberBlocoTravando(novoBloco, origem)
+	if err != nil && motivoDe(err) == "" && no != nil {
+		log.Printf("Erro ao gravar bloco recebido %d: %v", novoBloco.Indice, err)
+		http.Error(w, "Erro ao gravar bloco", http.StatusInternalServerError)
+		return
+	}
+	switch {
+	case err != nil:
+		log.Printf("Bloco recebido %d rejeitado: %v", novoBloco.Indice, err)
+		fmt.Fprintf(w, "Bloco recebido é inválido: %v\n", err)
+	case no == nil:
+		// Pai desconhecido: o bloco espera no pool enquanto os ancestrais são pedidos
+		if faltando != "" {
+			go bc.buscarAncestrais(faltando, origem)
+		}
+		fmt.Fprintln(w, "Bloco guardado como órfão")
+	case adicionado:
 		fmt.Fprintln(w, "Bloco adicionado com sucesso")
-	} else {
-		fmt.Fprintln(w, "Bloco recebido é inválido")
+	default:
+		fmt.Fprintln(w, "Bloco guardado em ramo alternativo")
 	}
 }
 
+// NotificarPeers anuncia aos peers um bloco minerado por este nó.
 func (bc *Blockchain) NotificarPeers(bloco Bloco) {
-	for _, peer := range bc.peers {
-		go func(peer string) {
-			url := fmt.Sprintf("%s/receber-bloco", peer)
-			jsonData, err := json.Marshal(bloco)
-			if err != nil {
-				return
-			}
-			http.Post(url, "application/json", strings.NewReader(string(jsonData)))
-		}(peer)
-	}
-}
-
-func (bc *Blockchain) SincronizarComPeers() {
-	for _, peer := range bc.peers {
-		go func(peer string) {
-			resp, err := http.Get(fmt.Sprintf("%s/blockchain", peer))
-			if err != nil {
-				return
-			}
-			var blockchainPeer []Bloco
-			if err := json.NewDecoder(resp.Body).Decode(&blockchainPeer); err != nil {
-				resp.Body.Close()
-				return
-			}
-			resp.Body.Close()
-			bc.mu.Lock()
-			defer bc.mu.Unlock()
-			if len(blockchainPeer) > len(bc.Blocos) && bc.ValidarNovaBlockchain(blockchainPeer) {
-				bc.Blocos = blockchainPeer
-			}
-		}(peer)
-	}
+	bc.anunciar(ItemInventario{Tipo: invBloco, Hash: bloco.HashAtual})
 }
 
+// ProximoIDEvento estima o ID que o próximo evento criado vai receber,
+// contando também as criações ainda no mempool.
 func (bc *Blockchain) ProximoIDEvento() int {
 	bc.mu.Lock()
-	defer bc.mu.Unlock()
-	maxID := 0
-	for _, bloco := range bc.Blocos {
-		if bloco.Evento == "criar_evento" {
-			var evento Evento
-			err := json.Unmarshal([]byte(bloco.Resultado), &evento)
-			if err != nil {
-				continue
-			}
-			if evento.ID > maxID {
-				maxID = evento.ID
-			}
+	total := len(bc.estado.Eventos)
+	bc.mu.Unlock()
+	for _, tx := range bc.mempool.Pendentes() {
+		if tx.Tipo == "criar_evento" {
+			total++
 		}
 	}
-	return maxID + 1
+	return total + 1
+}
+
+// decodificarTransacao valida uma transação assinada enviada por um cliente:
+// tipo esperado, assinatura, autorização e nonce. Os dados da transação são
+// decodificados em dados.
+func (bc *Blockchain) decodificarTransacao(tx Transacao, tipo string, dados interface{}) error {
+	if tx.Tipo != tipo {
+		return fmt.Errorf("transação do tipo %q enviada para %q", tx.Tipo, tipo)
+	}
+	if err := validarTransacaoAssinada(tx); err != nil {
+		return err
+	}
+	if tx.ChainID != bc.genesis.ChainID {
+		return fmt.Errorf("assinada para a rede %q, esta é %q", tx.ChainID, bc.genesis.ChainID)
+	}
+	if err := json.Unmarshal([]byte(tx.Dados), dados); err != nil {
+		return fmt.Errorf("dados da transação inválidos")
+	}
+	bc.mu.Lock()
+	proximo := bc.ProximoNonce(remetente(tx))
+	bc.mu.Unlock()
+	if tx.Nonce != proximo {
+		return fmt.Errorf("nonce %d inválido, esperado %d", tx.Nonce, proximo)
+	}
+	return nil
 }
 
 func (bc *Blockchain) HandleSaldo(w http.ResponseWriter, r *http.Request) {
@@ -342,7 +419,7 @@ func (bc *Blockchain) HandleSaldo(w http.ResponseWriter, r *http.Request) {
 	saldo := bc.CalcularSaldo(usuario)
 	type SaldoResponse struct {
 		Usuario string  `json:"usuario"`
-		Saldo   float64 `json:"saldo"`
+		Saldo   Quantia `json:"saldo"`
 	}
 	response := SaldoResponse{
 		Usuario: usuario,
@@ -352,26 +429,10 @@ func (bc *Blockchain) HandleSaldo(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(response)
 }
 
-func (bc *Blockchain) CalcularSaldo(usuario string) float64 {
+func (bc *Blockchain) CalcularSaldo(usuario string) Quantia {
 	bc.mu.Lock()
 	defer bc.mu.Unlock()
-	saldo := 0.0
-	for _, bloco := range bc.Blocos {
-		if bloco.Evento == "ajustar_saldo" {
-			var ajuste map[string]interface{}
-			err := json.Unmarshal([]byte(bloco.Resultado), &ajuste)
-			if err != nil {
-				continue
-			}
-			if ajuste["usuario"] == usuario {
-				valor, ok := ajuste["valor"].(float64)
-				if ok {
-					saldo += valor
-				}
-			}
-		}
-	}
-	return saldo
+	return bc.estado.Saldos[usuario]
 }
 
 func (bc *Blockchain) HandleCriarEvento(w http.ResponseWriter, r *http.Request) {
@@ -385,26 +446,44 @@ func (bc *Blockchain) HandleCriarEvento(w http.ResponseWriter, r *http.Request)
 		http.Error(w, "Método não permitido", http.StatusMethodNotAllowed)
 		return
 	}
-	type CriarEventoRequest struct {
-		Nome   string   `json:"nome"`
-		Opcoes []string `json:"opcoes"`
-	}
-	var req CriarEventoRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+	var tx Transacao
+	if err := json.NewDecoder(r.Body).Decode(&tx); err != nil {
 		http.Error(w, "Dados inválidos", http.StatusBadRequest)
 		return
 	}
-	if req.Nome == "" || len(req.Opcoes) < 2 {
-		http.Error(w, "Nome do evento e pelo menos duas opções são obrigatórios", http.StatusBadRequest)
+	var evento Evento
+	if err := bc.decodificarTransacao(tx, "criar_evento", &evento); err != nil {
+		http.Error(w, fmt.Sprintf("Transação inválida: %v", err), http.StatusBadRequest)
 		return
 	}
-	evento := Evento{
-		ID:     bc.ProximoIDEvento(),
-		Nome:   req.Nome,
-		Opcoes: req.Opcoes,
-		Votos:  make(map[string][]Aposta),
+	bc.mu.Lock()
+	opcoesMinimas := bc.estado.Parametros.OpcoesMinimas
+	bc.mu.Unlock()
+	if evento.Nome == "" || len(evento.Opcoes) < opcoesMinimas {
+		http.Error(w, fmt.Sprintf("Nome do evento e pelo menos %d opções são obrigatórios", opcoesMinimas), http.StatusBadRequest)
+		return
 	}
-	bc.AdicionarBloco("criar_evento", evento)
+	if evento.FechaApostas != "" {
+		prazo, err := time.Parse(time.RFC3339, evento.FechaApostas)
+		if err != nil || !prazo.After(time.Now()) {
+			http.Error(w, "Prazo das apostas deve ser uma data futura em RFC 3339", http.StatusBadRequest)
+			return
+		}
+	}
+	if evento.Resolvedores != nil {
+		bc.mu.Lock()
+		err := bc.estado.validarResolvedores(evento.Resolvedores)
+		bc.mu.Unlock()
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Resolvedores inválidos: %v", err), http.StatusBadRequest)
+			return
+		}
+	}
+	evento.ID = bc.ProximoIDEvento()
+	evento.Situacao = SituacaoAberto
+	evento.Criador = remetente(tx)
+	evento.Votos = make(map[string][]Aposta)
+	bc.SubmeterTransacoes(tx)
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(evento)
 }
@@ -418,39 +497,15 @@ func (bc *Blockchain) HandleListarEventos(w http.ResponseWriter, r *http.Request
 	}
 	bc.mu.Lock()
 	defer bc.mu.Unlock()
-	eventosMap := make(map[int]*Evento)
-	for _, bloco := range bc.Blocos {
-		if bloco.Evento == "criar_evento" {
-			var evento Evento
-			err := json.Unmarshal([]byte(bloco.Resultado), &evento)
-			if err != nil {
-				continue
-			}
-			eventosMap[evento.ID] = &evento
-		} else if bloco.Evento == "apostar" {
-			var aposta Aposta
-			err := json.Unmarshal([]byte(bloco.Resultado), &aposta)
-			if err != nil {
-				continue
-			}
-			if evento, existe := eventosMap[aposta.EventoID]; existe {
-				evento.Votos[aposta.Opcao] = append(evento.Votos[aposta.Opcao], aposta)
-			}
-		} else if bloco.Evento == "concluir_evento" {
-			var resultado map[string]interface{}
-			err := json.Unmarshal([]byte(bloco.Resultado), &resultado)
-			if err == nil {
-				eventoID, _ := resultado["evento_id"].(float64)
-				opcaoVencedora, _ := resultado["opcao_vencedora"].(string)
-				if ev, existe := eventosMap[int(eventoID)]; existe {
-					ev.Resultado = opcaoVencedora
-				}
-			}
-		}
-	}
 	eventos := []Evento{}
-	for _, evento := range eventosMap {
-		eventos = append(eventos, *evento)
+	for id := 1; id <= len(bc.estado.Eventos); id++ {
+		evento := *bc.estado.Eventos[id]
+		// Votação em andamento: mostra a contagem parcial
+		if resolvidoPorVotacao(&evento) && evento.Apuracao == nil {
+			parcial := bc.estado.apurar(&evento)
+			evento.Apuracao = &parcial
+		}
+		eventos = append(eventos, evento)
 	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(eventos)
@@ -467,56 +522,102 @@ func (bc *Blockchain) HandleVotar(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Método não permitido", http.StatusMethodNotAllowed)
 		return
 	}
-	type VotarRequest struct {
-		Usuario  string `json:"usuario"`
-		EventoID int    `json:"evento_id"`
-		Opcao    string `json:"opcao"`
-	}
-	var req VotarRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+	var tx Transacao
+	if err := json.NewDecoder(r.Body).Decode(&tx); err != nil {
 		http.Error(w, "Dados inválidos", http.StatusBadRequest)
 		return
 	}
-	if req.Usuario == "" || req.EventoID == 0 || req.Opcao == "" {
+	var voto Voto
+	if err := bc.decodificarTransacao(tx, "votar", &voto); err != nil {
+		http.Error(w, fmt.Sprintf("Transação inválida: %v", err), http.StatusBadRequest)
+		return
+	}
+	if voto.PropostaID != 0 {
+		bc.mu.Lock()
+		proposta, existe := bc.estado.Propostas[voto.PropostaID]
+		aberta := existe && proposta.Situacao == PropostaEmVotacao && bc.estado.Altura() < proposta.FimVotacao
+		saldo := bc.estado.Saldos[remetente(tx)]
+		bc.mu.Unlock()
+		if !existe || (voto.Opcao != VotoSim && voto.Opcao != VotoNao) {
+			http.Error(w, "Proposta ou voto inválidos", http.StatusBadRequest)
+			return
+		}
+		if !aberta {
+			http.Error(w, "Votação fechada para esta proposta", http.StatusBadRequest)
+			return
+		}
+		if saldo <= 0 {
+			http.Error(w, "Só contas com saldo votam em propostas", http.StatusBadRequest)
+			return
+		}
+		bc.SubmeterTransacoes(tx)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(voto)
+		return
+	}
+	if voto.Usuario == "" || voto.EventoID == 0 || voto.Opcao == "" {
 		http.Error(w, "Todos os campos são obrigatórios", http.StatusBadRequest)
 		return
 	}
-	eventoValido := bc.VerificarOpcaoEvento(req.EventoID, req.Opcao)
+	eventoValido := bc.VerificarOpcaoEvento(voto.EventoID, voto.Opcao)
 	if !eventoValido {
 		http.Error(w, "Evento ou opção inválidos", http.StatusBadRequest)
 		return
 	}
-	voto := Voto{
-		Usuario:  req.Usuario,
-		EventoID: req.EventoID,
-		Opcao:    req.Opcao,
+	if !bc.AceitaVotos(voto.EventoID) {
+		http.Error(w, "Votação fechada para este evento", http.StatusBadRequest)
+		return
 	}
-	bc.AdicionarBloco("votar", voto)
+	bc.SubmeterTransacoes(tx)
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(voto)
 }
 
+// AceitaVotos diz se um voto no evento seria aceito agora. Eventos resolvidos
+// por votação só recebem votos entre o prazo das apostas e o fim da janela;
+// eventos em disputa, até o fim da apelação; os demais, até o prazo das
+// apostas.
+func (bc *Blockchain) AceitaVotos(eventoID int) bool {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	evento, existe := bc.estado.Eventos[eventoID]
+	if existe && evento.Situacao == SituacaoDisputado {
+		return time.Now().Before(fimApelacao(evento))
+	}
+	if !existe || (evento.Situacao != SituacaoAberto && evento.Situacao != SituacaoTravado) {
+		return false
+	}
+	agora := time.Now()
+	if resolvidoPorVotacao(evento) {
+		return prazoEncerrado(evento, agora) && agora.Before(fimVotacao(evento))
+	}
+	return evento.Situacao == SituacaoAberto && !prazoEncerrado(evento, agora)
+}
+
 func (bc *Blockchain) VerificarOpcaoEvento(eventoID int, opcao string) bool {
-	for _, bloco := range bc.Blocos {
-		if bloco.Evento == "criar_evento" {
-			var evento Evento
-			err := json.Unmarshal([]byte(bloco.Resultado), &evento)
-			if err != nil {
-				continue
-			}
-			if evento.ID == eventoID {
-				for _, op := range evento.Opcoes {
-					if op == opcao {
-						return true
-					}
-				}
-				return false
-			}
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	evento, existe := bc.estado.Eventos[eventoID]
+	if !existe {
+		return false
+	}
+	for _, op := range evento.Opcoes {
+		if op == opcao {
+			return true
 		}
 	}
 	return false
 }
 
+// AceitaApostas diz se o evento está aberto e o prazo das apostas ainda não
+// passou.
+func (bc *Blockchain) AceitaApostas(eventoID int) bool {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	evento, existe := bc.estado.Eventos[eventoID]
+	return existe && evento.Situacao == SituacaoAberto && !prazoEncerrado(evento, time.Now())
+}
+
 func (bc *Blockchain) HandleApostar(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
@@ -528,45 +629,46 @@ func (bc *Blockchain) HandleApostar(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Método não permitido", http.StatusMethodNotAllowed)
 		return
 	}
-	type ApostarRequest struct {
-		Usuario  string  `json:"usuario"`
-		EventoID int     `json:"evento_id"`
-		Opcao    string  `json:"opcao"`
-		Valor    float64 `json:"valor"`
-	}
-	var req ApostarRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+	// A própria transação de aposta debita o valor apostado; o saldo é
+	// conferido de novo quando o bloco é validado.
+	var tx Transacao
+	if err := json.NewDecoder(r.Body).Decode(&tx); err != nil {
 		http.Error(w, "Dados inválidos", http.StatusBadRequest)
 		return
 	}
-	if req.Usuario == "" || req.EventoID == 0 || req.Opcao == "" || req.Valor <= 0 {
+	var aposta Aposta
+	if err := bc.decodificarTransacao(tx, "apostar", &aposta); err != nil {
+		http.Error(w, fmt.Sprintf("Transação inválida: %v", err), http.StatusBadRequest)
+		return
+	}
+	if aposta.Usuario == "" || aposta.EventoID == 0 || aposta.Opcao == "" || aposta.Valor <= 0 {
 		http.Error(w, "Todos os campos são obrigatórios e o valor deve ser positivo", http.StatusBadRequest)
 		return
 	}
-	saldo := bc.CalcularSaldo(req.Usuario)
-	if saldo < req.Valor {
+	bc.mu.Lock()
+	minima, maxima := bc.estado.Parametros.ApostaMinima, bc.estado.Parametros.ApostaMaxima
+	bc.mu.Unlock()
+	if aposta.Valor < minima || (maxima > 0 && aposta.Valor > maxima) {
+		http.Error(w, fmt.Sprintf("Valor fora dos limites de aposta (mínimo %s, máximo %s)", minima, maxima), http.StatusBadRequest)
+		return
+	}
+	saldo := bc.CalcularSaldo(aposta.Usuario)
+	if saldo < aposta.Valor {
 		http.Error(w, "Saldo insuficiente", http.StatusBadRequest)
 		return
 	}
-	eventoValido := bc.VerificarOpcaoEvento(req.EventoID, req.Opcao)
+	eventoValido := bc.VerificarOpcaoEvento(aposta.EventoID, aposta.Opcao)
 	if !eventoValido {
 		http.Error(w, "Evento ou opção inválidos", http.StatusBadRequest)
 		return
 	}
-	aposta := Aposta{
-		Usuario:  req.Usuario,
-		Valor:    req.Valor,
-		EventoID: req.EventoID,
-		Opcao:    req.Opcao,
-	}
-	blocoAposta := bc.AdicionarBloco("apostar", aposta)
-	ajuste := map[string]interface{}{
-		"usuario": req.Usuario,
-		"valor":   -req.Valor,
+	if !bc.AceitaApostas(aposta.EventoID) {
+		http.Error(w, "Apostas encerradas para este evento", http.StatusBadRequest)
+		return
 	}
-	bc.AdicionarBloco("ajustar_saldo", ajuste)
+	bc.SubmeterTransacoes(tx)
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(blocoAposta)
+	json.NewEncoder(w).Encode(tx)
 }
 
 func (bc *Blockchain) HandleSacar(w http.ResponseWriter, r *http.Request) {
@@ -580,31 +682,31 @@ func (bc *Blockchain) HandleSacar(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Método não permitido", http.StatusMethodNotAllowed)
 		return
 	}
-	type SacarRequest struct {
+	var tx Transacao
+	if err := json.NewDecoder(r.Body).Decode(&tx); err != nil {
+		http.Error(w, "Dados inválidos", http.StatusBadRequest)
+		return
+	}
+	var ajuste struct {
 		Usuario string  `json:"usuario"`
-		Valor   float64 `json:"valor"`
+		Valor   Quantia `json:"valor"`
 	}
-	var req SacarRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Dados inválidos", http.StatusBadRequest)
+	if err := bc.decodificarTransacao(tx, "ajustar_saldo", &ajuste); err != nil {
+		http.Error(w, fmt.Sprintf("Transação inválida: %v", err), http.StatusBadRequest)
 		return
 	}
-	if req.Usuario == "" || req.Valor <= 0 {
-		http.Error(w, "Todos os campos são obrigatórios e o valor deve ser positivo", http.StatusBadRequest)
+	if ajuste.Usuario == "" || ajuste.Valor >= 0 {
+		http.Error(w, "Todos os campos são obrigatórios e o valor do saque deve ser negativo", http.StatusBadRequest)
 		return
 	}
-	saldo := bc.CalcularSaldo(req.Usuario)
-	if saldo < req.Valor {
+	saldo := bc.CalcularSaldo(ajuste.Usuario)
+	if saldo < -ajuste.Valor {
 		http.Error(w, "Saldo insuficiente para saque", http.StatusBadRequest)
 		return
 	}
-	ajuste := map[string]interface{}{
-		"usuario": req.Usuario,
-		"valor":   -req.Valor,
-	}
-	blocoAjuste := bc.AdicionarBloco("ajustar_saldo", ajuste)
+	bc.SubmeterTransacoes(tx)
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(blocoAjuste)
+	json.NewEncoder(w).Encode(tx)
 }
 
 func (bc *Blockchain) HandleDepositar(w http.ResponseWriter, r *http.Request) {
@@ -618,26 +720,33 @@ func (bc *Blockchain) HandleDepositar(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Método não permitido", http.StatusMethodNotAllowed)
 		return
 	}
-	type DepositarRequest struct {
+	var tx Transacao
+	if err := json.NewDecoder(r.Body).Decode(&tx); err != nil {
+		http.Error(w, "Dados inválidos", http.StatusBadRequest)
+		return
+	}
+	var ajuste struct {
 		Usuario string  `json:"usuario"`
-		Valor   float64 `json:"valor"`
+		Valor   Quantia `json:"valor"`
 	}
-	var req DepositarRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Dados inválidos", http.StatusBadRequest)
+	if err := bc.decodificarTransacao(tx, "ajustar_saldo", &ajuste); err != nil {
+		http.Error(w, fmt.Sprintf("Transação inválida: %v", err), http.StatusBadRequest)
 		return
 	}
-	if req.Usuario == "" || req.Valor <= 0 {
+	if ajuste.Usuario == "" || ajuste.Valor <= 0 {
 		http.Error(w, "Todos os campos são obrigatórios e o valor deve ser positivo", http.StatusBadRequest)
 		return
 	}
-	ajuste := map[string]interface{}{
-		"usuario": req.Usuario,
-		"valor":   req.Valor,
+	bc.mu.Lock()
+	emissor := bc.estado.podeCreditar(remetente(tx))
+	bc.mu.Unlock()
+	if !emissor {
+		http.Error(w, "Só os emissores da rede podem depositar", http.StatusForbidden)
+		return
 	}
-	blocoAjuste := bc.AdicionarBloco("ajustar_saldo", ajuste)
+	bc.SubmeterTransacoes(tx)
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(blocoAjuste)
+	json.NewEncoder(w).Encode(tx)
 }
 
 func (bc *Blockchain) HandleConcluirEvento(w http.ResponseWriter, r *http.Request) {
@@ -653,15 +762,20 @@ func (bc *Blockchain) HandleConcluirEvento(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	type ConcluirEventoRequest struct {
+	var tx Transacao
+	if err := json.NewDecoder(r.Body).Decode(&tx); err != nil {
+		log.Printf("Erro ao decodificar request: %v", err)
+		http.Error(w, "Dados inválidos", http.StatusBadRequest)
+		return
+	}
+
+	var req struct {
 		EventoID       int    `json:"evento_id"`
 		OpcaoVencedora string `json:"opcao_vencedora"`
 	}
-
-	var req ConcluirEventoRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		log.Printf("Erro ao decodificar request: %v", err)
-		http.Error(w, "Dados inválidos", http.StatusBadRequest)
+	if err := bc.decodificarTransacao(tx, "concluir_evento", &req); err != nil {
+		log.Printf("Transação de conclusão inválida: %v", err)
+		http.Error(w, fmt.Sprintf("Transação inválida: %v", err), http.StatusBadRequest)
 		return
 	}
 
@@ -673,36 +787,36 @@ func (bc *Blockchain) HandleConcluirEvento(w http.ResponseWriter, r *http.Reques
 
 	bc.mu.Lock()
 	log.Printf("Mutex bloqueado para leitura dos eventos")
-	eventosMap := make(map[int]*Evento)
-	for _, bloco := range bc.Blocos {
-		if bloco.Evento == "criar_evento" {
-			var evento Evento
-			err := json.Unmarshal([]byte(bloco.Resultado), &evento)
-			if err != nil {
-				log.Printf("Erro ao deserializar criar_evento: %v", err)
-				continue
-			}
-			eventosMap[evento.ID] = &evento
-		} else if bloco.Evento == "apostar" {
-			var aposta Aposta
-			err := json.Unmarshal([]byte(bloco.Resultado), &aposta)
-			if err != nil {
-				log.Printf("Erro ao deserializar apostar: %v", err)
-				continue
-			}
-			if evento, existe := eventosMap[aposta.EventoID]; existe {
-				evento.Votos[aposta.Opcao] = append(evento.Votos[aposta.Opcao], aposta)
-			}
-		}
-	}
-
-	evento, existe := eventosMap[req.EventoID]
+	evento, existe := bc.estado.Evento(req.EventoID)
 	if !existe {
 		bc.mu.Unlock()
 		log.Printf("Evento %d não encontrado", req.EventoID)
 		http.Error(w, "Evento não encontrado", http.StatusBadRequest)
 		return
 	}
+	if evento.Situacao != SituacaoTravado && (evento.Situacao != SituacaoAberto || evento.FechaApostas != "") {
+		bc.mu.Unlock()
+		http.Error(w, fmt.Sprintf("Evento está %s e não pode ser concluído", evento.Situacao), http.StatusBadRequest)
+		return
+	}
+	if resolvidoPorVotacao(&evento) {
+		bc.mu.Unlock()
+		http.Error(w, "Evento é resolvido pela votação da comunidade", http.StatusForbidden)
+		return
+	}
+	if !bc.estado.PodeResolver(&evento, remetente(tx)) {
+		bc.mu.Unlock()
+		http.Error(w, "Conta não autorizada a resolver este evento", http.StatusForbidden)
+		return
+	}
+	// Num multisig a caução só é cobrada de quem completa o mínimo
+	caucao := bc.estado.Parametros.CaucaoResolucao
+	multisig := evento.Resolvedores != nil && evento.Resolvedores.Tipo == ResolucaoMultisig
+	if !multisig && bc.estado.Saldos[remetente(tx)] < caucao {
+		bc.mu.Unlock()
+		http.Error(w, fmt.Sprintf("Saldo insuficiente para a caução de resolução de %s", caucao), http.StatusBadRequest)
+		return
+	}
 
 	opcaoValida := false
 	for _, op := range evento.Opcoes {
@@ -719,59 +833,132 @@ func (bc *Blockchain) HandleConcluirEvento(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	totalVencedor := 0.0
-	totalPerdedor := 0.0
-	for opcao, apostas := range evento.Votos {
-		for _, aposta := range apostas {
-			if opcao == req.OpcaoVencedora {
-				totalVencedor += aposta.Valor
-			} else {
-				totalPerdedor += aposta.Valor
-			}
-		}
-	}
+	bc.mu.Unlock()
 
-	log.Printf("Evento %d: totalVencedor=%.2f totalPerdedor=%.2f", req.EventoID, totalVencedor, totalPerdedor)
+	// Cada nó calcula os prêmios ao aplicar a conclusão e os credita quando o
+	// período de contestação termina
+	bc.SubmeterTransacoes(tx)
 
+	if multisig {
+		w.Write([]byte("Aprovação registrada; o evento é liquidado quando o mínimo de resolvedores concordar."))
+		return
+	}
+	w.Write([]byte("Evento concluído; os prêmios são liberados ao fim do período de contestação."))
+	log.Printf("Conclusão do evento %d finalizada", req.EventoID)
+}
+
+func (bc *Blockchain) HandleCancelarEvento(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	if r.Method == "OPTIONS" {
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Método não permitido", http.StatusMethodNotAllowed)
+		return
+	}
+	var tx Transacao
+	if err := json.NewDecoder(r.Body).Decode(&tx); err != nil {
+		http.Error(w, "Dados inválidos", http.StatusBadRequest)
+		return
+	}
+	var req struct {
+		EventoID int `json:"evento_id"`
+	}
+	if err := bc.decodificarTransacao(tx, "cancelar_evento", &req); err != nil {
+		http.Error(w, fmt.Sprintf("Transação inválida: %v", err), http.StatusBadRequest)
+		return
+	}
+	bc.mu.Lock()
+	evento, existe := bc.estado.Evento(req.EventoID)
+	autorizado := existe && bc.estado.PodeResolver(&evento, remetente(tx))
 	bc.mu.Unlock()
-	log.Printf("Mutex liberado antes de ajustar saldos")
-
-	var premioPorAposta float64
-	if totalVencedor > 0 {
-		premioPorAposta = totalPerdedor / totalVencedor
-		log.Printf("Evento %d: premioPorAposta=%.2f", req.EventoID, premioPorAposta)
-		for opcao, apostas := range evento.Votos {
-			if opcao != req.OpcaoVencedora {
-				continue
-			}
-			for _, aposta := range apostas {
-				ajuste := map[string]interface{}{
-					"usuario": aposta.Usuario,
-					"valor":   aposta.Valor * premioPorAposta,
-				}
-				log.Printf("Ajustando saldo para %s valor=%.2f", aposta.Usuario, aposta.Valor*premioPorAposta)
-				bc.AdicionarBloco("ajustar_saldo", ajuste)
-			}
-		}
-	} else {
-		log.Printf("Nenhum vencedor no evento %d", req.EventoID)
+	if !existe {
+		http.Error(w, "Evento não encontrado", http.StatusBadRequest)
+		return
+	}
+	if evento.Situacao != SituacaoAberto && evento.Situacao != SituacaoTravado {
+		http.Error(w, fmt.Sprintf("Evento está %s e não pode ser cancelado", evento.Situacao), http.StatusBadRequest)
+		return
 	}
+	if !autorizado {
+		http.Error(w, "Conta não autorizada a cancelar este evento", http.StatusForbidden)
+		return
+	}
+	// Cada nó devolve as apostas ao aplicar o cancelamento
+	bc.SubmeterTransacoes(tx)
+	w.Write([]byte("Evento cancelado e apostas devolvidas."))
+}
 
-	resultado := map[string]interface{}{
-		"evento_id":       req.EventoID,
-		"opcao_vencedora": req.OpcaoVencedora,
+func (bc *Blockchain) HandleContestarEvento(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	if r.Method == "OPTIONS" {
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Método não permitido", http.StatusMethodNotAllowed)
+		return
+	}
+	var tx Transacao
+	if err := json.NewDecoder(r.Body).Decode(&tx); err != nil {
+		http.Error(w, "Dados inválidos", http.StatusBadRequest)
+		return
+	}
+	var req struct {
+		EventoID int    `json:"evento_id"`
+		Opcao    string `json:"opcao"`
+	}
+	if err := bc.decodificarTransacao(tx, "contestar_evento", &req); err != nil {
+		http.Error(w, fmt.Sprintf("Transação inválida: %v", err), http.StatusBadRequest)
+		return
+	}
+	if !bc.VerificarOpcaoEvento(req.EventoID, req.Opcao) {
+		http.Error(w, "Evento ou opção inválidos", http.StatusBadRequest)
+		return
+	}
+	bc.mu.Lock()
+	evento, _ := bc.estado.Evento(req.EventoID)
+	caucao := bc.estado.Parametros.CaucaoContestacao
+	saldo := bc.estado.Saldos[remetente(tx)]
+	bc.mu.Unlock()
+	if !ContestacaoAberta(&evento, time.Now()) {
+		http.Error(w, "Resultado deste evento não pode mais ser contestado", http.StatusBadRequest)
+		return
+	}
+	if req.Opcao == evento.Resultado {
+		http.Error(w, "A contestação deve indicar outra opção", http.StatusBadRequest)
+		return
+	}
+	if saldo < caucao {
+		http.Error(w, fmt.Sprintf("Saldo insuficiente para a caução de %s", caucao), http.StatusBadRequest)
+		return
 	}
-	log.Printf("Adicionando bloco concluir_evento para evento %d", req.EventoID)
-	bc.AdicionarBloco("concluir_evento", resultado)
+	// A caução é debitada quando a contestação é confirmada num bloco
+	bc.SubmeterTransacoes(tx)
+	w.Write([]byte(fmt.Sprintf("Contestação enviada com caução de %s. Prêmios congelados até o fim da apelação.", caucao)))
+}
 
-	w.Write([]byte("Evento concluído e prêmios distribuídos com sucesso."))
-	log.Printf("Conclusão do evento %d finalizada", req.EventoID)
+func (bc *Blockchain) HandleGenesis(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	if r.Method == "OPTIONS" {
+		return
+	}
+	type GenesisResponse struct {
+		Especificacao EspecificacaoGenesis `json:"especificacao"`
+		Hash          string               `json:"hash"`
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(GenesisResponse{Especificacao: bc.genesis, Hash: bc.hashGenesis})
 }
 
 func (bc *Blockchain) InicializarEndpoints() {
 	http.HandleFunc("/", ServirIndex)
 	http.HandleFunc("/blockchain", bc.ExibirBlockchainHTTP)
-	http.HandleFunc("/adicionar", bc.HandleAdicionarBloco)
 	http.HandleFunc("/validar", bc.HandleValidarBlockchain)
 	http.HandleFunc("/receber-blockchain", bc.ReceberBlockchain)
 	http.HandleFunc("/receber-bloco", bc.ReceberBloco)
@@ -781,6 +968,32 @@ func (bc *Blockchain) InicializarEndpoints() {
 	http.HandleFunc("/votar", bc.HandleVotar)
 	http.HandleFunc("/apostar", bc.HandleApostar)
 	http.HandleFunc("/concluir-evento", bc.HandleConcluirEvento)
+	http.HandleFunc("/cancelar-evento", bc.HandleCancelarEvento)
+	http.HandleFunc("/contestar-evento", bc.HandleContestarEvento)
+	http.HandleFunc("/parametros", bc.HandleParametros)
+	http.HandleFunc("/propostas", bc.HandlePropostas)
+	http.HandleFunc("/propor-parametros", bc.HandlePropor)
+	http.HandleFunc("/delegar", bc.HandleDelegar)
+	http.HandleFunc("/delegacoes", bc.HandleDelegacoes)
 	http.HandleFunc("/depositar", bc.HandleDepositar)
 	http.HandleFunc("/sacar", bc.HandleSacar)
+	http.HandleFunc("/genesis", bc.HandleGenesis)
+	http.HandleFunc("/reorgs", bc.HandleReorgs)
+	http.HandleFunc("/receber-transacao", bc.ReceberTransacao)
+	http.HandleFunc("/mempool", bc.HandleMempool)
+	http.HandleFunc("/prova-merkle", bc.HandleProvaMerkle)
+	http.HandleFunc("/conta", bc.HandleConta)
+	http.HandleFunc("/verificar-estado", bc.HandleVerificarEstado)
+	http.HandleFunc("/handshake", bc.HandleHandshake)
+	http.HandleFunc("/peers", bc.HandlePeers)
+	http.HandleFunc("/ponta", bc.HandlePonta)
+	http.HandleFunc("/cabecalhos", bc.HandleCabecalhos)
+	http.HandleFunc("/blocos", bc.HandleBlocosPorHash)
+	http.HandleFunc("/sincronizacao", bc.HandleSincronizacao)
+	http.HandleFunc("/orfaos", bc.HandleOrfaos)
+	http.HandleFunc("/p2p", bc.HandleP2P)
+	http.HandleFunc("/admin/sessoes", bc.HandleAdminSessoes)
+	http.HandleFunc("/admin/peers", bc.HandleAdminPeers)
+	http.HandleFunc("/admin/adicionar-peer", bc.HandleAdicionarPeer)
+	http.HandleFunc("/admin/remover-peer", bc.HandleRemoverPeer)
 }
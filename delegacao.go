@@ -0,0 +1,247 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// Delegacao transfere o poder de voto de uma conta nos eventos resolvidos por
+// votação. Sem categoria, vale para todos os eventos; com categoria, só para
+// os eventos dela e tem prioridade sobre a delegação global. Para vazio
+// revoga a delegação da categoria.
+//
+// A delegação é transitiva: se A delega para B e B para C, o peso de A segue
+// até o primeiro da cadeia que votou. Quem vota diretamente nunca é
+// representado, mesmo tendo delegado. Delegações que fechariam um ciclo são
+// recusadas.
+type Delegacao struct {
+	Para      string `json:"para"`
+	Categoria string `json:"categoria,omitempty"`
+}
+
+// delegacaoAnterior guarda a delegação de uma conta numa categoria como
+// estava antes de uma transação.
+type delegacaoAnterior struct {
+	conta     string
+	categoria string
+	delegado  string
+	existia   bool
+}
+
+func normalizarCategoria(categoria string) string {
+	return strings.ToLower(strings.TrimSpace(categoria))
+}
+
+// delegadoDe devolve para quem a conta delega o voto nos eventos da
+// categoria, ou vazio.
+func (e *EstadoMundo) delegadoDe(conta, categoria string) string {
+	delegacoes := e.Delegacoes[conta]
+	if delegado, existe := delegacoes[categoria]; existe {
+		return delegado
+	}
+	return delegacoes[""]
+}
+
+// cadeiaDelegacao devolve, em ordem, as contas para as quais o voto da conta
+// é delegado na categoria. Para antes de repetir uma conta, por segurança: o
+// estado não deveria ter ciclos.
+func (e *EstadoMundo) cadeiaDelegacao(conta, categoria string) []string {
+	vistas := map[string]bool{conta: true}
+	var cadeia []string
+	for atual := e.delegadoDe(conta, categoria); atual != "" && !vistas[atual]; atual = e.delegadoDe(atual, categoria) {
+		vistas[atual] = true
+		cadeia = append(cadeia, atual)
+	}
+	return cadeia
+}
+
+// validarDelegacao confere a delegação contra o estado, sem alterá-lo.
+func (e *EstadoMundo) validarDelegacao(conta string, delegacao Delegacao) *ErroValidacao {
+	if conta == "" {
+		return rejeitar(MotivoNaoAutorizado, "delegação precisa ser assinada")
+	}
+	categoria := normalizarCategoria(delegacao.Categoria)
+	if delegacao.Para == "" {
+		if _, existe := e.Delegacoes[conta][categoria]; !existe {
+			return rejeitar(MotivoDelegacaoInvalida, "conta %s não delega a categoria %q", conta, categoria)
+		}
+		return nil
+	}
+	if !enderecoValido(delegacao.Para) || delegacao.Para == conta {
+		return rejeitar(MotivoDelegacaoInvalida, "delegado %q inválido", delegacao.Para)
+	}
+	return e.verificarCiclo(conta, categoria, delegacao.Para)
+}
+
+// delegar registra, troca ou revoga a delegação da conta.
+func (e *EstadoMundo) delegar(conta string, delegacao Delegacao, alteracoes *alteracoesBloco) *ErroValidacao {
+	if err := e.validarDelegacao(conta, delegacao); err != nil {
+		return err
+	}
+	categoria := normalizarCategoria(delegacao.Categoria)
+	atual, existia := e.Delegacoes[conta][categoria]
+	alteracoes.delegacoes = append(alteracoes.delegacoes, delegacaoAnterior{conta, categoria, atual, existia})
+	e.definirDelegacao(conta, categoria, delegacao.Para, delegacao.Para != "")
+	return nil
+}
+
+// verificarCiclo recusa a delegação se o voto do delegado já chega à conta em
+// alguma categoria afetada. Uma delegação global vale para todas as
+// categorias em que a conta não tem delegação própria; categorias sem
+// delegação própria em conta nenhuma seguem as globais, então basta conferir
+// a global e as que aparecem em alguma delegação.
+func (e *EstadoMundo) verificarCiclo(conta, categoria, para string) *ErroValidacao {
+	categorias := []string{categoria}
+	if categoria == "" {
+		for _, delegacoes := range e.Delegacoes {
+			for outra := range delegacoes {
+				if _, propria := e.Delegacoes[conta][outra]; outra != "" && !propria {
+					categorias = append(categorias, outra)
+				}
+			}
+		}
+	}
+	for _, c := range categorias {
+		for _, delegado := range e.cadeiaDelegacao(para, c) {
+			if delegado == conta {
+				return rejeitar(MotivoDelegacaoCircular, "%s já representa %s na categoria %q", para, conta, c)
+			}
+		}
+	}
+	return nil
+}
+
+// definirDelegacao grava ou apaga a delegação, sem deixar mapas vazios para
+// que o estado incremental e o reconstruído continuem iguais.
+func (e *EstadoMundo) definirDelegacao(conta, categoria, delegado string, existe bool) {
+	if !existe {
+		delete(e.Delegacoes[conta], categoria)
+		if len(e.Delegacoes[conta]) == 0 {
+			delete(e.Delegacoes, conta)
+		}
+		return
+	}
+	if e.Delegacoes[conta] == nil {
+		e.Delegacoes[conta] = make(map[string]string)
+	}
+	e.Delegacoes[conta][categoria] = delegado
+}
+
+// eleitores devolve as contas que podem pesar na votação do evento: quem votou
+// e, conforme o peso, quem apostou ou quem delegou o voto.
+func (e *EstadoMundo) eleitores(evento *Evento) map[string]bool {
+	contas := make(map[string]bool, len(evento.Votacao))
+	for votante := range evento.Votacao {
+		contas[votante] = true
+	}
+	if evento.Resolvedores.Peso == PesoAposta {
+		for _, apostas := range evento.Votos {
+			for _, aposta := range apostas {
+				contas[aposta.Usuario] = true
+			}
+		}
+		return contas
+	}
+	for conta := range e.Delegacoes {
+		contas[conta] = true
+	}
+	return contas
+}
+
+// representa diz se alguma conta com peso no evento delega, direta ou
+// transitivamente, o voto para a conta.
+func (e *EstadoMundo) representa(evento *Evento, conta string) bool {
+	for eleitor := range e.eleitores(evento) {
+		if eleitor == conta || pesoDoVoto(evento, eleitor) <= 0 {
+			continue
+		}
+		for _, delegado := range e.cadeiaDelegacao(eleitor, evento.Categoria) {
+			if delegado == conta {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (bc *Blockchain) HandleDelegar(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	if r.Method == "OPTIONS" {
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Método não permitido", http.StatusMethodNotAllowed)
+		return
+	}
+	var tx Transacao
+	if err := json.NewDecoder(r.Body).Decode(&tx); err != nil {
+		http.Error(w, "Dados inválidos", http.StatusBadRequest)
+		return
+	}
+	var delegacao Delegacao
+	if err := bc.decodificarTransacao(tx, "delegar", &delegacao); err != nil {
+		http.Error(w, fmt.Sprintf("Transação inválida: %v", err), http.StatusBadRequest)
+		return
+	}
+	// Confere contra o estado atual; o bloco confere de novo com a ordem final
+	bc.mu.Lock()
+	err := bc.estado.validarDelegacao(remetente(tx), delegacao)
+	bc.mu.Unlock()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Delegação recusada: %s", err.Detalhe), http.StatusBadRequest)
+		return
+	}
+	bc.SubmeterTransacoes(tx)
+	if delegacao.Para == "" {
+		w.Write([]byte("Revogação de delegação enviada."))
+		return
+	}
+	w.Write([]byte(fmt.Sprintf("Delegação para %s enviada.", delegacao.Para)))
+}
+
+// HandleDelegacoes mostra para quem a conta delega, por categoria, e quem
+// delega diretamente para ela.
+func (bc *Blockchain) HandleDelegacoes(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	if r.Method == "OPTIONS" {
+		return
+	}
+	conta := r.URL.Query().Get("conta")
+	if conta == "" {
+		http.Error(w, "Conta é obrigatória", http.StatusBadRequest)
+		return
+	}
+	type delegacaoRecebida struct {
+		Conta     string `json:"conta"`
+		Categoria string `json:"categoria,omitempty"`
+	}
+	resposta := struct {
+		Delegacoes map[string]string   `json:"delegacoes"`
+		Recebidas  []delegacaoRecebida `json:"recebidas"`
+	}{Delegacoes: make(map[string]string), Recebidas: []delegacaoRecebida{}}
+	bc.mu.Lock()
+	for categoria, delegado := range bc.estado.Delegacoes[conta] {
+		resposta.Delegacoes[categoria] = delegado
+	}
+	for delegador, delegacoes := range bc.estado.Delegacoes {
+		for categoria, delegado := range delegacoes {
+			if delegado == conta {
+				resposta.Recebidas = append(resposta.Recebidas, delegacaoRecebida{delegador, categoria})
+			}
+		}
+	}
+	bc.mu.Unlock()
+	sort.Slice(resposta.Recebidas, func(i, j int) bool {
+		a, b := resposta.Recebidas[i], resposta.Recebidas[j]
+		return a.Conta < b.Conta || (a.Conta == b.Conta && a.Categoria < b.Categoria)
+	})
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resposta)
+}
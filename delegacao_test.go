@@ -0,0 +1,137 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func delegacaoDe(t *testing.T, carteira *Carteira, nonce uint64, para *Carteira, categoria string) Transacao {
+	delegacao := Delegacao{Categoria: categoria}
+	if para != nil {
+		delegacao.Para = para.Endereco
+	}
+	return transacaoAssinada(t, carteira, nonce, "delegar", delegacao)
+}
+
+// Testa a apuração com delegação transitiva por categoria e o voto direto que substitui a delegação
+func TestDelegacaoTransitivaNaApuracao(t *testing.T) {
+	estado := NovoEstadoMundo()
+	ana, _ := NovaCarteira()
+	bia, _ := NovaCarteira()
+	caio, _ := NovaCarteira()
+	davi, _ := NovaCarteira()
+	inicio := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	prazo := inicio.Add(time.Hour)
+	votacao := &Resolvedores{Tipo: ResolucaoVotacao, Peso: PesoConta, JanelaVotacao: 600, Quorum: 3, Maioria: 60}
+	if err := estado.Aplicar(blocoEm(inicio,
+		transacaoAssinada(t, ana, 0, "criar_evento", Evento{Nome: "Final", Categoria: " Futebol ", Opcoes: []string{"X", "Y"}, FechaApostas: prazo.Format(time.RFC3339), Resolvedores: votacao}),
+		delegacaoDe(t, ana, 1, bia, ""),
+		delegacaoDe(t, bia, 0, davi, ""),
+		delegacaoDe(t, bia, 1, caio, "futebol"),
+		delegacaoDe(t, davi, 0, caio, ""),
+	)); err != nil {
+		t.Fatal(err)
+	}
+	if err := estado.Aplicar(blocoEm(prazo, transacaoAssinada(t, caio, 0, "votar", Voto{Usuario: caio.Endereco, EventoID: 1, Opcao: "X"}))); err != nil {
+		t.Fatal(err)
+	}
+	evento := estado.Eventos[1]
+	apuracao := estado.apurar(evento)
+	// A delegação de bia no futebol vale mais que a global para davi
+	if apuracao.Votantes != 4 || apuracao.Pesos["X"] != 4 {
+		t.Fatalf("Caio deveria representar as quatro contas, obtido %+v", apuracao)
+	}
+	if cadeia := apuracao.Detalhe[ana.Endereco].Cadeia; !reflect.DeepEqual(cadeia, []string{bia.Endereco, caio.Endereco}) {
+		t.Errorf("Voto de ana deveria passar por bia até caio, obtido %v", cadeia)
+	}
+
+	if err := estado.Aplicar(blocoEm(prazo, transacaoAssinada(t, ana, 2, "votar", Voto{Usuario: ana.Endereco, EventoID: 1, Opcao: "Y"}))); err != nil {
+		t.Fatal(err)
+	}
+	apuracao = estado.apurar(evento)
+	if apuracao.Pesos["X"] != 3 || apuracao.Pesos["Y"] != 1 || len(apuracao.Detalhe[ana.Endereco].Cadeia) != 0 {
+		t.Errorf("Voto direto de ana deveria substituir a delegação, obtido %+v", apuracao)
+	}
+
+	// 3 de 4 atinge os 60%: X vence no fim da janela
+	if err := estado.Aplicar(blocoEm(prazo.Add(10 * time.Minute))); err != nil {
+		t.Fatal(err)
+	}
+	if evento, _ := estado.Evento(1); evento.Resultado != "X" || evento.Apuracao.Detalhe[davi.Endereco].Opcao != "X" {
+		t.Errorf("Evento deveria ser resolvido com os votos delegados, obtido %+v", evento)
+	}
+}
+
+// Testa que delegações circulares, inválidas ou revogações sem delegação são recusadas e que Desfazer restaura as delegações
+func TestDelegacoesRecusadasEDesfeitas(t *testing.T) {
+	estado := NovoEstadoMundo()
+	ana, _ := NovaCarteira()
+	bia, _ := NovaCarteira()
+	caio, _ := NovaCarteira()
+	instante := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	if err := estado.Aplicar(blocoEm(instante,
+		delegacaoDe(t, ana, 0, bia, ""),
+		delegacaoDe(t, bia, 0, caio, "tenis"),
+	)); err != nil {
+		t.Fatal(err)
+	}
+	casos := []struct {
+		nome   string
+		tx     Transacao
+		motivo MotivoRejeicao
+	}{
+		{"ciclo direto", delegacaoDe(t, bia, 1, ana, ""), MotivoDelegacaoCircular},
+		{"ciclo numa categoria", delegacaoDe(t, caio, 0, ana, "tenis"), MotivoDelegacaoCircular},
+		{"ciclo global via categoria", delegacaoDe(t, caio, 0, ana, ""), MotivoDelegacaoCircular},
+		{"para si mesma", delegacaoDe(t, ana, 1, ana, ""), MotivoDelegacaoInvalida},
+		{"revogação inexistente", delegacaoDe(t, ana, 1, nil, "tenis"), MotivoDelegacaoInvalida},
+	}
+	for _, caso := range casos {
+		if err := estado.Aplicar(blocoEm(instante, caso.tx)); motivoDe(err) != caso.motivo {
+			t.Errorf("%s: esperado %q, obtido %v", caso.nome, caso.motivo, err)
+		}
+	}
+
+	// Na categoria de caio a ana já não chega a bia, então caio pode delegar a ela no futebol
+	if err := estado.Aplicar(blocoEm(instante, delegacaoDe(t, caio, 0, ana, "futebol"), delegacaoDe(t, ana, 1, nil, ""))); err != nil {
+		t.Fatal(err)
+	}
+	if _, existe := estado.Delegacoes[ana.Endereco]; existe || estado.delegadoDe(caio.Endereco, "futebol") != ana.Endereco {
+		t.Fatalf("Revogação deveria remover a delegação de ana, obtido %v", estado.Delegacoes)
+	}
+	estado.Desfazer()
+	if estado.delegadoDe(ana.Endereco, "qualquer") != bia.Endereco || len(estado.Delegacoes) != 2 || estado.delegadoDe(caio.Endereco, "futebol") != "" {
+		t.Errorf("Desfazer deveria restaurar as delegações, obtido %v", estado.Delegacoes)
+	}
+}
+
+// Testa que numa votação ponderada por aposta o delegado sem aposta vota com o peso de quem o representa
+func TestDelegadoSemApostaVota(t *testing.T) {
+	ana, _ := NovaCarteira()
+	bia, _ := NovaCarteira()
+	estado := estadoComSaldos(t, map[*Carteira]Quantia{ana: Reais(20)})
+	inicio := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	prazo := inicio.Add(time.Hour)
+	votacao := &Resolvedores{Tipo: ResolucaoVotacao, Peso: PesoAposta, JanelaVotacao: 600, Quorum: 1, Maioria: 60}
+	votoDeBia := transacaoAssinada(t, bia, 0, "votar", Voto{Usuario: bia.Endereco, EventoID: 1, Opcao: "X"})
+	if err := estado.Aplicar(blocoEm(inicio,
+		transacaoAssinada(t, ana, 0, "criar_evento", Evento{Nome: "Final", Opcoes: []string{"X", "Y"}, FechaApostas: prazo.Format(time.RFC3339), Resolvedores: votacao}),
+		transacaoAssinada(t, ana, 1, "apostar", Aposta{Usuario: ana.Endereco, Valor: Reais(20), EventoID: 1, Opcao: "Y"}),
+	)); err != nil {
+		t.Fatal(err)
+	}
+	if err := estado.Aplicar(blocoEm(prazo, votoDeBia)); motivoDe(err) != MotivoNaoAutorizado {
+		t.Fatalf("Conta sem aposta nem delegação não deveria votar, obtido %v", err)
+	}
+	if err := estado.Aplicar(blocoEm(prazo, delegacaoDe(t, ana, 2, bia, ""), votoDeBia)); err != nil {
+		t.Fatal(err)
+	}
+	apuracao := estado.apurar(estado.Eventos[1])
+	if apuracao.Pesos["X"] != int64(Reais(20)) || apuracao.Votantes != 1 {
+		t.Errorf("Bia deveria votar com o peso da aposta de ana, obtido %+v", apuracao)
+	}
+	if _, contada := apuracao.Detalhe[bia.Endereco]; contada {
+		t.Errorf("Bia não tem peso próprio e não deveria aparecer no detalhe")
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"time"
+)
+
+// Valores usados quando a especificação do gênesis não define o ajuste.
+const (
+	intervaloAjustePadrao   = 10
+	tempoAlvoBlocoPadrao    = 10
+	dificuldadeMinimaPadrao = 2
+	dificuldadeMaximaPadrao = 6
+)
+
+// calcularDificuldade devolve a dificuldade que o bloco na altura deve ter.
+// A cada IntervaloAjuste blocos, compara o tempo gasto nos últimos blocos com
+// o tempo alvo (em segundos por bloco, um parâmetro governável): se foi menos
+// da metade a dificuldade sobe um zero, se foi mais do dobro desce um zero.
+// blocoEm devolve o bloco de uma altura anterior do mesmo ramo; tempoAlvo só
+// é consultado nas alturas de ajuste.
+func (e EspecificacaoGenesis) calcularDificuldade(altura int, tempoAlvo func() int, blocoEm func(int) Bloco) int {
+	if altura <= 1 {
+		return e.Dificuldade
+	}
+	anterior := blocoEm(altura - 1)
+	intervalo := e.intervaloAjuste()
+	if !e.alturaDeAjuste(altura) {
+		return anterior.Dificuldade
+	}
+	primeiro := blocoEm(altura - intervalo)
+	inicio, err1 := time.Parse(time.RFC3339, primeiro.Timestamp)
+	fim, err2 := time.Parse(time.RFC3339, anterior.Timestamp)
+	if err1 != nil || err2 != nil {
+		return anterior.Dificuldade
+	}
+	decorrido := fim.Sub(inicio)
+	alvo := time.Duration(intervalo-1) * time.Duration(tempoAlvo()) * time.Second
+	nova := anterior.Dificuldade
+	if decorrido < alvo/2 {
+		nova++
+	} else if decorrido > alvo*2 {
+		nova--
+	}
+	return e.limitarDificuldade(nova)
+}
+
+// alturaDeAjuste diz se a dificuldade pode mudar no bloco da altura. A
+// primeira janela começa no gênesis, cujo timestamp é fixo e não diz nada
+// sobre o ritmo da rede, então ela não causa ajuste.
+func (e EspecificacaoGenesis) alturaDeAjuste(altura int) bool {
+	intervalo := e.intervaloAjuste()
+	return altura%intervalo == 0 && altura > intervalo
+}
+
+// dificuldadeMinimaAte diz a menor dificuldade que um bloco da altura ate pode
+// ter, descendendo de um bloco da altura de com dificuldade d: cada altura de
+// ajuste no caminho baixa no máximo um.
+func (e EspecificacaoGenesis) dificuldadeMinimaAte(d, de, ate int) int {
+	intervalo := e.intervaloAjuste()
+	// alturas de ajuste até a altura h: os múltiplos do intervalo depois do primeiro
+	ajustes := func(h int) int { return max(0, h/intervalo-1) }
+	if ate > de {
+		d -= ajustes(ate) - ajustes(de)
+	}
+	return e.limitarDificuldade(d)
+}
+
+func (e EspecificacaoGenesis) limitarDificuldade(d int) int {
+	minima, maxima := e.dificuldadeMinima(), e.dificuldadeMaxima()
+	if d < minima {
+		return minima
+	}
+	if d > maxima {
+		return maxima
+	}
+	return d
+}
+
+func (e EspecificacaoGenesis) intervaloAjuste() int {
+	if e.IntervaloAjuste > 0 {
+		return e.IntervaloAjuste
+	}
+	return intervaloAjustePadrao
+}
+
+func (e EspecificacaoGenesis) tempoAlvoBloco() int {
+	if e.TempoAlvoBloco > 0 {
+		return e.TempoAlvoBloco
+	}
+	return tempoAlvoBlocoPadrao
+}
+
+func (e EspecificacaoGenesis) dificuldadeMinima() int {
+	if e.DificuldadeMinima > 0 {
+		return e.DificuldadeMinima
+	}
+	return dificuldadeMinimaPadrao
+}
+
+func (e EspecificacaoGenesis) dificuldadeMaxima() int {
+	if e.DificuldadeMaxima > 0 {
+		return e.DificuldadeMaxima
+	}
+	return dificuldadeMaximaPadrao
+}
+
+// dificuldadeEsperada calcula a dificuldade do filho de pai percorrendo o
+// ramo dele na árvore, o que funciona também para ramos alternativos. O tempo
+// alvo vem do estado do ramo; se ele não puder ser montado, o ramo é inválido.
+// Deve ser chamado com bc.mu travado.
+func (bc *Blockchain) dificuldadeEsperada(pai *noBloco) (int, error) {
+	var err error
+	dificuldade := bc.genesis.calcularDificuldade(pai.bloco.Indice+1, func() int {
+		var parametros Parametros
+		parametros, err = bc.parametrosDoFilho(pai)
+		return parametros.TempoAlvoBloco
+	}, func(altura int) Bloco {
+		no := pai
+		for no.bloco.Indice > altura {
+			no = no.pai
+		}
+		return no.bloco
+	})
+	return dificuldade, err
+}
+
+// dificuldadeNaCadeia calcula a dificuldade esperada para blocos[altura] a
+// partir dos blocos anteriores da mesma fatia, com estado aplicado até o
+// bloco anterior.
+func (bc *Blockchain) dificuldadeNaCadeia(blocos []Bloco, altura int, estado *EstadoMundo) int {
+	return bc.genesis.calcularDificuldade(altura, func() int {
+		return estado.ParametrosPara(altura).TempoAlvoBloco
+	}, func(h int) Bloco {
+		return blocos[h]
+	})
+}
+
+// timestampValido recusa blocos anteriores ao pai ou muito à frente do
+// relógio local, que poderiam ser usados para manipular o ajuste.
+func timestampValido(bloco, pai Bloco) bool {
+	ts, err := time.Parse(time.RFC3339, bloco.Timestamp)
+	if err != nil {
+		return false
+	}
+	tsPai, err := time.Parse(time.RFC3339, pai.Timestamp)
+	if err != nil {
+		return false
+	}
+	return !ts.Before(tsPai) && ts.Before(time.Now().Add(2*time.Minute))
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func blocosEspacados(especificacao EspecificacaoGenesis, n int, espaco time.Duration) []Bloco {
+	inicio := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	blocos := []Bloco{especificacao.Bloco()}
+	for i := 1; i < n; i++ {
+		blocos = append(blocos, Bloco{
+			Indice:      i,
+			Timestamp:   inicio.Add(time.Duration(i) * espaco).Format(time.RFC3339),
+			Dificuldade: especificacao.calcularDificuldade(i, especificacao.tempoAlvoBloco, func(h int) Bloco { return blocos[h] }),
+		})
+	}
+	return blocos
+}
+
+// Testa que a dificuldade sobe quando os blocos saem rápido demais e desce quando saem devagar
+func TestAjusteDeDificuldade(t *testing.T) {
+	especificacao := EspecificacaoGenesis{
+		ChainID:           "teste",
+		Timestamp:         "2024-01-01T00:00:00Z",
+		Dificuldade:       3,
+		IntervaloAjuste:   5,
+		TempoAlvoBloco:    10,
+		DificuldadeMinima: 1,
+		DificuldadeMaxima: 5,
+	}
+
+	rapidos := blocosEspacados(especificacao, 16, time.Second)
+	if rapidos[9].Dificuldade != 3 || rapidos[10].Dificuldade != 4 || rapidos[15].Dificuldade != 5 {
+		t.Errorf("Dificuldade deveria subir a cada janela rápida, obtido %d, %d, %d", rapidos[9].Dificuldade, rapidos[10].Dificuldade, rapidos[15].Dificuldade)
+	}
+
+	lentos := blocosEspacados(especificacao, 16, time.Minute)
+	if lentos[10].Dificuldade != 2 || lentos[15].Dificuldade != 1 {
+		t.Errorf("Dificuldade deveria descer a cada janela lenta, obtido %d, %d", lentos[10].Dificuldade, lentos[15].Dificuldade)
+	}
+
+	normais := blocosEspacados(especificacao, 16, 10*time.Second)
+	if normais[15].Dificuldade != 3 {
+		t.Errorf("Dificuldade deveria se manter no ritmo alvo, obtido %d", normais[15].Dificuldade)
+	}
+}
+
+// Testa que um bloco com dificuldade diferente da esperada é rejeitado mesmo com prova de trabalho válida
+func TestDificuldadeErradaRejeitada(t *testing.T) {
+	bc := NovoBlockchain(nil)
+	carteira, _ := NovaCarteira()
+	bloco := minerarSobrePonta(bc, transacaoAssinada(t, carteira, 0, "criar_evento", Evento{Nome: "Fácil", Opcoes: []string{"X", "Y"}}))
+	bloco.Dificuldade = 1
+	bloco.Nonce, bloco.HashAtual = provaDeTrabalho(bloco, bloco.Dificuldade)
+	if !bc.ValidarBloco(bloco) {
+		t.Fatal("Prova de trabalho do bloco deveria ser válida isoladamente")
+	}
+
+	bc.mu.Lock()
+	err := bc.inserirBloco(bloco)
+	bc.mu.Unlock()
+	if err == nil {
+		t.Error("Bloco com dificuldade abaixo da esperada deveria ser rejeitado")
+	}
+	if bc.ValidarNovaBlockchain(append(append([]Bloco{}, bc.Blocos...), bloco)) {
+		t.Error("Cadeia com dificuldade abaixo da esperada deveria ser rejeitada")
+	}
+}
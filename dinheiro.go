@@ -0,0 +1,165 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strings"
+)
+
+// Quantia é um valor em dinheiro em centavos inteiros. Saldos, apostas e
+// prêmios usam Quantia em vez de float64 para que todos os nós cheguem
+// exatamente aos mesmos números.
+//
+// Em JSON a quantia é um texto decimal com no máximo duas casas ("12.34").
+// Números JSON também são aceitos na leitura, porque blocos antigos gravaram
+// valores assim; nesse caso o valor é arredondado para o centavo mais próximo,
+// com meio centavo arredondado para longe do zero. Textos com mais de duas
+// casas decimais são recusados em vez de arredondados.
+type Quantia int64
+
+const centavosPorReal = 100
+
+var errEstouro = errors.New("valor fora do intervalo representável")
+
+// Reais converte um valor inteiro em reais para Quantia.
+func Reais(reais int64) Quantia {
+	return Quantia(reais * centavosPorReal)
+}
+
+// ParseQuantia lê um texto decimal como "12.34", "-5" ou "0.5".
+func ParseQuantia(texto string) (Quantia, error) {
+	digitos := strings.TrimPrefix(texto, "-")
+	inteira, fracao, _ := strings.Cut(digitos, ".")
+	if inteira == "" || len(fracao) > 2 || !somenteDigitos(inteira) || !somenteDigitos(fracao) || strings.HasSuffix(texto, ".") {
+		return 0, fmt.Errorf("quantia %q inválida: use um número com até duas casas decimais", texto)
+	}
+	valor, ok := new(big.Rat).SetString(texto)
+	if !ok {
+		return 0, fmt.Errorf("quantia %q inválida", texto)
+	}
+	return quantiaDeRacional(valor)
+}
+
+func somenteDigitos(texto string) bool {
+	for _, c := range texto {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// quantiaDeRacional converte reais em centavos, arredondando meio centavo para
+// longe do zero.
+func quantiaDeRacional(reais *big.Rat) (Quantia, error) {
+	centavos := new(big.Rat).Mul(reais, big.NewRat(centavosPorReal, 1))
+	quociente, resto := new(big.Int).QuoRem(centavos.Num(), centavos.Denom(), new(big.Int))
+	resto.Abs(resto).Lsh(resto, 1)
+	if resto.Cmp(centavos.Denom()) >= 0 {
+		quociente.Add(quociente, big.NewInt(int64(centavos.Sign())))
+	}
+	if !quociente.IsInt64() {
+		return 0, errEstouro
+	}
+	return Quantia(quociente.Int64()), nil
+}
+
+func (q Quantia) String() string {
+	sinal := ""
+	centavos := uint64(q)
+	if q < 0 {
+		sinal = "-"
+		centavos = -centavos
+	}
+	return fmt.Sprintf("%s%d.%02d", sinal, centavos/centavosPorReal, centavos%centavosPorReal)
+}
+
+func (q Quantia) MarshalJSON() ([]byte, error) {
+	return json.Marshal(q.String())
+}
+
+func (q *Quantia) UnmarshalJSON(dados []byte) error {
+	var texto string
+	if err := json.Unmarshal(dados, &texto); err == nil {
+		valor, err := ParseQuantia(texto)
+		if err != nil {
+			return err
+		}
+		*q = valor
+		return nil
+	}
+	var numero json.Number
+	if err := json.Unmarshal(dados, &numero); err != nil {
+		return fmt.Errorf("quantia deve ser um texto decimal")
+	}
+	reais, ok := new(big.Rat).SetString(numero.String())
+	if !ok {
+		return fmt.Errorf("quantia %s inválida", numero)
+	}
+	valor, err := quantiaDeRacional(reais)
+	if err != nil {
+		return err
+	}
+	*q = valor
+	return nil
+}
+
+// Somar devolve q+outra ou errEstouro.
+func (q Quantia) Somar(outra Quantia) (Quantia, error) {
+	if (outra > 0 && q > math.MaxInt64-outra) || (outra < 0 && q < math.MinInt64-outra) {
+		return 0, errEstouro
+	}
+	return q + outra, nil
+}
+
+// Subtrair devolve q-outra ou errEstouro.
+func (q Quantia) Subtrair(outra Quantia) (Quantia, error) {
+	if outra == math.MinInt64 {
+		return 0, errEstouro
+	}
+	return q.Somar(-outra)
+}
+
+// dividirProporcional reparte total entre os pesos, proporcionalmente a cada
+// um. Cada parte é arredondada para baixo e os centavos que sobram (a poeira)
+// vão, um para cada, aos primeiros pesos positivos da lista, então a soma das
+// partes é sempre exatamente total. total e os pesos não podem ser negativos.
+func dividirProporcional(total Quantia, pesos []Quantia) ([]Quantia, error) {
+	soma := big.NewInt(0)
+	for _, peso := range pesos {
+		if peso < 0 {
+			return nil, fmt.Errorf("peso negativo")
+		}
+		soma.Add(soma, big.NewInt(int64(peso)))
+	}
+	partes := make([]Quantia, len(pesos))
+	if total == 0 {
+		return partes, nil
+	}
+	if total < 0 || soma.Sign() == 0 {
+		return nil, fmt.Errorf("não há como dividir %s entre pesos zerados", total)
+	}
+	distribuido := Quantia(0)
+	for i, peso := range pesos {
+		// big.Int evita estouro no produto peso*total
+		parte := new(big.Int).Mul(big.NewInt(int64(peso)), big.NewInt(int64(total)))
+		parte.Quo(parte, soma)
+		partes[i] = Quantia(parte.Int64())
+		distribuido += partes[i]
+	}
+	for poeira := total - distribuido; poeira > 0; {
+		for i := range partes {
+			if poeira == 0 {
+				break
+			}
+			if pesos[i] > 0 {
+				partes[i]++
+				poeira--
+			}
+		}
+	}
+	return partes, nil
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// Testa a leitura e a escrita de quantias como texto decimal
+func TestQuantiaTexto(t *testing.T) {
+	casos := map[string]Quantia{"12.34": 1234, "-5": -500, "0.5": 50, "0.05": 5, "-0.05": -5, "7.10": 710}
+	for texto, esperado := range casos {
+		valor, err := ParseQuantia(texto)
+		if err != nil || valor != esperado {
+			t.Errorf("ParseQuantia(%q) = %d, %v; esperado %d", texto, valor, err, esperado)
+		}
+	}
+	for _, texto := range []string{"", "-", "1.", ".5", "1.234", "1e2", "+1", "1,50", "99999999999999999999"} {
+		if _, err := ParseQuantia(texto); err == nil {
+			t.Errorf("ParseQuantia(%q) deveria falhar", texto)
+		}
+	}
+	if Quantia(-5).String() != "-0.05" || Quantia(1234).String() != "12.34" || Quantia(math.MinInt64).String() != "-92233720368547758.08" {
+		t.Errorf("Formatação incorreta: %s %s", Quantia(-5), Quantia(1234))
+	}
+}
+
+// Testa que quantias viram texto em JSON e que números de blocos antigos são arredondados ao centavo
+func TestQuantiaJSON(t *testing.T) {
+	dados, _ := json.Marshal(Aposta{Usuario: "ana", Valor: 1050})
+	if string(dados) != `{"usuario":"ana","valor":"10.50","evento_id":0,"opcao":""}` {
+		t.Errorf("JSON inesperado: %s", dados)
+	}
+	casos := map[string]Quantia{`"10.50"`: 1050, `10.5`: 1050, `1e2`: 10000, `0.125`: 13, `-0.125`: -13, `0.124`: 12}
+	for texto, esperado := range casos {
+		var valor Quantia
+		if err := json.Unmarshal([]byte(texto), &valor); err != nil || valor != esperado {
+			t.Errorf("json %s = %d, %v; esperado %d", texto, valor, err, esperado)
+		}
+	}
+	var valor Quantia
+	for _, texto := range []string{`"0.125"`, `true`, `1e30`} {
+		if err := json.Unmarshal([]byte(texto), &valor); err == nil {
+			t.Errorf("json %s deveria falhar", texto)
+		}
+	}
+}
+
+// Testa que soma e subtração acusam estouro em vez de dar a volta
+func TestQuantiaEstouro(t *testing.T) {
+	if _, err := Quantia(math.MaxInt64).Somar(1); err != errEstouro {
+		t.Error("Soma deveria estourar")
+	}
+	if _, err := Quantia(math.MinInt64).Subtrair(1); err != errEstouro {
+		t.Error("Subtração deveria estourar")
+	}
+	if _, err := Quantia(0).Subtrair(math.MinInt64); err != errEstouro {
+		t.Error("Subtrair o menor valor deveria estourar")
+	}
+	if valor, err := Quantia(math.MaxInt64).Somar(math.MinInt64); err != nil || valor != -1 {
+		t.Errorf("Soma esperada -1, obtida %d (%v)", valor, err)
+	}
+}
+
+// Testa, com apostas aleatórias, que a liquidação nunca paga mais do que o
+// total apostado, paga exatamente o total e devolve pelo menos o valor de
+// cada aposta vencedora
+func TestPremiosNuncaExcedemTotalApostado(t *testing.T) {
+	aleatorio := rand.New(rand.NewSource(1))
+	usuarios := []string{"ana", "bia", "caio", "davi", "eva"}
+	for rodada := 0; rodada < 2000; rodada++ {
+		evento := &Evento{Opcoes: []string{"X", "Y", "Z"}, Votos: make(map[string][]Aposta)}
+		total := Quantia(0)
+		apostado := make(map[string]Quantia)
+		for i := aleatorio.Intn(12); i >= 0; i-- {
+			aposta := Aposta{Usuario: usuarios[aleatorio.Intn(len(usuarios))], Opcao: evento.Opcoes[aleatorio.Intn(3)]}
+			// Valores pequenos e enormes, para exercitar a poeira e o big.Int
+			if aleatorio.Intn(4) == 0 {
+				aposta.Valor = Quantia(aleatorio.Int63n(math.MaxInt64 / 16))
+			} else {
+				aposta.Valor = Quantia(1 + aleatorio.Intn(1000))
+			}
+			evento.Votos[aposta.Opcao] = append(evento.Votos[aposta.Opcao], aposta)
+			total += aposta.Valor
+			if aposta.Opcao == "X" {
+				apostado[aposta.Usuario] += aposta.Valor
+			}
+		}
+		premios, err := premiosParimutuel(evento, "X")
+		if err != nil {
+			t.Fatalf("rodada %d: %v", rodada, err)
+		}
+		pago := Quantia(0)
+		for usuario, premio := range premios {
+			if premio < apostado[usuario] {
+				t.Fatalf("rodada %d: %s recebeu %s, apostou %s no vencedor", rodada, usuario, premio, apostado[usuario])
+			}
+			pago += premio
+		}
+		if pago != total {
+			t.Fatalf("rodada %d: pago %s de um total apostado de %s", rodada, pago, total)
+		}
+	}
+}
+
+// Testa que a poeira da divisão vai para os primeiros pesos positivos
+func TestDividirProporcionalPoeira(t *testing.T) {
+	partes, err := dividirProporcional(5, []Quantia{0, 1, 1, 1})
+	if err != nil || partes[0] != 0 || partes[1] != 2 || partes[2] != 2 || partes[3] != 1 {
+		t.Errorf("Partes esperadas [0 2 2 1], obtidas %v (%v)", partes, err)
+	}
+	if _, err := dividirProporcional(5, []Quantia{0, 0}); err == nil {
+		t.Error("Dividir entre pesos zerados deveria falhar")
+	}
+}
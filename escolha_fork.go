@@ -0,0 +1,365 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"time"
+)
+
+const maxEventosReorg = 100
+
+// profundidadeMaxRamo é até onde abaixo da ponta um ramo alternativo ainda é
+// guardado; blocos mais fundos que isso saem da árvore e novos ramos não
+// podem partir dali. É variável para que os testes possam reduzi-la.
+var profundidadeMaxRamo = 100
+
+// noBloco é um bloco na árvore de ramos conhecidos, com o trabalho acumulado
+// desde o gênesis até ele.
+type noBloco struct {
+	bloco    Bloco
+	pai      *noBloco
+	trabalho *big.Int
+	// invalido marca blocos cujas transações não puderam ser aplicadas sobre
+	// o ramo deles; nem eles nem os descendentes viram ponta.
+	invalido bool
+}
+
+// ArvoreBlocos guarda os blocos válidos conhecidos, inclusive os de ramos
+// que perderam a disputa, indexados pelo hash. Ramos alternativos mais fundos
+// que profundidadeMaxRamo são podados.
+type ArvoreBlocos struct {
+	nos map[string]*noBloco
+	// alturas indexa os hashes pela altura, para a poda
+	alturas map[int][]string
+	// podadaAte é a maior altura já podada; nenhum bloco entra abaixo dela
+	podadaAte int
+}
+
+type EventoReorg struct {
+	Timestamp       string `json:"timestamp"`
+	Profundidade    int    `json:"profundidade"`
+	AncestralComum  int    `json:"ancestral_comum"`
+	PontaAnterior   string `json:"ponta_anterior"`
+	PontaNova       string `json:"ponta_nova"`
+	BlocosAplicados int    `json:"blocos_aplicados"`
+}
+
+// trabalhoDoBloco estima quantos hashes foram necessários para achar o bloco:
+// cada zero hexadecimal à esquerda multiplica o esforço por 16.
+func trabalhoDoBloco(bloco Bloco) *big.Int {
+	return new(big.Int).Lsh(big.NewInt(1), uint(4*bloco.Dificuldade))
+}
+
+func NovaArvoreBlocos(genesis Bloco) *ArvoreBlocos {
+	return &ArvoreBlocos{
+		nos: map[string]*noBloco{
+			genesis.HashAtual: {bloco: genesis, trabalho: trabalhoDoBloco(genesis)},
+		},
+		alturas: make(map[int][]string),
+	}
+}
+
+func (a *ArvoreBlocos) Contem(hash string) bool {
+	_, existe := a.nos[hash]
+	return existe
+}
+
+// Inserir liga o bloco ao pai já conhecido. A validade do próprio bloco
+// (hash e prova de trabalho) é responsabilidade de quem chama.
+func (a *ArvoreBlocos) Inserir(bloco Bloco) (*noBloco, error) {
+	if no, existe := a.nos[bloco.HashAtual]; existe {
+		return no, nil
+	}
+	pai, existe := a.nos[bloco.HashAnterior]
+	if !existe {
+		return nil, fmt.Errorf("bloco pai %s desconhecido", bloco.HashAnterior)
+	}
+	if pai.invalido {
+		return nil, fmt.Errorf("bloco pai %s é inválido", bloco.HashAnterior)
+	}
+	if bloco.Indice != pai.bloco.Indice+1 {
+		return nil, fmt.Errorf("índice %d não segue o pai %d", bloco.Indice, pai.bloco.Indice)
+	}
+	if bloco.Indice <= a.podadaAte {
+		return nil, fmt.Errorf("bloco %d abre um ramo mais fundo que o permitido", bloco.Indice)
+	}
+	no := &noBloco{
+		bloco:    bloco,
+		pai:      pai,
+		trabalho: new(big.Int).Add(pai.trabalho, trabalhoDoBloco(bloco)),
+	}
+	a.nos[bloco.HashAtual] = no
+	a.alturas[bloco.Indice] = append(a.alturas[bloco.Indice], bloco.HashAtual)
+	return no, nil
+}
+
+// podar tira da árvore os blocos até a altura limite que não estão na cadeia
+// principal e devolve quantos saíram. Os da cadeia principal continuam, pois
+// os ramos recentes dependem deles.
+func (a *ArvoreBlocos) podar(limite int, principal []Bloco) int {
+	podados := 0
+	for altura := a.podadaAte + 1; altura <= limite; altura++ {
+		for _, hash := range a.alturas[altura] {
+			if altura < len(principal) && principal[altura].HashAtual == hash {
+				continue
+			}
+			delete(a.nos, hash)
+			podados++
+		}
+		delete(a.alturas, altura)
+		a.podadaAte = altura
+	}
+	return podados
+}
+
+// ancestralComum sobe pelos dois ramos até encontrar o primeiro bloco em comum.
+func ancestralComum(a, b *noBloco) *noBloco {
+	for a.bloco.Indice > b.bloco.Indice {
+		a = a.pai
+	}
+	for b.bloco.Indice > a.bloco.Indice {
+		b = b.pai
+	}
+	for a != b {
+		a = a.pai
+		b = b.pai
+	}
+	return a
+}
+
+// guardarBloco valida o bloco e o guarda na árvore sem mexer na cadeia
+// principal. Deve ser chamado com bc.mu travado.
+func (bc *Blockchain) guardarBloco(bloco Bloco) (*noBloco, error) {
+	if no, existe := bc.arvore.nos[bloco.HashAtual]; existe {
+		if no.invalido {
+			return nil, fmt.Errorf("bloco %d já foi rejeitado", bloco.Indice)
+		}
+		return no, nil
+	}
+	pai, existe := bc.arvore.nos[bloco.HashAnterior]
+	if !existe {
+		return nil, fmt.Errorf("bloco pai %s desconhecido", bloco.HashAnterior)
+	}
+	dificuldade, err := bc.dificuldadeEsperada(pai)
+	if err != nil {
+		return nil, err
+	}
+	if err := bc.validarCabecalho(bloco, pai.bloco, dificuldade); err != nil {
+		return nil, comBloco(err, bloco.Indice)
+	}
+	return bc.arvore.Inserir(bloco)
+}
+
+// parametrosDoFilho devolve os parâmetros que valem para o filho de pai, que
+// dependem do estado do ramo de pai. Para um ramo alternativo o estado é
+// levado até pai e depois volta à ponta, como numa reorganização desfeita.
+// Deve ser chamado com bc.mu travado.
+func (bc *Blockchain) parametrosDoFilho(pai *noBloco) (Parametros, error) {
+	altura := pai.bloco.Indice + 1
+	if pai == bc.ponta {
+		return bc.estado.ParametrosPara(altura), nil
+	}
+	ancestral := ancestralComum(bc.ponta, pai)
+	var trecho []Bloco
+	for no := pai; no != ancestral; no = no.pai {
+		trecho = append(trecho, no.bloco)
+	}
+	desfeitos := bc.Blocos[ancestral.bloco.Indice+1:]
+	for range desfeitos {
+		bc.estado.Desfazer()
+	}
+	aplicados := 0
+	var err error
+	for i := len(trecho) - 1; i >= 0; i-- {
+		if err = bc.estado.Aplicar(trecho[i]); err != nil {
+			// O ramo não se sustenta: nem pai nem seus descendentes servem
+			for no := pai; no.bloco.Indice >= trecho[i].Indice; no = no.pai {
+				no.invalido = true
+			}
+			break
+		}
+		aplicados++
+	}
+	parametros := bc.estado.ParametrosPara(altura)
+	if errVolta := bc.voltarEstado(aplicados, desfeitos); errVolta != nil {
+		return Parametros{}, errVolta
+	}
+	return parametros, err
+}
+
+// voltarEstado desfaz os aplicados blocos de um ramo alternativo e reaplica os
+// desfeitos da cadeia principal. Se a reaplicação falhar, o estado é
+// reconstruído do zero a partir de bc.Blocos. Deve ser chamado com bc.mu
+// travado.
+func (bc *Blockchain) voltarEstado(aplicados int, desfeitos []Bloco) error {
+	for ; aplicados > 0; aplicados-- {
+		bc.estado.Desfazer()
+	}
+	for _, bloco := range desfeitos {
+		if err := bc.estado.Aplicar(bloco); err != nil {
+			log.Printf("Bloco %d da cadeia principal não pôde ser reaplicado (%v), reconstruindo o estado", bloco.Indice, err)
+			estado, err := estadoDaCadeia(bc.Blocos)
+			if err != nil {
+				return fmt.Errorf("estado não pôde voltar à cadeia principal: %w", err)
+			}
+			bc.estado = estado
+			return nil
+		}
+	}
+	return nil
+}
+
+// escolherPonta reorganiza a cadeia se o candidato tiver mais trabalho
+// acumulado que a ponta atual; em caso de empate fica o ramo visto primeiro.
+// Deve ser chamado com bc.mu travado.
+func (bc *Blockchain) escolherPonta(candidato *noBloco) error {
+	if candidato.trabalho.Cmp(bc.ponta.trabalho) > 0 {
+		defer bc.sinalizarNovaPonta()
+		return bc.reorganizar(candidato)
+	}
+	return nil
+}
+
+// sinalizarNovaPonta acorda quem está minerando sobre a ponta anterior.
+// Deve ser chamado com bc.mu travado.
+func (bc *Blockchain) sinalizarNovaPonta() {
+	close(bc.novaPonta)
+	bc.novaPonta = make(chan struct{})
+}
+
+// inserirBloco guarda um bloco cujo pai já é conhecido e aplica a escolha de
+// ramo. Deve ser chamado com bc.mu travado.
+func (bc *Blockchain) inserirBloco(bloco Bloco) error {
+	no, err := bc.guardarBloco(bloco)
+	if err != nil {
+		return err
+	}
+	return bc.escolherPonta(no)
+}
+
+// incorporarCadeia guarda todos os blocos de uma cadeia recebida de um peer e
+// só depois escolhe o ramo, para que uma cadeia longa gere uma única
+// reorganização. Deve ser chamado com bc.mu travado.
+func (bc *Blockchain) incorporarCadeia(blocos []Bloco) error {
+	var ultimo *noBloco
+	for _, bloco := range blocos[1:] {
+		no, err := bc.guardarBloco(bloco)
+		if err != nil {
+			return err
+		}
+		ultimo = no
+	}
+	if ultimo == nil {
+		return nil
+	}
+	return bc.escolherPonta(ultimo)
+}
+
+// reorganizar torna novaPonta a ponta da cadeia principal: desfaz os blocos
+// posteriores ao ancestral comum e aplica apenas o trecho divergente.
+// Deve ser chamado com bc.mu travado.
+func (bc *Blockchain) reorganizar(novaPonta *noBloco) error {
+	ancestral := ancestralComum(bc.ponta, novaPonta)
+	var trecho []Bloco
+	for no := novaPonta; no != ancestral; no = no.pai {
+		trecho = append(trecho, no.bloco)
+	}
+	for i, j := 0, len(trecho)-1; i < j; i, j = i+1, j-1 {
+		trecho[i], trecho[j] = trecho[j], trecho[i]
+	}
+	altura := ancestral.bloco.Indice + 1
+	// O trecho é aplicado ao estado antes de mexer no armazenamento: se algum
+	// bloco violar as regras (nonce, saldo...), o estado volta a ser o da
+	// ponta atual e o ramo fica marcado como inválido.
+	desfeitos := append([]Bloco(nil), bc.Blocos[altura:]...)
+	for range desfeitos {
+		bc.estado.Desfazer()
+	}
+	for i, bloco := range trecho {
+		if err := bc.estado.Aplicar(bloco); err != nil {
+			for no := novaPonta; no.bloco.Indice >= bloco.Indice; no = no.pai {
+				no.invalido = true
+			}
+			if errVolta := bc.voltarEstado(i, desfeitos); errVolta != nil {
+				return errVolta
+			}
+			return err
+		}
+	}
+	// O disco só muda depois do estado; se a gravação falhar, o ramo antigo
+	// volta ao disco e o estado volta a ele, e a cadeia em memória nem chega
+	// a mudar.
+	if err := bc.armazenamento.Truncar(altura); err != nil {
+		if errVolta := bc.voltarEstado(len(trecho), desfeitos); errVolta != nil {
+			return errVolta
+		}
+		return err
+	}
+	if err := bc.armazenamento.Anexar(trecho...); err != nil {
+		if errDisco := bc.armazenamento.Anexar(desfeitos...); errDisco != nil {
+			err = fmt.Errorf("%w; regravando o ramo anterior: %v", err, errDisco)
+		}
+		if errVolta := bc.voltarEstado(len(trecho), desfeitos); errVolta != nil {
+			return errVolta
+		}
+		return err
+	}
+	profundidade := len(desfeitos)
+	pontaAnterior := bc.ponta.bloco.HashAtual
+	for _, bloco := range desfeitos {
+		bc.desindexarTransacoes(bloco)
+	}
+	bc.Blocos = bc.Blocos[:altura]
+	// Transações dos blocos desfeitos voltam ao mempool, a não ser que o novo
+	// ramo também as inclua.
+	defer func() {
+		for _, bloco := range desfeitos {
+			for _, tx := range bloco.Transacoes {
+				if _, confirmada := bc.txConfirmadas[tx.ID]; !confirmada {
+					bc.mempool.Adicionar(tx, bc.estado.Nonces, time.Now())
+				}
+			}
+		}
+	}()
+	bc.Blocos = append(bc.Blocos, trecho...)
+	for _, bloco := range trecho {
+		bc.indexarTransacoes(bloco)
+		bc.mempool.Remover(idsTransacoes(bloco.Transacoes)...)
+	}
+	bc.ponta = novaPonta
+	if podados := bc.arvore.podar(novaPonta.bloco.Indice-profundidadeMaxRamo, bc.Blocos); podados > 0 {
+		log.Printf("%d bloco(s) de ramos alternativos podado(s)", podados)
+	}
+	if profundidade > 0 {
+		evento := EventoReorg{
+			Timestamp:       time.Now().Format(time.RFC3339),
+			Profundidade:    profundidade,
+			AncestralComum:  ancestral.bloco.Indice,
+			PontaAnterior:   pontaAnterior,
+			PontaNova:       novaPonta.bloco.HashAtual,
+			BlocosAplicados: len(trecho),
+		}
+		log.Printf("Reorganização: %d bloco(s) desfeito(s) a partir do %d, %d aplicado(s)", profundidade, ancestral.bloco.Indice, len(trecho))
+		bc.reorgs = append(bc.reorgs, evento)
+		if len(bc.reorgs) > maxEventosReorg {
+			bc.reorgs = bc.reorgs[len(bc.reorgs)-maxEventosReorg:]
+		}
+	}
+	return nil
+}
+
+func (bc *Blockchain) HandleReorgs(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	if r.Method == "OPTIONS" {
+		return
+	}
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(append([]EventoReorg{}, bc.reorgs...))
+}
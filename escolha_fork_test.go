@@ -0,0 +1,134 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func incorporar(t *testing.T, bc *Blockchain, blocos []Bloco) {
+	t.Helper()
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	if err := bc.incorporarCadeia(blocos); err != nil {
+		t.Fatalf("Erro ao incorporar cadeia: %v", err)
+	}
+}
+
+// Testa que o ramo com mais trabalho vence e só o trecho divergente é trocado
+func TestReorganizacaoParaRamoComMaisTrabalho(t *testing.T) {
+	a := NovoBlockchain(nil)
+	b := NovoBlockchain(nil)
+	a.AdicionarRegistro("Comum")
+	incorporar(t, b, a.Blocos)
+
+	a.AdicionarRegistro("A")
+	a.AdicionarRegistro("A")
+	a.AdicionarRegistro("A")
+	b.AdicionarRegistro("B")
+	b.AdicionarRegistro("B")
+
+	incorporar(t, b, a.Blocos)
+	if len(b.Blocos) != len(a.Blocos) || b.Blocos[len(b.Blocos)-1].HashAtual != a.Blocos[len(a.Blocos)-1].HashAtual {
+		t.Fatal("Nó deveria adotar o ramo com mais trabalho")
+	}
+	if !b.ValidarBlockchain() {
+		t.Error("Blockchain deveria ser válida após reorganização")
+	}
+	if len(b.reorgs) != 1 || b.reorgs[0].Profundidade != 2 || b.reorgs[0].AncestralComum != 1 {
+		t.Errorf("Esperada uma reorganização de profundidade 2 a partir do bloco 1, obtido %+v", b.reorgs)
+	}
+}
+
+// Testa que um ramo com menos trabalho fica guardado mas não substitui a cadeia
+func TestRamoComMenosTrabalhoIgnorado(t *testing.T) {
+	a := NovoBlockchain(nil)
+	b := NovoBlockchain(nil)
+	a.AdicionarRegistro("A")
+	b.AdicionarRegistro("B")
+	b.AdicionarRegistro("B")
+	pontaB := b.Blocos[len(b.Blocos)-1].HashAtual
+
+	incorporar(t, b, a.Blocos)
+	if b.Blocos[len(b.Blocos)-1].HashAtual != pontaB {
+		t.Error("Ramo com menos trabalho não deveria substituir a cadeia")
+	}
+	if !b.arvore.Contem(a.Blocos[1].HashAtual) {
+		t.Error("Ramo alternativo deveria ficar guardado na árvore")
+	}
+	if len(b.reorgs) != 0 {
+		t.Errorf("Nenhuma reorganização esperada, obtido %d", len(b.reorgs))
+	}
+}
+
+// armazenamentoFalho simula um disco que recusa as próximas falhas gravações.
+type armazenamentoFalho struct {
+	*ArmazenamentoMemoria
+	falhas int
+}
+
+func (a *armazenamentoFalho) Anexar(blocos ...Bloco) error {
+	if a.falhas > 0 {
+		a.falhas--
+		return errors.New("disco cheio")
+	}
+	return a.ArmazenamentoMemoria.Anexar(blocos...)
+}
+
+// Testa que uma falha de gravação no meio da reorganização deixa cadeia, estado e disco no ramo anterior
+func TestReorganizacaoComFalhaDeGravacao(t *testing.T) {
+	disco := &armazenamentoFalho{ArmazenamentoMemoria: NovoArmazenamentoMemoria()}
+	b, err := CarregarBlockchain(nil, disco, GenesisPadrao)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := NovoBlockchain(nil)
+	minerarBlocos(a, 3, "A")
+	minerarBlocos(b, 2, "B")
+	pontaB := pontaDe(b)
+
+	disco.falhas = 1
+	b.mu.Lock()
+	err = b.incorporarCadeia(a.Blocos)
+	b.mu.Unlock()
+	if err == nil {
+		t.Fatal("A reorganização deveria falhar com o disco recusando a gravação")
+	}
+	if pontaDe(b) != pontaB || len(b.Blocos) != 3 {
+		t.Errorf("A cadeia deveria continuar no ramo anterior, ponta %s com %d blocos", pontaDe(b), len(b.Blocos))
+	}
+	if gravados, _ := disco.Carregar(); len(gravados) != 3 || gravados[2].HashAtual != pontaB {
+		t.Errorf("O disco deveria voltar ao ramo anterior, obtido %d blocos", len(gravados))
+	}
+	if err := b.VerificarEstado(); err != nil {
+		t.Errorf("Estado deveria acompanhar a cadeia: %v", err)
+	}
+
+	incorporar(t, b, a.Blocos)
+	if pontaDe(b) != pontaDe(a) {
+		t.Error("Com o disco de volta, o ramo com mais trabalho deveria ser adotado")
+	}
+}
+
+// Testa que ramos alternativos fundos saem da árvore e não podem ser retomados
+func TestPodaDeRamosAlternativos(t *testing.T) {
+	anterior := profundidadeMaxRamo
+	profundidadeMaxRamo = 2
+	t.Cleanup(func() { profundidadeMaxRamo = anterior })
+	a, b := NovoBlockchain(nil), NovoBlockchain(nil)
+	minerarBlocos(a, 1, "A")
+	minerarBlocos(b, 1, "B")
+	incorporar(t, b, a.Blocos[:2])
+	if !b.arvore.Contem(a.Blocos[1].HashAtual) {
+		t.Fatal("Ramo recente deveria ficar guardado")
+	}
+
+	minerarBlocos(b, 3, "B")
+	if b.arvore.Contem(a.Blocos[1].HashAtual) || !b.arvore.Contem(b.Blocos[1].HashAtual) {
+		t.Error("Só o bloco do ramo alternativo abaixo da profundidade deveria sair da árvore")
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, err := b.arvore.Inserir(a.Blocos[1]); err == nil {
+		t.Error("Um ramo partindo abaixo da altura podada não deveria entrar")
+	}
+}
@@ -0,0 +1,638 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"time"
+)
+
+// EstadoMundo é o resultado de aplicar, em ordem, todos os blocos da cadeia
+// principal: saldos, nonces, eventos, apostas, resultados e prêmios. Cada
+// bloco é aplicado uma única vez e guarda o que é preciso para desfazê-lo numa
+// reorganização.
+type EstadoMundo struct {
+	Saldos  map[string]Quantia
+	Nonces  map[string]uint64
+	Eventos map[int]*Evento
+	// propostas de governança, indexadas pelo ID
+	Propostas map[int]*Proposta
+	// delegações de voto: conta -> categoria ("" para global) -> delegado
+	Delegacoes map[string]map[string]string
+	// contas autorizadas a creditar saldo; vazio permite só depósitos do dono
+	emissores map[string]bool
+	// endereço de cada oráculo nomeado no gênesis
+	oraculos map[string]string
+	// rede das transações assinadas aceitas, definida pelo gênesis
+	chainID    string
+	Parametros Parametros
+	desfazer   []alteracoesBloco
+}
+
+// alteracoesBloco registra o estado anterior de tudo que um bloco alterou.
+type alteracoesBloco struct {
+	saldos         map[string]valorAnterior
+	nonces         map[string]nonceAnterior
+	eventosCriados int
+	apostas        []apostaAplicada
+	eventos        []eventoAnterior
+	// parâmetros de antes do bloco, se ele os mudou
+	parametros       *Parametros
+	propostasCriadas int
+	propostas        []propostaAnterior
+	delegacoes       []delegacaoAnterior
+}
+
+type valorAnterior struct {
+	valor   Quantia
+	existia bool
+}
+
+type nonceAnterior struct {
+	valor   uint64
+	existia bool
+}
+
+type apostaAplicada struct {
+	eventoID int
+	opcao    string
+}
+
+func NovoEstadoMundo() *EstadoMundo {
+	return &EstadoMundo{
+		Saldos:     make(map[string]Quantia),
+		Nonces:     make(map[string]uint64),
+		Eventos:    make(map[int]*Evento),
+		Propostas:  make(map[int]*Proposta),
+		Delegacoes: make(map[string]map[string]string),
+		Parametros: parametrosPadrao(),
+		chainID:    GenesisPadrao.ChainID,
+	}
+}
+
+// Aplicar valida as transações do bloco contra o estado e o atualiza. Se
+// alguma transação for inválida, nada do bloco é aplicado.
+func (e *EstadoMundo) Aplicar(bloco Bloco) error {
+	alteracoes := novasAlteracoes()
+	instante := instanteDoBloco(bloco)
+	e.governar(e.Altura(), &alteracoes)
+	e.avancarEventos(instante, &alteracoes)
+	for _, tx := range transacoesDoBloco(bloco) {
+		if err := e.aplicarTransacao(tx, instante, &alteracoes); err != nil {
+			e.desfazer = append(e.desfazer, alteracoes)
+			e.Desfazer()
+			err.Transacao = tx.ID
+			return comBloco(err, bloco.Indice)
+		}
+	}
+	e.desfazer = append(e.desfazer, alteracoes)
+	return nil
+}
+
+func novasAlteracoes() alteracoesBloco {
+	return alteracoesBloco{
+		saldos: make(map[string]valorAnterior),
+		nonces: make(map[string]nonceAnterior),
+	}
+}
+
+// aplicarTransacao só altera o estado depois de todas as verificações da
+// transação passarem, registrando em alteracoes o que havia antes. instante é
+// o timestamp do bloco que inclui a transação; a altura do bloco é Altura(),
+// já que ele ainda não foi registrado.
+func (e *EstadoMundo) aplicarTransacao(tx Transacao, instante time.Time, alteracoes *alteracoesBloco) *ErroValidacao {
+	// Só a transação do gênesis, que vem da especificação da rede, não é
+	// assinada
+	assinada := tx.Tipo != "genesis"
+	conta := remetente(tx)
+	if assinada && (conta == "" || !verificarAssinatura(tx)) {
+		return rejeitar(MotivoNaoAutorizado, "transação sem assinatura válida")
+	}
+	if assinada && tx.ChainID != e.chainID {
+		return rejeitar(MotivoChainID, "transação assinada para a rede %q, esperada %q", tx.ChainID, e.chainID)
+	}
+	if assinada && tx.Nonce != e.Nonces[conta] {
+		return rejeitar(MotivoNonce, "nonce %d da conta %s, esperado %d", tx.Nonce, conta, e.Nonces[conta])
+	}
+	switch tx.Tipo {
+	case "genesis":
+		// A especificação da rede só vale no bloco 0; repetida depois, ela
+		// cunharia saldos e trocaria as regras da cadeia
+		if e.Altura() != 0 {
+			return rejeitar(MotivoTransacaoMalformada, "transação de gênesis fora do bloco 0")
+		}
+		var especificacao EspecificacaoGenesis
+		if err := json.Unmarshal([]byte(tx.Dados), &especificacao); err != nil {
+			return rejeitar(MotivoTransacaoMalformada, "especificação do gênesis")
+		}
+		e.emissores = make(map[string]bool)
+		for _, emissor := range especificacao.Emissores {
+			e.emissores[emissor] = true
+		}
+		e.oraculos = especificacao.Oraculos
+		e.chainID = especificacao.ChainID
+		e.Parametros = especificacao.parametros()
+		for usuario, valor := range especificacao.Saldos {
+			if err := e.creditar(usuario, valor, alteracoes); err != nil {
+				return err
+			}
+		}
+	case "ajustar_saldo":
+		var ajuste struct {
+			Usuario string  `json:"usuario"`
+			Valor   Quantia `json:"valor"`
+		}
+		if err := json.Unmarshal([]byte(tx.Dados), &ajuste); err != nil || ajuste.Usuario == "" {
+			return rejeitar(MotivoTransacaoMalformada, "ajuste de saldo")
+		}
+		if ajuste.Valor == 0 {
+			return rejeitar(MotivoValorInvalido, "ajuste de saldo com valor zero")
+		}
+		if ajuste.Valor > 0 && !e.podeCreditar(conta) {
+			return rejeitar(MotivoNaoAutorizado, "crédito na conta %s assinado por %s", ajuste.Usuario, conta)
+		}
+		if novo, err := e.Saldos[ajuste.Usuario].Somar(ajuste.Valor); err == nil && novo < 0 {
+			return rejeitar(MotivoSaldoInsuficiente, "conta %s ficaria com saldo negativo", ajuste.Usuario)
+		}
+		if err := e.creditar(ajuste.Usuario, ajuste.Valor, alteracoes); err != nil {
+			return err
+		}
+	case "criar_evento":
+		// O ID de um evento é a ordem em que a criação dele foi confirmada,
+		// para que criações assinadas ao mesmo tempo nunca colidam.
+		var evento Evento
+		if err := json.Unmarshal([]byte(tx.Dados), &evento); err != nil {
+			return rejeitar(MotivoTransacaoMalformada, "evento")
+		}
+		if err := e.validarNovoEvento(evento, instante); err != nil {
+			return err
+		}
+		// Sem resolvedores, quem cria resolve
+		evento.Criador = conta
+		if evento.Resolvedores == nil {
+			evento.Resolvedores = &Resolvedores{Tipo: ResolucaoChave, Chaves: []string{conta}}
+		}
+		if evento.Resolvedores != nil {
+			if err := e.validarResolvedores(evento.Resolvedores); err != nil {
+				return err
+			}
+		}
+		evento.ID = len(e.Eventos) + 1
+		if resolvidoPorVotacao(&evento) && evento.FechaApostas == "" {
+			return rejeitar(MotivoEventoInvalido, "votação começa no prazo das apostas, que é obrigatório")
+		}
+		evento.Categoria = normalizarCategoria(evento.Categoria)
+		evento.Situacao = SituacaoAberto
+		evento.Aprovacoes = nil
+		evento.Votacao = nil
+		evento.Apuracao = nil
+		evento.LiberaPremios = ""
+		evento.PremiosPagos = false
+		evento.Contestacao = nil
+		evento.Votos = make(map[string][]Aposta)
+		evento.Resultado = ""
+		evento.Premios = nil
+		e.Eventos[evento.ID] = &evento
+		alteracoes.eventosCriados++
+	case "apostar":
+		// A aposta debita o valor apostado na mesma transição de estado, então
+		// o saldo é conferido aqui e não só no handler HTTP.
+		var aposta Aposta
+		if err := json.Unmarshal([]byte(tx.Dados), &aposta); err != nil {
+			return rejeitar(MotivoTransacaoMalformada, "aposta")
+		}
+		evento, err := e.eventoComOpcao(aposta.EventoID, aposta.Opcao)
+		if err != nil {
+			return err
+		}
+		if err := exigirSituacao(evento, SituacaoAberto); err != nil {
+			return err
+		}
+		if aposta.Valor < e.Parametros.ApostaMinima {
+			return rejeitar(MotivoValorInvalido, "aposta mínima é %s", e.Parametros.ApostaMinima)
+		}
+		if e.Parametros.ApostaMaxima > 0 && aposta.Valor > e.Parametros.ApostaMaxima {
+			return rejeitar(MotivoValorInvalido, "aposta máxima é %s", e.Parametros.ApostaMaxima)
+		}
+		if e.Saldos[aposta.Usuario] < aposta.Valor {
+			return rejeitar(MotivoSaldoInsuficiente, "conta %s não tem %s para apostar", aposta.Usuario, aposta.Valor)
+		}
+		if err := e.creditar(aposta.Usuario, -aposta.Valor, alteracoes); err != nil {
+			return err
+		}
+		evento.Votos[aposta.Opcao] = append(evento.Votos[aposta.Opcao], aposta)
+		alteracoes.apostas = append(alteracoes.apostas, apostaAplicada{aposta.EventoID, aposta.Opcao})
+	case "votar":
+		var voto Voto
+		if err := json.Unmarshal([]byte(tx.Dados), &voto); err != nil {
+			return rejeitar(MotivoTransacaoMalformada, "voto")
+		}
+		if voto.PropostaID != 0 {
+			if err := e.votarProposta(voto.PropostaID, conta, voto.Opcao, e.Altura(), alteracoes); err != nil {
+				return err
+			}
+			break
+		}
+		evento, err := e.eventoComOpcao(voto.EventoID, voto.Opcao)
+		if err != nil {
+			return err
+		}
+		// Com o resultado contestado, o voto vale para a apelação
+		if evento.Situacao == SituacaoDisputado {
+			if err := e.votarApelacao(evento, conta, voto.Opcao, instante, alteracoes); err != nil {
+				return err
+			}
+			break
+		}
+		if resolvidoPorVotacao(evento) {
+			if err := e.votar(evento, conta, voto.Opcao, instante, alteracoes); err != nil {
+				return err
+			}
+			break
+		}
+		// Nos demais eventos o voto é só uma manifestação, que não decide o
+		// resultado e pode ser trocada até o prazo das apostas
+		if err := exigirSituacao(evento, SituacaoAberto); err != nil {
+			return err
+		}
+		e.registrarVoto(evento, conta, voto.Opcao, alteracoes)
+	case "concluir_evento":
+		var conclusao struct {
+			EventoID       int    `json:"evento_id"`
+			OpcaoVencedora string `json:"opcao_vencedora"`
+		}
+		if err := json.Unmarshal([]byte(tx.Dados), &conclusao); err != nil {
+			return rejeitar(MotivoTransacaoMalformada, "conclusão de evento")
+		}
+		evento, err := e.eventoComOpcao(conclusao.EventoID, conclusao.OpcaoVencedora)
+		if err != nil {
+			return err
+		}
+		// Com prazo, o resultado só sai depois que as apostas fecham
+		permitidas := []SituacaoEvento{SituacaoTravado}
+		if evento.FechaApostas == "" {
+			permitidas = append(permitidas, SituacaoAberto)
+		}
+		if err := exigirSituacao(evento, permitidas...); err != nil {
+			return err
+		}
+		decidido, err := e.decidir(evento, conta, conclusao.OpcaoVencedora, alteracoes)
+		if err != nil {
+			return err
+		}
+		if decidido {
+			if err := e.caucionarResolucao(evento, conta, alteracoes); err != nil {
+				return err
+			}
+			if err := e.liquidar(evento, conclusao.OpcaoVencedora, instante, alteracoes); err != nil {
+				return err
+			}
+		}
+	case "contestar_evento":
+		var contestacao struct {
+			EventoID int    `json:"evento_id"`
+			Opcao    string `json:"opcao"`
+		}
+		if err := json.Unmarshal([]byte(tx.Dados), &contestacao); err != nil {
+			return rejeitar(MotivoTransacaoMalformada, "contestação de evento")
+		}
+		evento, err := e.eventoComOpcao(contestacao.EventoID, contestacao.Opcao)
+		if err != nil {
+			return err
+		}
+		if err := e.contestar(evento, conta, contestacao.Opcao, instante, alteracoes); err != nil {
+			return err
+		}
+	case "propor_parametros":
+		var proposta Proposta
+		if err := json.Unmarshal([]byte(tx.Dados), &proposta); err != nil {
+			return rejeitar(MotivoTransacaoMalformada, "proposta")
+		}
+		if err := e.propor(proposta, conta, e.Altura(), alteracoes); err != nil {
+			return err
+		}
+	case "delegar":
+		var delegacao Delegacao
+		if err := json.Unmarshal([]byte(tx.Dados), &delegacao); err != nil {
+			return rejeitar(MotivoTransacaoMalformada, "delegação")
+		}
+		if err := e.delegar(conta, delegacao, alteracoes); err != nil {
+			return err
+		}
+	case "cancelar_evento":
+		var cancelamento struct {
+			EventoID int `json:"evento_id"`
+		}
+		if err := json.Unmarshal([]byte(tx.Dados), &cancelamento); err != nil {
+			return rejeitar(MotivoTransacaoMalformada, "cancelamento de evento")
+		}
+		evento, existe := e.Eventos[cancelamento.EventoID]
+		if !existe {
+			return rejeitar(MotivoEventoInexistente, "evento %d não existe", cancelamento.EventoID)
+		}
+		if err := exigirSituacao(evento, SituacaoAberto, SituacaoTravado); err != nil {
+			return err
+		}
+		decidido, err := e.decidir(evento, conta, decisaoCancelar, alteracoes)
+		if err != nil {
+			return err
+		}
+		if decidido {
+			if err := e.cancelar(evento, alteracoes); err != nil {
+				return err
+			}
+		}
+	default:
+		// Um tipo desconhecido não mudaria nada, mas ainda gastaria o nonce
+		return rejeitar(MotivoTransacaoMalformada, "tipo de transação %q desconhecido", tx.Tipo)
+	}
+	if assinada {
+		if _, registrado := alteracoes.nonces[conta]; !registrado {
+			anterior, existia := e.Nonces[conta]
+			alteracoes.nonces[conta] = nonceAnterior{anterior, existia}
+		}
+		e.Nonces[conta] = tx.Nonce + 1
+	}
+	return nil
+}
+
+// creditar soma valor (que pode ser negativo) ao saldo do usuário,
+// registrando o saldo anterior em alteracoes.
+func (e *EstadoMundo) creditar(usuario string, valor Quantia, alteracoes *alteracoesBloco) *ErroValidacao {
+	novo, err := e.Saldos[usuario].Somar(valor)
+	if err != nil {
+		return rejeitar(MotivoValorInvalido, "saldo da conta %s: %v", usuario, err)
+	}
+	if _, registrado := alteracoes.saldos[usuario]; !registrado {
+		anterior, existia := e.Saldos[usuario]
+		alteracoes.saldos[usuario] = valorAnterior{anterior, existia}
+	}
+	e.Saldos[usuario] = novo
+	return nil
+}
+
+// pagar credita os prêmios de uma liquidação, todos ou nenhum.
+func (e *EstadoMundo) pagar(premios map[string]Quantia, alteracoes *alteracoesBloco) *ErroValidacao {
+	for usuario, valor := range premios {
+		if _, err := e.Saldos[usuario].Somar(valor); err != nil {
+			return rejeitar(MotivoValorInvalido, "saldo da conta %s: %v", usuario, err)
+		}
+	}
+	for usuario, valor := range premios {
+		e.creditar(usuario, valor, alteracoes)
+	}
+	return nil
+}
+
+// podeCreditar diz se assinante pode creditar saldo em uma conta: só os
+// emissores da rede. Sem emissores, o saldo só vem do gênesis; se o dono
+// pudesse creditar a própria conta, cunharia o peso que quiser nas votações.
+func (e *EstadoMundo) podeCreditar(assinante string) bool {
+	return e.emissores[assinante]
+}
+
+func (e *EstadoMundo) validarNovoEvento(evento Evento, instante time.Time) *ErroValidacao {
+	if evento.Nome == "" || len(evento.Opcoes) < e.Parametros.OpcoesMinimas {
+		return rejeitar(MotivoEventoInvalido, "evento precisa de nome e pelo menos %d opções", e.Parametros.OpcoesMinimas)
+	}
+	vistas := make(map[string]bool)
+	for _, opcao := range evento.Opcoes {
+		if opcao == "" || vistas[opcao] {
+			return rejeitar(MotivoEventoInvalido, "opção %q vazia ou repetida", opcao)
+		}
+		vistas[opcao] = true
+	}
+	if evento.FechaApostas != "" {
+		prazo, err := time.Parse(time.RFC3339, evento.FechaApostas)
+		if err != nil {
+			return rejeitar(MotivoEventoInvalido, "prazo de apostas %q não está em RFC 3339", evento.FechaApostas)
+		}
+		if !prazo.After(instante) {
+			return rejeitar(MotivoEventoInvalido, "prazo de apostas %s já passou", evento.FechaApostas)
+		}
+	}
+	return nil
+}
+
+// eventoComOpcao devolve o evento se ele existir e tiver a opção informada.
+func (e *EstadoMundo) eventoComOpcao(id int, opcao string) (*Evento, *ErroValidacao) {
+	evento, existe := e.Eventos[id]
+	if !existe {
+		return nil, rejeitar(MotivoEventoInexistente, "evento %d não existe", id)
+	}
+	for _, op := range evento.Opcoes {
+		if op == opcao {
+			return evento, nil
+		}
+	}
+	return nil, rejeitar(MotivoOpcaoInvalida, "opção %q não existe no evento %d", opcao, id)
+}
+
+// premiosParimutuel devolve quanto cada apostador recebe na liquidação. Os
+// vencedores recebem o valor apostado de volta mais uma parte do que foi
+// apostado nas outras opções, proporcional ao que apostaram; a divisão segue
+// dividirProporcional, então os centavos que sobram vão às apostas vencedoras
+// mais antigas e o total pago é sempre igual ao total apostado. Se ninguém
+// apostou na opção vencedora, todas as apostas são devolvidas.
+func premiosParimutuel(evento *Evento, vencedora string) (map[string]Quantia, error) {
+	var totalPerdedor Quantia
+	var vencedoras []Aposta
+	var pesos []Quantia
+	for _, opcao := range evento.Opcoes {
+		for _, aposta := range evento.Votos[opcao] {
+			if opcao == vencedora {
+				vencedoras = append(vencedoras, aposta)
+				pesos = append(pesos, aposta.Valor)
+				continue
+			}
+			var err error
+			if totalPerdedor, err = totalPerdedor.Somar(aposta.Valor); err != nil {
+				return nil, err
+			}
+		}
+	}
+	premios := make(map[string]Quantia)
+	pagar := func(usuario string, valor Quantia) error {
+		total, err := premios[usuario].Somar(valor)
+		premios[usuario] = total
+		return err
+	}
+	if len(vencedoras) == 0 {
+		for _, opcao := range evento.Opcoes {
+			for _, aposta := range evento.Votos[opcao] {
+				if err := pagar(aposta.Usuario, aposta.Valor); err != nil {
+					return nil, err
+				}
+			}
+		}
+		return premios, nil
+	}
+	partes, err := dividirProporcional(totalPerdedor, pesos)
+	if err != nil {
+		return nil, err
+	}
+	for i, aposta := range vencedoras {
+		premio, err := aposta.Valor.Somar(partes[i])
+		if err != nil {
+			return nil, err
+		}
+		if err := pagar(aposta.Usuario, premio); err != nil {
+			return nil, err
+		}
+	}
+	return premios, nil
+}
+
+// Simular aplica as transações em ordem, como num bloco com o timestamp
+// instante, e devolve as que seriam aceitas e as que falharam por outro motivo
+// que não um nonce adiantado. O estado volta ao que era antes da chamada.
+func (e *EstadoMundo) Simular(transacoes []Transacao, instante time.Time, max int) (aceitas []Transacao, recusadas []Transacao) {
+	alteracoes := novasAlteracoes()
+	e.governar(e.Altura(), &alteracoes)
+	e.avancarEventos(instante, &alteracoes)
+	for _, tx := range transacoes {
+		if len(aceitas) == max {
+			break
+		}
+		if tx.Nonce > e.Nonces[remetente(tx)] {
+			// Espera as transações anteriores da mesma conta
+			continue
+		}
+		if err := e.aplicarTransacao(tx, instante, &alteracoes); err != nil {
+			recusadas = append(recusadas, tx)
+			continue
+		}
+		aceitas = append(aceitas, tx)
+	}
+	e.desfazer = append(e.desfazer, alteracoes)
+	e.Desfazer()
+	return aceitas, recusadas
+}
+
+// Desfazer reverte o último bloco aplicado.
+func (e *EstadoMundo) Desfazer() {
+	if len(e.desfazer) == 0 {
+		return
+	}
+	alteracoes := e.desfazer[len(e.desfazer)-1]
+	e.desfazer = e.desfazer[:len(e.desfazer)-1]
+	for i := len(alteracoes.delegacoes) - 1; i >= 0; i-- {
+		anterior := alteracoes.delegacoes[i]
+		e.definirDelegacao(anterior.conta, anterior.categoria, anterior.delegado, anterior.existia)
+	}
+	for i := len(alteracoes.propostas) - 1; i >= 0; i-- {
+		anterior := alteracoes.propostas[i]
+		*e.Propostas[anterior.id] = anterior.proposta
+	}
+	for i := 0; i < alteracoes.propostasCriadas; i++ {
+		delete(e.Propostas, len(e.Propostas))
+	}
+	if alteracoes.parametros != nil {
+		e.Parametros = *alteracoes.parametros
+	}
+	for i := len(alteracoes.eventos) - 1; i >= 0; i-- {
+		anterior := alteracoes.eventos[i]
+		*e.Eventos[anterior.id] = anterior.evento
+	}
+	for i := len(alteracoes.apostas) - 1; i >= 0; i-- {
+		aposta := alteracoes.apostas[i]
+		votos := e.Eventos[aposta.eventoID].Votos
+		votos[aposta.opcao] = votos[aposta.opcao][:len(votos[aposta.opcao])-1]
+		if len(votos[aposta.opcao]) == 0 {
+			delete(votos, aposta.opcao)
+		}
+	}
+	for i := 0; i < alteracoes.eventosCriados; i++ {
+		delete(e.Eventos, len(e.Eventos))
+	}
+	for usuario, anterior := range alteracoes.saldos {
+		if anterior.existia {
+			e.Saldos[usuario] = anterior.valor
+		} else {
+			delete(e.Saldos, usuario)
+		}
+	}
+	for conta, anterior := range alteracoes.nonces {
+		if anterior.existia {
+			e.Nonces[conta] = anterior.valor
+		} else {
+			delete(e.Nonces, conta)
+		}
+	}
+}
+
+// Altura devolve quantos blocos foram aplicados.
+func (e *EstadoMundo) Altura() int {
+	return len(e.desfazer)
+}
+
+// Evento devolve uma cópia do evento, que pode ser usada sem bc.mu travado.
+func (e *EstadoMundo) Evento(id int) (Evento, bool) {
+	evento, existe := e.Eventos[id]
+	if !existe {
+		return Evento{}, false
+	}
+	copia := *evento
+	copia.Votos = make(map[string][]Aposta, len(evento.Votos))
+	for opcao, apostas := range evento.Votos {
+		copia.Votos[opcao] = append([]Aposta(nil), apostas...)
+	}
+	return copia, true
+}
+
+// estadoDaCadeia reconstrói o estado do zero a partir dos blocos, validando
+// cada um deles.
+func estadoDaCadeia(blocos []Bloco) (*EstadoMundo, error) {
+	estado := NovoEstadoMundo()
+	for _, bloco := range blocos {
+		if err := estado.Aplicar(bloco); err != nil {
+			return estado, err
+		}
+	}
+	return estado, nil
+}
+
+// VerificarEstado reconstrói o estado a partir da cadeia principal e compara
+// com o estado mantido incrementalmente.
+func (bc *Blockchain) VerificarEstado() error {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	reconstruido, err := estadoDaCadeia(bc.Blocos)
+	if err != nil {
+		return err
+	}
+	if bc.estado.Altura() != len(bc.Blocos) {
+		return fmt.Errorf("estado aplicado até a altura %d, cadeia tem %d blocos", bc.estado.Altura(), len(bc.Blocos))
+	}
+	if !reflect.DeepEqual(bc.estado.Saldos, reconstruido.Saldos) {
+		return fmt.Errorf("saldos divergem do estado reconstruído")
+	}
+	if !reflect.DeepEqual(bc.estado.Nonces, reconstruido.Nonces) {
+		return fmt.Errorf("nonces divergem do estado reconstruído")
+	}
+	if !reflect.DeepEqual(bc.estado.Eventos, reconstruido.Eventos) {
+		return fmt.Errorf("eventos divergem do estado reconstruído")
+	}
+	if !reflect.DeepEqual(bc.estado.Propostas, reconstruido.Propostas) || bc.estado.Parametros != reconstruido.Parametros {
+		return fmt.Errorf("governança diverge do estado reconstruído")
+	}
+	if !reflect.DeepEqual(bc.estado.Delegacoes, reconstruido.Delegacoes) {
+		return fmt.Errorf("delegações divergem do estado reconstruído")
+	}
+	return nil
+}
+
+func (bc *Blockchain) HandleVerificarEstado(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	if r.Method == "OPTIONS" {
+		return
+	}
+	if err := bc.VerificarEstado(); err != nil {
+		http.Error(w, fmt.Sprintf("Estado inconsistente: %v", err), http.StatusInternalServerError)
+		return
+	}
+	w.Write([]byte("Estado consistente com a blockchain."))
+}
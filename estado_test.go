@@ -0,0 +1,143 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// Testa que o estado é desfeito e refeito numa reorganização e continua igual ao reconstruído do zero
+func TestEstadoAcompanhaReorganizacao(t *testing.T) {
+	organizador, _ := NovaCarteira()
+	carteira, _ := NovaCarteira()
+	alice, _ := NovaCarteira()
+	saldos := map[*Carteira]Quantia{organizador: Reais(10), carteira: Reais(50), alice: Reais(7)}
+	a := novoBlockchainComSaldos(t, saldos)
+	b := novoBlockchainComSaldos(t, saldos)
+	a.AdicionarTransacao(transacaoAssinada(t, organizador, 0, "criar_evento", Evento{Nome: "Final", Opcoes: []string{"X", "Y"}}))
+	incorporar(t, b, a.Blocos)
+
+	b.AdicionarTransacao(transacaoAssinada(t, carteira, 0, "apostar", Aposta{Usuario: carteira.Endereco, Valor: Reais(10), EventoID: 1, Opcao: "X"}))
+	b.AdicionarBloco("criar_evento", Evento{Nome: "Só no ramo B", Opcoes: []string{"1", "2"}})
+	if err := b.VerificarEstado(); err != nil {
+		t.Fatal(err)
+	}
+
+	a.AdicionarTransacao(transacaoAssinada(t, alice, 0, "ajustar_saldo", map[string]interface{}{"usuario": alice.Endereco, "valor": -2.0}))
+	a.AdicionarTransacao(transacaoAssinada(t, organizador, 1, "concluir_evento", map[string]interface{}{"evento_id": 1, "opcao_vencedora": "Y"}))
+	a.AdicionarRegistro("Vazio")
+	a.AdicionarRegistro("Vazio")
+	incorporar(t, b, a.Blocos)
+
+	if b.Blocos[len(b.Blocos)-1].HashAtual != a.Blocos[len(a.Blocos)-1].HashAtual {
+		t.Fatal("Nó deveria adotar o ramo com mais trabalho")
+	}
+	if err := b.VerificarEstado(); err != nil {
+		t.Fatal(err)
+	}
+	if b.CalcularSaldo(carteira.Endereco) != Reais(50) || b.CalcularSaldo(alice.Endereco) != Reais(5) {
+		t.Errorf("Saldos do ramo desfeito não deveriam permanecer: %v", b.estado.Saldos)
+	}
+	if b.estado.Nonces[carteira.Endereco] != 0 {
+		t.Errorf("Nonce da aposta desfeita não deveria permanecer")
+	}
+	evento, _ := b.estado.Evento(1)
+	if len(b.estado.Eventos) != 1 || len(evento.Votos) != 0 || evento.Resultado != "Y" {
+		t.Errorf("Eventos deveriam refletir o ramo A, obtido %+v", b.estado.Eventos)
+	}
+}
+
+// minerarSobrePonta monta e minera um bloco sobre a ponta sem passar pelas verificações do nó, como faria um peer.
+func minerarSobrePonta(bc *Blockchain, transacoes ...Transacao) Bloco {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	pai := bc.ponta.bloco
+	dificuldade, _ := bc.dificuldadeEsperada(bc.ponta)
+	bloco := Bloco{
+		Versao:       versaoCabecalhoAtual,
+		ChainID:      bc.genesis.ChainID,
+		Indice:       pai.Indice + 1,
+		Timestamp:    timestampCanonico(pai),
+		Evento:       "transacoes",
+		HashAnterior: pai.HashAtual,
+		Dificuldade:  dificuldade,
+		RaizMerkle:   raizMerkle(idsTransacoes(transacoes)),
+		Transacoes:   transacoes,
+	}
+	bloco.Nonce, bloco.HashAtual = provaDeTrabalho(bloco, bloco.Dificuldade)
+	return bloco
+}
+
+// Testa que um bloco de peer com apostas que somadas passam do saldo é rejeitado
+func TestApostasAcimaDoSaldoRejeitadas(t *testing.T) {
+	carteira, _ := NovaCarteira()
+	bc := novoBlockchainComSaldos(t, map[*Carteira]Quantia{carteira: Reais(100)})
+	bc.AdicionarBloco("criar_evento", Evento{Nome: "Final", Opcoes: []string{"X", "Y"}})
+
+	primeira := transacaoAssinada(t, carteira, 0, "apostar", Aposta{Usuario: carteira.Endereco, Valor: Reais(60), EventoID: 1, Opcao: "X"})
+	segunda := transacaoAssinada(t, carteira, 1, "apostar", Aposta{Usuario: carteira.Endereco, Valor: Reais(60), EventoID: 1, Opcao: "Y"})
+	bloco := minerarSobrePonta(bc, primeira, segunda)
+
+	bc.mu.Lock()
+	err := bc.inserirBloco(bloco)
+	bc.mu.Unlock()
+	if err == nil {
+		t.Fatal("Bloco com apostas acima do saldo deveria ser rejeitado")
+	}
+	if len(bc.Blocos) != 2 || bc.CalcularSaldo(carteira.Endereco) != Reais(100) {
+		t.Errorf("Cadeia e saldo não deveriam mudar, obtido %d blocos e saldo %s", len(bc.Blocos), bc.CalcularSaldo(carteira.Endereco))
+	}
+	if err := bc.VerificarEstado(); err != nil {
+		t.Error(err)
+	}
+
+	bc.AdicionarTransacao(primeira)
+	if bc.CalcularSaldo(carteira.Endereco) != Reais(40) {
+		t.Errorf("Aposta deveria debitar o saldo na mesma transação, saldo %s", bc.CalcularSaldo(carteira.Endereco))
+	}
+}
+
+// Testa que a liquidação devolve o valor apostado, distribui os centavos que sobram e paga exatamente o total apostado
+func TestLiquidacaoParimutuel(t *testing.T) {
+	evento := &Evento{Opcoes: []string{"X", "Y", "Z"}, Votos: map[string][]Aposta{
+		"X": {{Usuario: "ana", Valor: Reais(1)}, {Usuario: "bia", Valor: Reais(1)}, {Usuario: "caio", Valor: Reais(1)}},
+		"Y": {{Usuario: "davi", Valor: Reais(1)}},
+	}}
+	premios, err := premiosParimutuel(evento, "X")
+	if err != nil {
+		t.Fatal(err)
+	}
+	esperado := map[string]Quantia{"ana": 134, "bia": 133, "caio": 133}
+	if !reflect.DeepEqual(premios, esperado) {
+		t.Errorf("Prêmios esperados %v, obtidos %v", esperado, premios)
+	}
+
+	// Ninguém apostou em Z: todos recebem o que apostaram
+	devolvidos, _ := premiosParimutuel(evento, "Z")
+	if len(devolvidos) != 4 || devolvidos["davi"] != Reais(1) || devolvidos["ana"] != Reais(1) {
+		t.Errorf("Apostas deveriam ser devolvidas, obtido %v", devolvidos)
+	}
+}
+
+// Testa que a conclusão confirmada calcula os mesmos prêmios em todos os nós e os retém durante o período de contestação
+func TestConclusaoLiquidaEvento(t *testing.T) {
+	alice, _ := NovaCarteira()
+	bob, _ := NovaCarteira()
+	organizador, _ := NovaCarteira()
+	saldos := map[*Carteira]Quantia{alice: Reais(30), bob: Reais(10), organizador: Reais(10)}
+	bc := novoBlockchainComSaldos(t, saldos)
+	bc.AdicionarTransacao(transacaoAssinada(t, organizador, 0, "criar_evento", Evento{Nome: "Final", Opcoes: []string{"X", "Y"}}))
+	bc.AdicionarTransacao(transacaoAssinada(t, alice, 0, "apostar", Aposta{Usuario: alice.Endereco, Valor: Reais(30), EventoID: 1, Opcao: "X"}))
+	bc.AdicionarTransacao(transacaoAssinada(t, bob, 0, "apostar", Aposta{Usuario: bob.Endereco, Valor: Reais(10), EventoID: 1, Opcao: "Y"}))
+	bc.AdicionarTransacao(transacaoAssinada(t, organizador, 1, "concluir_evento", map[string]interface{}{"evento_id": 1, "opcao_vencedora": "Y"}))
+
+	outro := novoBlockchainComSaldos(t, saldos)
+	incorporar(t, outro, bc.Blocos)
+	for _, no := range []*Blockchain{bc, outro} {
+		if no.CalcularSaldo(bob.Endereco) != Reais(0) || no.CalcularSaldo(alice.Endereco) != Reais(0) {
+			t.Errorf("Prêmios não deveriam ser creditados antes do fim da contestação, obtidos %s e %s", no.CalcularSaldo(bob.Endereco), no.CalcularSaldo(alice.Endereco))
+		}
+		if evento, _ := no.estado.Evento(1); evento.Premios[bob.Endereco] != Reais(40) || evento.PremiosPagos || evento.LiberaPremios == "" {
+			t.Errorf("Evento deveria registrar o prêmio retido, obtido %+v", evento)
+		}
+	}
+}
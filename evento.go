@@ -0,0 +1,155 @@
+package main
+
+import (
+	"time"
+)
+
+// SituacaoEvento é a fase do ciclo de vida de um evento:
+//
+//	aberto -> travado -> resolvido
+//	   \         \
+//	    +---------+----> cancelado
+//
+// Um evento aberto aceita apostas até o prazo FechaApostas; o primeiro bloco
+// com timestamp igual ou posterior ao prazo trava o evento. Só um evento
+// travado (ou aberto sem prazo, como os criados antes do prazo existir) pode
+// ser resolvido. Cancelar devolve todas as apostas.
+//
+// Os prêmios de um evento resolvido ficam retidos durante o período de
+// contestação; uma contestação leva o evento a disputado até a apelação
+// decidir (ver contestacao.go):
+//
+//	resolvido -> disputado -> resolvido (mantido ou revertido)
+//	                  \
+//	                   +----> cancelado (apelação inconclusiva)
+type SituacaoEvento string
+
+const (
+	SituacaoAberto    SituacaoEvento = "aberto"
+	SituacaoTravado   SituacaoEvento = "travado"
+	SituacaoResolvido SituacaoEvento = "resolvido"
+	SituacaoCancelado SituacaoEvento = "cancelado"
+	SituacaoDisputado SituacaoEvento = "disputado"
+)
+
+// motivoSituacao diz por que uma transação foi recusada quando o evento não
+// está numa das situações permitidas para ela.
+var motivoSituacao = map[SituacaoEvento]MotivoRejeicao{
+	SituacaoAberto:    MotivoApostasAbertas,
+	SituacaoTravado:   MotivoApostasEncerradas,
+	SituacaoResolvido: MotivoEventoConcluido,
+	SituacaoCancelado: MotivoEventoCancelado,
+	SituacaoDisputado: MotivoEventoDisputado,
+}
+
+// eventoAnterior guarda o evento como estava antes de uma transação. Os mapas
+// e ponteiros do evento nunca são alterados no lugar, só substituídos, então
+// basta uma cópia rasa. A exceção são as apostas em Votos, desfeitas à parte.
+type eventoAnterior struct {
+	id     int
+	evento Evento
+}
+
+// registrarEvento guarda o estado atual do evento para Desfazer.
+func (e *EstadoMundo) registrarEvento(evento *Evento, alteracoes *alteracoesBloco) {
+	alteracoes.eventos = append(alteracoes.eventos, eventoAnterior{evento.ID, *evento})
+}
+
+// mudarSituacao registra o estado anterior do evento e muda a situação dele.
+func (e *EstadoMundo) mudarSituacao(evento *Evento, situacao SituacaoEvento, alteracoes *alteracoesBloco) {
+	e.registrarEvento(evento, alteracoes)
+	evento.Situacao = situacao
+}
+
+// avancarEventos aplica o que depende só do relógio, antes das transações do
+// bloco: trava as apostas vencidas, apura as votações e apelações encerradas e
+// paga os prêmios cujo período de contestação terminou.
+func (e *EstadoMundo) avancarEventos(instante time.Time, alteracoes *alteracoesBloco) {
+	e.travarEventos(instante, alteracoes)
+	e.apurarVotacoes(instante, alteracoes)
+	e.encerrarApelacoes(instante, alteracoes)
+	e.liberarPremios(instante, alteracoes)
+}
+
+// travarEventos trava os eventos abertos cujo prazo de apostas já passou no
+// instante do bloco.
+func (e *EstadoMundo) travarEventos(instante time.Time, alteracoes *alteracoesBloco) {
+	for id := 1; id <= len(e.Eventos); id++ {
+		evento := e.Eventos[id]
+		if evento.Situacao == SituacaoAberto && prazoEncerrado(evento, instante) {
+			e.mudarSituacao(evento, SituacaoTravado, alteracoes)
+		}
+	}
+}
+
+func prazoEncerrado(evento *Evento, instante time.Time) bool {
+	if evento.FechaApostas == "" {
+		return false
+	}
+	prazo, err := time.Parse(time.RFC3339, evento.FechaApostas)
+	return err == nil && !instante.Before(prazo)
+}
+
+// exigirSituacao recusa a transação se o evento não estiver numa das
+// situações permitidas.
+func exigirSituacao(evento *Evento, permitidas ...SituacaoEvento) *ErroValidacao {
+	for _, situacao := range permitidas {
+		if evento.Situacao == situacao {
+			return nil
+		}
+	}
+	return rejeitar(motivoSituacao[evento.Situacao], "evento %d está %s", evento.ID, evento.Situacao)
+}
+
+// liquidar conclui o evento com a opção vencedora no instante do bloco. Todos
+// os nós calculam os mesmos prêmios a partir das apostas confirmadas; eles só
+// são pagos depois do período de contestação, por liberarPremios.
+func (e *EstadoMundo) liquidar(evento *Evento, vencedora string, instante time.Time, alteracoes *alteracoesBloco) *ErroValidacao {
+	premios, err := premiosParimutuel(evento, vencedora)
+	if err != nil {
+		return rejeitar(MotivoValorInvalido, "prêmios do evento %d: %v", evento.ID, err)
+	}
+	libera := instante.Add(time.Duration(e.Parametros.PeriodoContestacao) * time.Second)
+	e.mudarSituacao(evento, SituacaoResolvido, alteracoes)
+	evento.Resultado = vencedora
+	evento.Premios = premios
+	evento.LiberaPremios = libera.Format(time.RFC3339)
+	return nil
+}
+
+// cancelar devolve todas as apostas e cancela o evento.
+func (e *EstadoMundo) cancelar(evento *Evento, alteracoes *alteracoesBloco) *ErroValidacao {
+	premios, err := devolucoes(evento)
+	if err != nil {
+		return rejeitar(MotivoValorInvalido, "devoluções do evento %d: %v", evento.ID, err)
+	}
+	if err := e.pagar(premios, alteracoes); err != nil {
+		return err
+	}
+	e.mudarSituacao(evento, SituacaoCancelado, alteracoes)
+	evento.Premios = premios
+	evento.PremiosPagos = true
+	return nil
+}
+
+// devolucoes devolve a cada apostador o total que apostou no evento.
+func devolucoes(evento *Evento) (map[string]Quantia, error) {
+	premios := make(map[string]Quantia)
+	for _, opcao := range evento.Opcoes {
+		for _, aposta := range evento.Votos[opcao] {
+			total, err := premios[aposta.Usuario].Somar(aposta.Valor)
+			if err != nil {
+				return nil, err
+			}
+			premios[aposta.Usuario] = total
+		}
+	}
+	return premios, nil
+}
+
+// instanteDoBloco é o relógio usado pelas regras de prazo: o timestamp do
+// bloco, igual em todos os nós.
+func instanteDoBloco(bloco Bloco) time.Time {
+	instante, _ := time.Parse(time.RFC3339, bloco.Timestamp)
+	return instante
+}
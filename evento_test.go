@@ -0,0 +1,139 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// blocoEm monta um bloco só com o que o estado usa: timestamp e transações.
+func blocoEm(instante time.Time, transacoes ...Transacao) Bloco {
+	return Bloco{Timestamp: instante.UTC().Format(time.RFC3339), Transacoes: transacoes}
+}
+
+// Testa que o prazo trava o evento: apostas depois dele são recusadas e a conclusão só vale depois dele
+func TestPrazoDeApostasTravaEvento(t *testing.T) {
+	alice, _ := NovaCarteira()
+	bob, _ := NovaCarteira()
+	estado := estadoComSaldos(t, map[*Carteira]Quantia{alice: Reais(40), bob: Reais(10)})
+	inicio := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	prazo := inicio.Add(time.Hour).Format(time.RFC3339)
+	if err := estado.Aplicar(blocoEm(inicio,
+		transacaoAssinada(t, alice, 0, "criar_evento", Evento{Nome: "Final", Opcoes: []string{"X", "Y"}, FechaApostas: prazo}),
+		transacaoAssinada(t, alice, 1, "apostar", Aposta{Usuario: alice.Endereco, Valor: Reais(30), EventoID: 1, Opcao: "X"}),
+	)); err != nil {
+		t.Fatal(err)
+	}
+
+	vencido := transacaoAssinada(t, alice, 2, "criar_evento", Evento{Nome: "Antiga", Opcoes: []string{"X", "Y"}, FechaApostas: inicio.Format(time.RFC3339)})
+	if err := estado.Aplicar(blocoEm(inicio.Add(time.Minute), vencido)); motivoDe(err) != MotivoEventoInvalido {
+		t.Errorf("Evento com prazo vencido deveria ser recusado, obtido %v", err)
+	}
+	conclusao := transacaoAssinada(t, alice, 2, "concluir_evento", map[string]interface{}{"evento_id": 1, "opcao_vencedora": "X"})
+	if err := estado.Aplicar(blocoEm(inicio.Add(30*time.Minute), conclusao)); motivoDe(err) != MotivoApostasAbertas {
+		t.Errorf("Conclusão antes do prazo deveria ser recusada, obtido %v", err)
+	}
+	atrasada := transacaoAssinada(t, bob, 0, "apostar", Aposta{Usuario: bob.Endereco, Valor: Reais(10), EventoID: 1, Opcao: "Y"})
+	if err := estado.Aplicar(blocoEm(inicio.Add(time.Hour), atrasada)); motivoDe(err) != MotivoApostasEncerradas {
+		t.Errorf("Aposta no prazo deveria ser recusada, obtido %v", err)
+	}
+
+	if err := estado.Aplicar(blocoEm(inicio.Add(time.Hour), conclusao)); err != nil {
+		t.Fatal(err)
+	}
+	if evento, _ := estado.Evento(1); evento.Situacao != SituacaoResolvido || evento.Premios[alice.Endereco] != Reais(30) {
+		t.Errorf("Evento deveria estar resolvido com a aposta a devolver, obtido %+v", evento)
+	}
+	if err := estado.Aplicar(blocoEm(inicio.Add(2 * time.Hour))); err != nil {
+		t.Fatal(err)
+	}
+	if estado.Saldos[alice.Endereco] != Reais(40) {
+		t.Errorf("Aposta e caução de resolução deveriam ser devolvidas depois da contestação, obtido %s", estado.Saldos[alice.Endereco])
+	}
+	// Desfazer volta o evento para antes do travamento
+	estado.Desfazer()
+	estado.Desfazer()
+	if evento, _ := estado.Evento(1); evento.Situacao != SituacaoAberto || evento.Resultado != "" || evento.Premios != nil {
+		t.Errorf("Evento deveria voltar a aberto, obtido %+v", evento)
+	}
+}
+
+// Testa que o cancelamento devolve todas as apostas e encerra o evento
+func TestCancelamentoDevolveApostas(t *testing.T) {
+	alice, _ := NovaCarteira()
+	bob, _ := NovaCarteira()
+	estado := estadoComSaldos(t, map[*Carteira]Quantia{alice: Reais(30), bob: Reais(10)})
+	inicio := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	if err := estado.Aplicar(blocoEm(inicio,
+		transacaoAssinada(t, alice, 0, "criar_evento", Evento{Nome: "Final", Opcoes: []string{"X", "Y"}}),
+		transacaoAssinada(t, alice, 1, "apostar", Aposta{Usuario: alice.Endereco, Valor: Reais(20), EventoID: 1, Opcao: "X"}),
+		transacaoAssinada(t, alice, 2, "apostar", Aposta{Usuario: alice.Endereco, Valor: Reais(5), EventoID: 1, Opcao: "Y"}),
+		transacaoAssinada(t, bob, 0, "apostar", Aposta{Usuario: bob.Endereco, Valor: Reais(10), EventoID: 1, Opcao: "Y"}),
+	)); err != nil {
+		t.Fatal(err)
+	}
+
+	cancelamento := transacaoAssinada(t, alice, 3, "cancelar_evento", map[string]interface{}{"evento_id": 1})
+	if err := estado.Aplicar(blocoEm(inicio.Add(time.Minute), cancelamento)); err != nil {
+		t.Fatal(err)
+	}
+	if estado.Saldos[alice.Endereco] != Reais(30) || estado.Saldos[bob.Endereco] != Reais(10) {
+		t.Errorf("Apostas deveriam ser devolvidas, saldos %v", estado.Saldos)
+	}
+	evento, _ := estado.Evento(1)
+	if evento.Situacao != SituacaoCancelado || evento.Premios[alice.Endereco] != Reais(25) {
+		t.Errorf("Evento deveria estar cancelado com as devoluções registradas, obtido %+v", evento)
+	}
+
+	casos := map[string]Transacao{
+		"aposta":       transacaoAssinada(t, alice, 4, "apostar", Aposta{Usuario: alice.Endereco, Valor: Reais(1), EventoID: 1, Opcao: "X"}),
+		"conclusão":    transacaoAssinada(t, alice, 4, "concluir_evento", map[string]interface{}{"evento_id": 1, "opcao_vencedora": "X"}),
+		"cancelamento": transacaoAssinada(t, alice, 4, "cancelar_evento", map[string]interface{}{"evento_id": 1}),
+	}
+	for nome, tx := range casos {
+		if err := estado.Aplicar(blocoEm(inicio.Add(2*time.Minute), tx)); motivoDe(err) != MotivoEventoCancelado {
+			t.Errorf("%s depois do cancelamento: esperado %q, obtido %v", nome, MotivoEventoCancelado, err)
+		}
+	}
+
+	estado.Desfazer()
+	if estado.Saldos[alice.Endereco] != Reais(5) || estado.Saldos[bob.Endereco] != 0 {
+		t.Errorf("Desfazer o cancelamento deveria debitar as devoluções, saldos %v", estado.Saldos)
+	}
+	if evento, _ := estado.Evento(1); evento.Situacao != SituacaoAberto || evento.Premios != nil {
+		t.Errorf("Evento deveria voltar a aberto, obtido %+v", evento)
+	}
+}
+
+// Testa que cada conta tem um único voto por evento, trocado pelo último até o prazo das apostas
+func TestVotoUnicoAtePrazo(t *testing.T) {
+	estado := NovoEstadoMundo()
+	alice, _ := NovaCarteira()
+	bob, _ := NovaCarteira()
+	inicio := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	prazo := inicio.Add(time.Hour)
+	votar := func(carteira *Carteira, nonce uint64, opcao string) Transacao {
+		return transacaoAssinada(t, carteira, nonce, "votar", Voto{Usuario: carteira.Endereco, EventoID: 1, Opcao: opcao})
+	}
+	if err := estado.Aplicar(blocoEm(inicio,
+		transacaoAssinada(t, alice, 0, "criar_evento", Evento{Nome: "Final", Opcoes: []string{"X", "Y"}, FechaApostas: prazo.Format(time.RFC3339)}),
+		votar(alice, 1, "X"),
+		votar(bob, 0, "X"),
+		votar(bob, 1, "Y"),
+	)); err != nil {
+		t.Fatal(err)
+	}
+	if err := estado.Aplicar(blocoEm(inicio.Add(time.Minute), votar(alice, 2, "Y"))); err != nil {
+		t.Fatal(err)
+	}
+	evento, _ := estado.Evento(1)
+	if len(evento.Votacao) != 2 || evento.Votacao[alice.Endereco] != "Y" || evento.Votacao[bob.Endereco] != "Y" {
+		t.Fatalf("Deveria valer só o último voto de cada conta, obtido %v", evento.Votacao)
+	}
+	if err := estado.Aplicar(blocoEm(prazo, votar(alice, 3, "X"))); motivoDe(err) != MotivoApostasEncerradas {
+		t.Errorf("Voto depois do prazo deveria ser recusado, obtido %v", err)
+	}
+	estado.Desfazer()
+	if evento, _ := estado.Evento(1); evento.Votacao[alice.Endereco] != "X" {
+		t.Errorf("Desfazer deveria restaurar o voto anterior, obtido %v", evento.Votacao)
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// EspecificacaoGenesis descreve a rede: todos os nós que usam a mesma
+// especificação geram exatamente o mesmo bloco gênesis.
+type EspecificacaoGenesis struct {
+	ChainID           string             `json:"chain_id"`
+	Timestamp         string             `json:"timestamp"`
+	Dificuldade       int                `json:"dificuldade"`
+	IntervaloAjuste   int                `json:"intervalo_ajuste,omitempty"`
+	TempoAlvoBloco    int                `json:"tempo_alvo_bloco,omitempty"`
+	DificuldadeMinima int                `json:"dificuldade_minima,omitempty"`
+	DificuldadeMaxima int                `json:"dificuldade_maxima,omitempty"`
+	Saldos            map[string]Quantia `json:"saldos,omitempty"`
+	// Emissores são as contas que podem creditar saldo (depósitos). Sem
+	// emissores, ninguém deposita e os saldos vêm só de Saldos.
+	Emissores []string `json:"emissores,omitempty"`
+	// Oraculos dá nome a contas que podem ser escolhidas como resolvedoras
+	// de eventos (nome -> endereço).
+	Oraculos map[string]string `json:"oraculos,omitempty"`
+	// Contestação de resultados (ver parametros.go); zero usa o padrão.
+	PeriodoContestacao int     `json:"periodo_contestacao,omitempty"`
+	CaucaoContestacao  Quantia `json:"caucao_contestacao,omitempty"`
+	CaucaoResolucao    Quantia `json:"caucao_resolucao,omitempty"`
+	JanelaApelacao     int     `json:"janela_apelacao,omitempty"`
+	QuorumApelacao     int     `json:"quorum_apelacao,omitempty"`
+	MaioriaApelacao    int     `json:"maioria_apelacao,omitempty"`
+}
+
+var GenesisPadrao = EspecificacaoGenesis{
+	ChainID:     "pbl3-apostas",
+	Timestamp:   "2024-01-01T00:00:00Z",
+	Dificuldade: dificuldade,
+}
+
+func CarregarGenesis(caminho string) (EspecificacaoGenesis, error) {
+	dados, err := os.ReadFile(caminho)
+	if err != nil {
+		return EspecificacaoGenesis{}, fmt.Errorf("lendo especificação do gênesis: %w", err)
+	}
+	var especificacao EspecificacaoGenesis
+	if err := json.Unmarshal(dados, &especificacao); err != nil {
+		return EspecificacaoGenesis{}, fmt.Errorf("decodificando especificação do gênesis: %w", err)
+	}
+	if err := especificacao.Validar(); err != nil {
+		return EspecificacaoGenesis{}, err
+	}
+	return especificacao, nil
+}
+
+func (e EspecificacaoGenesis) Validar() error {
+	if e.ChainID == "" {
+		return fmt.Errorf("chain_id do gênesis é obrigatório")
+	}
+	if _, err := time.Parse(time.RFC3339, e.Timestamp); err != nil {
+		return fmt.Errorf("timestamp do gênesis inválido: %w", err)
+	}
+	if e.Dificuldade < 1 {
+		return fmt.Errorf("dificuldade do gênesis deve ser positiva")
+	}
+	if e.IntervaloAjuste < 0 || e.TempoAlvoBloco < 0 || e.DificuldadeMinima < 0 || e.DificuldadeMaxima < 0 {
+		return fmt.Errorf("parâmetros de ajuste de dificuldade não podem ser negativos")
+	}
+	if e.limitarDificuldade(e.Dificuldade) != e.Dificuldade {
+		return fmt.Errorf("dificuldade do gênesis fora do intervalo [%d, %d]", e.dificuldadeMinima(), e.dificuldadeMaxima())
+	}
+	if e.PeriodoContestacao < 0 || e.CaucaoContestacao < 0 || e.CaucaoResolucao < 0 || e.JanelaApelacao < 0 || e.QuorumApelacao < 0 || e.MaioriaApelacao < 0 {
+		return fmt.Errorf("parâmetros de contestação não podem ser negativos")
+	}
+	if err := e.parametros().Validar(); err != nil {
+		return err
+	}
+	for _, emissor := range e.Emissores {
+		if emissor == "" {
+			return fmt.Errorf("endereço de emissor vazio")
+		}
+	}
+	for nome, endereco := range e.Oraculos {
+		if nome == "" || !enderecoValido(endereco) {
+			return fmt.Errorf("oráculo %q com endereço inválido", nome)
+		}
+	}
+	for usuario, valor := range e.Saldos {
+		if usuario == "" || valor < 0 {
+			return fmt.Errorf("saldo inicial inválido para %q", usuario)
+		}
+	}
+	return nil
+}
+
+// Bloco monta o bloco gênesis. O Resultado carrega a própria especificação,
+// então o hash muda se qualquer campo (inclusive os saldos) mudar.
+func (e EspecificacaoGenesis) Bloco() Bloco {
+	resultado, _ := json.Marshal(e)
+	bloco := Bloco{
+		Indice:       0,
+		Timestamp:    e.Timestamp,
+		Evento:       "genesis",
+		Resultado:    string(resultado),
+		HashAnterior: "",
+		Nonce:        0,
+		Dificuldade:  e.Dificuldade,
+	}
+	bloco.HashAtual = calculaHash(bloco)
+	return bloco
+}
@@ -0,0 +1,48 @@
+package main
+
+import "testing"
+
+// Testa que nós independentes geram o mesmo gênesis
+func TestGenesisDeterministico(t *testing.T) {
+	bc1 := NovoBlockchain(nil)
+	bc2 := NovoBlockchain(nil)
+	if bc1.Blocos[0].HashAtual != bc2.Blocos[0].HashAtual {
+		t.Fatalf("Gênesis diferentes: %s != %s", bc1.Blocos[0].HashAtual, bc2.Blocos[0].HashAtual)
+	}
+
+	bc2.AdicionarRegistro("Evento1")
+	if !bc1.ValidarNovaBlockchain(bc2.Blocos) {
+		t.Error("Cadeia com o mesmo gênesis deveria ser aceita")
+	}
+}
+
+// Testa que uma cadeia de outra rede é rejeitada
+func TestGenesisDiferenteRejeitado(t *testing.T) {
+	bc := NovoBlockchain(nil)
+
+	outraRede := GenesisPadrao
+	outraRede.ChainID = "outra-rede"
+	estranha, err := CarregarBlockchain(nil, NovoArmazenamentoMemoria(), outraRede)
+	if err != nil {
+		t.Fatal(err)
+	}
+	estranha.AdicionarRegistro("Evento1")
+	estranha.AdicionarRegistro("Evento2")
+
+	if bc.ValidarNovaBlockchain(estranha.Blocos) {
+		t.Error("Cadeia com gênesis diferente deveria ser rejeitada")
+	}
+}
+
+// Testa os saldos iniciais definidos no gênesis
+func TestGenesisSaldosIniciais(t *testing.T) {
+	especificacao := GenesisPadrao
+	especificacao.Saldos = map[string]Quantia{"alice": Reais(100)}
+	bc, err := CarregarBlockchain(nil, NovoArmazenamentoMemoria(), especificacao)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saldo := bc.CalcularSaldo("alice"); saldo != Reais(100) {
+		t.Errorf("Esperado saldo 100, obtido %s", saldo)
+	}
+}
@@ -0,0 +1,318 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sort"
+)
+
+// SituacaoProposta é a fase de uma proposta de governança:
+//
+//	em_votacao -> aprovada -> ativada
+//	     \            \
+//	      rejeitada    invalida
+//
+// Uma proposta aprovada só é aplicada na altura AtivaEm. Se até lá outra
+// proposta tiver mudado os parâmetros de forma que o resultado deixe de ser
+// válido, ela fica invalida e nada muda.
+type SituacaoProposta string
+
+const (
+	PropostaEmVotacao SituacaoProposta = "em_votacao"
+	PropostaAprovada  SituacaoProposta = "aprovada"
+	PropostaRejeitada SituacaoProposta = "rejeitada"
+	PropostaAtivada   SituacaoProposta = "ativada"
+	PropostaInvalida  SituacaoProposta = "invalida"
+)
+
+// Votos aceitos numa proposta.
+const (
+	VotoSim = "sim"
+	VotoNao = "nao"
+)
+
+// Proposta muda um ou mais parâmetros da rede. Alteracoes usa os nomes JSON
+// de Parametros, com os valores no mesmo formato (números para inteiros,
+// strings para quantias). Alturas são índices de bloco: votos são aceitos em
+// blocos anteriores a FimVotacao e, aprovada, a proposta vale a partir do
+// bloco AtivaEm, inclusive. Só contas com saldo votam, cada uma pode trocar
+// o voto, e na apuração cada voto pesa o saldo da conta naquele momento.
+type Proposta struct {
+	ID         int                        `json:"id"`
+	Proponente string                     `json:"proponente"`
+	Descricao  string                     `json:"descricao,omitempty"`
+	Alteracoes map[string]json.RawMessage `json:"alteracoes"`
+	FimVotacao int                        `json:"fim_votacao"`
+	AtivaEm    int                        `json:"ativa_em"`
+	Votos      map[string]string          `json:"votos,omitempty"`
+	Situacao   SituacaoProposta           `json:"situacao"`
+}
+
+// propostaAnterior guarda a proposta como estava antes de uma transação;
+// Votos é substituído, nunca alterado, como os mapas dos eventos.
+type propostaAnterior struct {
+	id       int
+	proposta Proposta
+}
+
+// comAlteracoes devolve os parâmetros com as alterações aplicadas, ou erro se
+// algum nome não existir, algum valor tiver o tipo errado ou o resultado não
+// for válido.
+func (p Parametros) comAlteracoes(alteracoes map[string]json.RawMessage) (Parametros, error) {
+	atuais, err := json.Marshal(p)
+	if err != nil {
+		return p, err
+	}
+	var campos map[string]json.RawMessage
+	if err := json.Unmarshal(atuais, &campos); err != nil {
+		return p, err
+	}
+	for nome, valor := range alteracoes {
+		if _, existe := campos[nome]; !existe {
+			return p, fmt.Errorf("parâmetro %q desconhecido", nome)
+		}
+		campos[nome] = valor
+	}
+	novos, err := json.Marshal(campos)
+	if err != nil {
+		return p, err
+	}
+	decodificador := json.NewDecoder(bytes.NewReader(novos))
+	decodificador.DisallowUnknownFields()
+	var resultado Parametros
+	if err := decodificador.Decode(&resultado); err != nil {
+		return p, fmt.Errorf("valor de parâmetro inválido: %v", err)
+	}
+	if err := resultado.Validar(); err != nil {
+		return p, err
+	}
+	return resultado, nil
+}
+
+// registrarProposta guarda o estado atual da proposta para Desfazer.
+func (e *EstadoMundo) registrarProposta(proposta *Proposta, alteracoes *alteracoesBloco) {
+	alteracoes.propostas = append(alteracoes.propostas, propostaAnterior{proposta.ID, *proposta})
+}
+
+// registrarParametros guarda os parâmetros de antes do bloco, uma vez só.
+func (e *EstadoMundo) registrarParametros(alteracoes *alteracoesBloco) {
+	if alteracoes.parametros == nil {
+		anteriores := e.Parametros
+		alteracoes.parametros = &anteriores
+	}
+}
+
+// propor registra uma proposta nova, enviada no bloco da altura informada.
+func (e *EstadoMundo) propor(proposta Proposta, conta string, altura int, alteracoes *alteracoesBloco) *ErroValidacao {
+	if conta == "" {
+		return rejeitar(MotivoNaoAutorizado, "proposta precisa ser assinada")
+	}
+	if len(proposta.Alteracoes) == 0 {
+		return rejeitar(MotivoPropostaInvalida, "proposta sem alterações")
+	}
+	if _, err := e.Parametros.comAlteracoes(proposta.Alteracoes); err != nil {
+		return rejeitar(MotivoPropostaInvalida, "%v", err)
+	}
+	proposta.FimVotacao = altura + e.Parametros.JanelaGovernanca
+	if proposta.AtivaEm <= proposta.FimVotacao {
+		return rejeitar(MotivoPropostaInvalida, "ativação na altura %d precisa ser depois do fim da votação, na altura %d", proposta.AtivaEm, proposta.FimVotacao)
+	}
+	proposta.ID = len(e.Propostas) + 1
+	proposta.Proponente = conta
+	proposta.Votos = nil
+	proposta.Situacao = PropostaEmVotacao
+	e.Propostas[proposta.ID] = &proposta
+	alteracoes.propostasCriadas++
+	return nil
+}
+
+// votarProposta registra o voto da conta, substituindo um voto anterior dela.
+func (e *EstadoMundo) votarProposta(id int, conta, voto string, altura int, alteracoes *alteracoesBloco) *ErroValidacao {
+	proposta, existe := e.Propostas[id]
+	if !existe {
+		return rejeitar(MotivoPropostaInexistente, "proposta %d não existe", id)
+	}
+	if voto != VotoSim && voto != VotoNao {
+		return rejeitar(MotivoOpcaoInvalida, "voto %q numa proposta deve ser %q ou %q", voto, VotoSim, VotoNao)
+	}
+	if proposta.Situacao != PropostaEmVotacao || altura >= proposta.FimVotacao {
+		return rejeitar(MotivoVotacaoEncerrada, "votação da proposta %d encerrada na altura %d", id, proposta.FimVotacao)
+	}
+	if conta == "" {
+		return rejeitar(MotivoNaoAutorizado, "voto em proposta precisa ser assinado")
+	}
+	if e.Saldos[conta] <= 0 {
+		return rejeitar(MotivoSaldoInsuficiente, "conta %s sem saldo não vota em propostas", conta)
+	}
+	votos := make(map[string]string, len(proposta.Votos)+1)
+	for votante, anterior := range proposta.Votos {
+		votos[votante] = anterior
+	}
+	votos[conta] = voto
+	e.registrarProposta(proposta, alteracoes)
+	proposta.Votos = votos
+	return nil
+}
+
+// aprovada diz se os votos da proposta atingem o quórum e a maioria exigidos.
+// O quórum conta as contas que ainda têm saldo e a maioria é calculada sobre
+// a soma dos saldos delas, para que contas criadas só para votar não pesem.
+func (e *EstadoMundo) aprovada(proposta *Proposta) bool {
+	votantes := 0
+	total, sim := new(big.Int), new(big.Int)
+	for votante, voto := range proposta.Votos {
+		saldo := e.Saldos[votante]
+		if saldo <= 0 {
+			continue
+		}
+		votantes++
+		total.Add(total, big.NewInt(int64(saldo)))
+		if voto == VotoSim {
+			sim.Add(sim, big.NewInt(int64(saldo)))
+		}
+	}
+	if votantes < e.Parametros.QuorumGovernanca {
+		return false
+	}
+	exigido := new(big.Int).Mul(total, big.NewInt(int64(e.Parametros.MaioriaGovernanca)))
+	return new(big.Int).Mul(sim, big.NewInt(100)).Cmp(exigido) >= 0
+}
+
+// ParametrosPara devolve os parâmetros que valem para o bloco da altura, com
+// o estado aplicado até o bloco anterior: os atuais mais as propostas
+// aprovadas que ativam nela. Como a ativação é sempre depois do fim da
+// votação, toda proposta que ativa na altura já foi apurada.
+func (e *EstadoMundo) ParametrosPara(altura int) Parametros {
+	parametros := e.Parametros
+	for id := 1; id <= len(e.Propostas); id++ {
+		proposta := e.Propostas[id]
+		if proposta.Situacao != PropostaAprovada || proposta.AtivaEm > altura {
+			continue
+		}
+		if novos, err := parametros.comAlteracoes(proposta.Alteracoes); err == nil {
+			parametros = novos
+		}
+	}
+	return parametros
+}
+
+// governar apura as propostas cuja votação terminou e ativa as aprovadas que
+// chegaram à altura de ativação, em ordem de ID, antes das transações do
+// bloco.
+func (e *EstadoMundo) governar(altura int, alteracoes *alteracoesBloco) {
+	for id := 1; id <= len(e.Propostas); id++ {
+		proposta := e.Propostas[id]
+		switch {
+		case proposta.Situacao == PropostaEmVotacao && altura >= proposta.FimVotacao:
+			e.registrarProposta(proposta, alteracoes)
+			proposta.Situacao = PropostaRejeitada
+			if e.aprovada(proposta) {
+				proposta.Situacao = PropostaAprovada
+			}
+		case proposta.Situacao == PropostaAprovada && altura >= proposta.AtivaEm:
+			e.registrarProposta(proposta, alteracoes)
+			novos, err := e.Parametros.comAlteracoes(proposta.Alteracoes)
+			if err != nil {
+				proposta.Situacao = PropostaInvalida
+				continue
+			}
+			e.registrarParametros(alteracoes)
+			e.Parametros = novos
+			proposta.Situacao = PropostaAtivada
+		}
+	}
+}
+
+// HandleParametros devolve os parâmetros ativos na ponta e as mudanças já
+// aprovadas que ainda vão ativar.
+func (bc *Blockchain) HandleParametros(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	if r.Method == "OPTIONS" {
+		return
+	}
+	type ParametrosResponse struct {
+		Altura     int        `json:"altura"`
+		Parametros Parametros `json:"parametros"`
+		Pendentes  []Proposta `json:"pendentes"`
+	}
+	bc.mu.Lock()
+	resposta := ParametrosResponse{
+		Altura:     bc.estado.Altura() - 1,
+		Parametros: bc.estado.Parametros,
+		Pendentes:  []Proposta{},
+	}
+	for id := 1; id <= len(bc.estado.Propostas); id++ {
+		if proposta := bc.estado.Propostas[id]; proposta.Situacao == PropostaAprovada {
+			resposta.Pendentes = append(resposta.Pendentes, *proposta)
+		}
+	}
+	bc.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resposta)
+}
+
+// HandlePropostas lista as propostas, da mais recente para a mais antiga.
+func (bc *Blockchain) HandlePropostas(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	if r.Method == "OPTIONS" {
+		return
+	}
+	bc.mu.Lock()
+	propostas := make([]Proposta, 0, len(bc.estado.Propostas))
+	for _, proposta := range bc.estado.Propostas {
+		propostas = append(propostas, *proposta)
+	}
+	bc.mu.Unlock()
+	sort.Slice(propostas, func(i, j int) bool { return propostas[i].ID > propostas[j].ID })
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(propostas)
+}
+
+func (bc *Blockchain) HandlePropor(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	if r.Method == "OPTIONS" {
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Método não permitido", http.StatusMethodNotAllowed)
+		return
+	}
+	var tx Transacao
+	if err := json.NewDecoder(r.Body).Decode(&tx); err != nil {
+		http.Error(w, "Dados inválidos", http.StatusBadRequest)
+		return
+	}
+	var proposta Proposta
+	if err := bc.decodificarTransacao(tx, "propor_parametros", &proposta); err != nil {
+		http.Error(w, fmt.Sprintf("Transação inválida: %v", err), http.StatusBadRequest)
+		return
+	}
+	if len(proposta.Alteracoes) == 0 {
+		http.Error(w, "A proposta precisa alterar pelo menos um parâmetro", http.StatusBadRequest)
+		return
+	}
+	bc.mu.Lock()
+	_, err := bc.estado.Parametros.comAlteracoes(proposta.Alteracoes)
+	// a proposta entra no próximo bloco, no mínimo
+	fimVotacao := bc.estado.Altura() + bc.estado.Parametros.JanelaGovernanca
+	bc.mu.Unlock()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Alterações inválidas: %v", err), http.StatusBadRequest)
+		return
+	}
+	if proposta.AtivaEm <= fimVotacao {
+		http.Error(w, fmt.Sprintf("A ativação deve ser depois da altura %d, fim da votação", fimVotacao), http.StatusBadRequest)
+		return
+	}
+	bc.SubmeterTransacoes(tx)
+	w.Write([]byte(fmt.Sprintf("Proposta enviada; votação até a altura %d, aproximadamente.", fimVotacao)))
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+// avancarAte aplica blocos vazios até o estado estar pronto para o bloco da altura.
+func avancarAte(t *testing.T, estado *EstadoMundo, altura int, instante time.Time) {
+	for estado.Altura() < altura {
+		if err := estado.Aplicar(blocoEm(instante)); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func propostaDe(t *testing.T, carteira *Carteira, nonce uint64, ativaEm int, alteracoes string) Transacao {
+	var mudancas map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(alteracoes), &mudancas); err != nil {
+		t.Fatal(err)
+	}
+	return transacaoAssinada(t, carteira, nonce, "propor_parametros", Proposta{Alteracoes: mudancas, AtivaEm: ativaEm})
+}
+
+func votoEmProposta(t *testing.T, carteira *Carteira, nonce uint64, id int, voto string) Transacao {
+	return transacaoAssinada(t, carteira, nonce, "votar", Voto{Usuario: carteira.Endereco, PropostaID: id, Opcao: voto})
+}
+
+// Testa o ciclo de uma proposta aprovada: votação na janela, apuração e ativação na altura escolhida
+func TestPropostaAprovadaAtivaNaAltura(t *testing.T) {
+	alice, _ := NovaCarteira()
+	bob, _ := NovaCarteira()
+	carol, _ := NovaCarteira()
+	estado := estadoComSaldos(t, map[*Carteira]Quantia{alice: Reais(100), bob: Reais(10), carol: Reais(10)})
+	instante := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	// A proposta entra no bloco 1, logo depois do gênesis
+	fim := 1 + estado.Parametros.JanelaGovernanca
+	ativacao := fim + 5
+	if err := estado.Aplicar(blocoEm(instante,
+		transacaoAssinada(t, alice, 0, "criar_evento", Evento{Nome: "Final", Opcoes: []string{"X", "Y"}}),
+		propostaDe(t, alice, 1, ativacao, `{"aposta_maxima": "5.00", "opcoes_minimas": 3}`),
+	)); err != nil {
+		t.Fatal(err)
+	}
+	if proposta := estado.Propostas[1]; proposta.FimVotacao != fim || proposta.Situacao != PropostaEmVotacao {
+		t.Fatalf("Proposta deveria estar em votação até a altura %d, obtido %+v", fim, proposta)
+	}
+
+	// Carol troca o voto: vale o último
+	if err := estado.Aplicar(blocoEm(instante,
+		votoEmProposta(t, alice, 2, 1, VotoSim),
+		votoEmProposta(t, bob, 0, 1, VotoSim),
+		votoEmProposta(t, carol, 0, 1, VotoNao),
+		votoEmProposta(t, carol, 1, 1, VotoSim),
+	)); err != nil {
+		t.Fatal(err)
+	}
+	if err := estado.Aplicar(blocoEm(instante, votoEmProposta(t, bob, 1, 1, "talvez"))); motivoDe(err) != MotivoOpcaoInvalida {
+		t.Errorf("Voto que não é sim nem não deveria ser recusado, obtido %v", err)
+	}
+
+	avancarAte(t, estado, fim, instante)
+	if err := estado.Aplicar(blocoEm(instante, votoEmProposta(t, bob, 1, 1, VotoNao))); motivoDe(err) != MotivoVotacaoEncerrada {
+		t.Errorf("Voto depois da janela deveria ser recusado, obtido %v", err)
+	}
+	avancarAte(t, estado, ativacao, instante)
+	if estado.Propostas[1].Situacao != PropostaAprovada || estado.Parametros.ApostaMaxima != 0 {
+		t.Fatalf("Proposta aprovada não deveria valer antes da ativação, obtido %+v", estado.Propostas[1])
+	}
+	if estado.ParametrosPara(ativacao).ApostaMaxima != Reais(5) {
+		t.Errorf("Parâmetros para a altura de ativação deveriam incluir a proposta")
+	}
+
+	acima := transacaoAssinada(t, alice, 3, "apostar", Aposta{Usuario: alice.Endereco, Valor: Reais(6), EventoID: 1, Opcao: "X"})
+	if err := estado.Aplicar(blocoEm(instante, acima)); motivoDe(err) != MotivoValorInvalido {
+		t.Errorf("Aposta acima do máximo deveria ser recusada depois da ativação, obtido %v", err)
+	}
+	if estado.Propostas[1].Situacao != PropostaAprovada {
+		t.Errorf("Bloco recusado não deveria ativar a proposta, obtido %s", estado.Propostas[1].Situacao)
+	}
+	if err := estado.Aplicar(blocoEm(instante, transacaoAssinada(t, alice, 3, "apostar", Aposta{Usuario: alice.Endereco, Valor: Reais(5), EventoID: 1, Opcao: "X"}))); err != nil {
+		t.Fatal(err)
+	}
+	if estado.Propostas[1].Situacao != PropostaAtivada || estado.Parametros.OpcoesMinimas != 3 {
+		t.Errorf("Proposta deveria estar ativada, obtido %+v", estado.Parametros)
+	}
+
+	estado.Desfazer()
+	if estado.Parametros.ApostaMaxima != 0 || estado.Propostas[1].Situacao != PropostaAprovada {
+		t.Errorf("Desfazer a ativação deveria restaurar os parâmetros, obtido %+v", estado.Parametros)
+	}
+}
+
+// Testa que sem quórum a proposta é rejeitada e nada muda
+func TestPropostaSemQuorumRejeitada(t *testing.T) {
+	alice, _ := NovaCarteira()
+	estado := estadoComSaldos(t, map[*Carteira]Quantia{alice: Reais(100)})
+	instante := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	fim := 1 + estado.Parametros.JanelaGovernanca
+	if err := estado.Aplicar(blocoEm(instante,
+		propostaDe(t, alice, 0, fim+1, `{"tempo_alvo_bloco": 20}`),
+		votoEmProposta(t, alice, 1, 1, VotoSim),
+	)); err != nil {
+		t.Fatal(err)
+	}
+	avancarAte(t, estado, fim+2, instante)
+	if estado.Propostas[1].Situacao != PropostaRejeitada || estado.Parametros.TempoAlvoBloco != tempoAlvoBlocoPadrao {
+		t.Errorf("Proposta com um votante deveria ser rejeitada, obtido %+v", estado.Propostas[1])
+	}
+}
+
+// Testa que contas sem saldo não votam e que a maioria é pesada pelo saldo, não pelo número de contas
+func TestVotoEmPropostaPesadoPeloSaldo(t *testing.T) {
+	alice, _ := NovaCarteira()
+	saldos := map[*Carteira]Quantia{alice: Reais(100)}
+	pequenas := novasCarteiras(3)
+	for _, pequena := range pequenas {
+		saldos[pequena] = Reais(1)
+	}
+	estado := estadoComSaldos(t, saldos)
+	instante := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	fim := 1 + estado.Parametros.JanelaGovernanca
+	if err := estado.Aplicar(blocoEm(instante,
+		propostaDe(t, alice, 0, fim+1, `{"tempo_alvo_bloco": 20}`),
+		votoEmProposta(t, alice, 1, 1, VotoNao),
+	)); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, sem := range novasCarteiras(3) {
+		if err := estado.Aplicar(blocoEm(instante, votoEmProposta(t, sem, 0, 1, VotoSim))); motivoDe(err) != MotivoSaldoInsuficiente {
+			t.Fatalf("Voto de conta sem saldo deveria ser recusado, obtido %v", err)
+		}
+	}
+	if len(estado.Propostas[1].Votos) != 1 {
+		t.Fatalf("Votos recusados não deveriam ser registrados, obtido %v", estado.Propostas[1].Votos)
+	}
+
+	// Três de quatro votos são sim, mas só 3 dos 103 de saldo
+	var votos []Transacao
+	for _, pequena := range pequenas {
+		votos = append(votos, votoEmProposta(t, pequena, 0, 1, VotoSim))
+	}
+	if err := estado.Aplicar(blocoEm(instante, votos...)); err != nil {
+		t.Fatal(err)
+	}
+	avancarAte(t, estado, fim+2, instante)
+	if estado.Propostas[1].Situacao != PropostaRejeitada || estado.Parametros.TempoAlvoBloco != tempoAlvoBlocoPadrao {
+		t.Errorf("Maioria de contas sem maioria do saldo não deveria aprovar a proposta, obtido %+v", estado.Propostas[1])
+	}
+}
+
+// Testa que propostas com parâmetros desconhecidos, valores inválidos ou ativação cedo demais são recusadas
+func TestPropostasInvalidas(t *testing.T) {
+	alice, _ := NovaCarteira()
+	janela := parametrosPadrao().JanelaGovernanca
+	casos := map[string]Transacao{
+		"sem alterações":        propostaDe(t, alice, 0, janela+1, `{}`),
+		"parâmetro inexistente": propostaDe(t, alice, 0, janela+1, `{"dificuldade_secreta": 1}`),
+		"tipo errado":           propostaDe(t, alice, 0, janela+1, `{"opcoes_minimas": "três"}`),
+		"valor fora da regra":   propostaDe(t, alice, 0, janela+1, `{"maioria_governanca": 40}`),
+		"ativação na votação":   propostaDe(t, alice, 0, janela, `{"opcoes_minimas": 3}`),
+	}
+	for nome, tx := range casos {
+		estado := NovoEstadoMundo()
+		if err := estado.Aplicar(blocoEm(time.Now(), tx)); motivoDe(err) != MotivoPropostaInvalida {
+			t.Errorf("%s: esperado %q, obtido %v", nome, MotivoPropostaInvalida, err)
+		}
+	}
+}
+
+// Testa que o tempo alvo do ajuste de dificuldade vem dos parâmetros do estado
+func TestTempoAlvoGovernadoAjustaDificuldade(t *testing.T) {
+	bc := NovoBlockchain(nil)
+	bc.genesis.DificuldadeMaxima = dificuldadeMaximaPadrao
+	blocos := blocosEspacados(bc.genesis, 2*intervaloAjustePadrao, 10*time.Second)
+	estado := NovoEstadoMundo()
+	altura := 2 * intervaloAjustePadrao
+	blocos = append(blocos, Bloco{})
+	if d := bc.dificuldadeNaCadeia(blocos, altura, estado); d != blocos[altura-1].Dificuldade {
+		t.Errorf("Blocos no tempo alvo padrão não deveriam mudar a dificuldade, obtido %d", d)
+	}
+	// Com o alvo em 60 segundos, blocos a cada 10 são rápidos demais
+	estado.Parametros.TempoAlvoBloco = 60
+	if d := bc.dificuldadeNaCadeia(blocos, altura, estado); d != blocos[altura-1].Dificuldade+1 {
+		t.Errorf("Tempo alvo maior deveria subir a dificuldade, obtido %d", d)
+	}
+}
+
+// Testa que consultar os parâmetros de um ramo alternativo devolve o estado à ponta
+func TestParametrosDeRamoAlternativo(t *testing.T) {
+	a := NovoBlockchain(nil)
+	b := NovoBlockchain(nil)
+	a.AdicionarRegistro("Comum")
+	incorporar(t, b, a.Blocos)
+	alice, _ := NovaCarteira()
+	a.AdicionarTransacao(propostaDe(t, alice, 0, 500, `{"opcoes_minimas": 3}`))
+	b.AdicionarRegistro("B")
+	b.AdicionarRegistro("B")
+
+	b.mu.Lock()
+	no, err := b.guardarBloco(a.Blocos[2])
+	if err == nil {
+		_, err = b.parametrosDoFilho(no)
+	}
+	propostas := len(b.estado.Propostas)
+	b.mu.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if propostas != 0 || b.ponta.bloco.HashAtual != b.Blocos[len(b.Blocos)-1].HashAtual {
+		t.Errorf("Estado deveria voltar à ponta depois da consulta, %d proposta(s)", propostas)
+	}
+	if err := b.VerificarEstado(); err != nil {
+		t.Error(err)
+	}
+}
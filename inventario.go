@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	maxInventarioConhecido = 5000
+	// Um item pedido a um peer só é pedido a outro se não chegar neste prazo
+	esperaPedidoItem = 10 * time.Second
+)
+
+// inventarioConhecido lembra os últimos itens que um peer já tem, por ter
+// mandado, anunciado ou recebido de nós, para que não lhe sejam anunciados
+// de novo. Os mais antigos são esquecidos primeiro.
+type inventarioConhecido struct {
+	mu    sync.Mutex
+	itens map[string]bool
+	ordem []string
+}
+
+func novoInventarioConhecido() *inventarioConhecido {
+	return &inventarioConhecido{itens: make(map[string]bool)}
+}
+
+// Adicionar devolve false se o item já era conhecido.
+func (i *inventarioConhecido) Adicionar(hash string) bool {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if i.itens[hash] {
+		return false
+	}
+	i.itens[hash] = true
+	i.ordem = append(i.ordem, hash)
+	if len(i.ordem) > maxInventarioConhecido {
+		delete(i.itens, i.ordem[0])
+		i.ordem = i.ordem[1:]
+	}
+	return true
+}
+
+func (i *inventarioConhecido) Contem(hash string) bool {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.itens[hash]
+}
+
+// reservarPedido diz se o item pode ser pedido agora: quando vários peers
+// anunciam o mesmo bloco, ele é pedido a um só.
+func (g *GerenciadorSessoes) reservarPedido(hash string, agora time.Time) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if pedido, existe := g.pedidos[hash]; existe && agora.Sub(pedido) < esperaPedidoItem {
+		return false
+	}
+	if len(g.pedidos) >= maxInventarioConhecido {
+		for item, pedido := range g.pedidos {
+			if agora.Sub(pedido) >= esperaPedidoItem {
+				delete(g.pedidos, item)
+			}
+		}
+	}
+	g.pedidos[hash] = agora
+	return true
+}
+
+func (g *GerenciadorSessoes) liberarPedido(hash string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	delete(g.pedidos, hash)
+}
+
+// anunciar avisa os peers de blocos ou transações que este nó acabou de
+// aceitar. Pelas sessões vai só o inventário, e o conteúdo segue se o peer
+// pedir; peers ativos sem sessão recebem o conteúdo pelo HTTP. Cada item
+// passa no máximo uma vez por peer, e quem o mandou já o conhece. Deve ser
+// chamado sem bc.mu, porque uma fila de envio cheia faz esperar.
+func (bc *Blockchain) anunciar(itens ...ItemInventario) {
+	for _, s := range bc.sessoes.Listar() {
+		var novos []ItemInventario
+		for _, item := range itens {
+			if s.conhecidos.Adicionar(item.Hash) {
+				novos = append(novos, item)
+			}
+		}
+		if len(novos) == 0 {
+			continue
+		}
+		dados, err := codificarInventario(novos)
+		if err != nil {
+			log.Printf("Inventário para %s não codificado: %v", s, err)
+			continue
+		}
+		s.Enviar(Mensagem{Tipo: msgInv, Dados: dados})
+	}
+	for _, peer := range bc.peers.Ativos() {
+		if bc.sessoes.conectadoA(peer) {
+			continue
+		}
+		var novos []ItemInventario
+		for _, item := range itens {
+			if bc.peers.marcarConhecido(peer, item.Hash) {
+				novos = append(novos, item)
+			}
+		}
+		if len(novos) > 0 {
+			go bc.enviarPorHTTP(peer, novos)
+		}
+	}
+}
+
+// enviarPorHTTP manda o conteúdo dos itens, na ordem, a um peer sem sessão.
+func (bc *Blockchain) enviarPorHTTP(peer string, itens []ItemInventario) {
+	for _, item := range itens {
+		m, ok := bc.mensagemDoItem(item)
+		if !ok {
+			continue
+		}
+		caminho := "/receber-bloco"
+		if item.Tipo == invTransacao {
+			caminho = "/receber-transacao"
+		}
+		req, err := http.NewRequest(http.MethodPost, peer+caminho, bytes.NewReader(m.Dados))
+		if err != nil {
+			return
+		}
+		req.Header.Set("Content-Type", "application/json")
+		// Diz ao peer a quem pedir os ancestrais e que não precisa devolver o item
+		if proprio := bc.peers.proprio; proprio != "" {
+			req.Header.Set(cabecalhoOrigem, proprio)
+		}
+		resp, err := bc.peers.clientePara(peer).Do(req)
+		if err != nil {
+			return
+		}
+		resp.Body.Close()
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// Testa que o inventário conhecido esquece os itens mais antigos e que um item anunciado é pedido a um peer só
+func TestInventarioConhecidoEPedidos(t *testing.T) {
+	conhecidos := novoInventarioConhecido()
+	for i := 0; i <= maxInventarioConhecido; i++ {
+		conhecidos.Adicionar(fmt.Sprintf("h%d", i))
+	}
+	if conhecidos.Contem("h0") || !conhecidos.Contem("h1") || len(conhecidos.itens) != maxInventarioConhecido {
+		t.Errorf("O item mais antigo deveria ser esquecido, obtido %d itens", len(conhecidos.itens))
+	}
+	if conhecidos.Adicionar("h1") {
+		t.Error("Item repetido não deveria ser novo")
+	}
+
+	sessoes := NovoGerenciadorSessoes()
+	agora := time.Now()
+	if !sessoes.reservarPedido("x", agora) || sessoes.reservarPedido("x", agora.Add(time.Second)) {
+		t.Error("O segundo anúncio do mesmo item não deveria gerar outro pedido")
+	}
+	if !sessoes.reservarPedido("x", agora.Add(esperaPedidoItem)) {
+		t.Error("Pedido sem resposta deveria poder ser refeito depois da espera")
+	}
+	sessoes.liberarPedido("x")
+	if !sessoes.reservarPedido("x", agora.Add(esperaPedidoItem)) {
+		t.Error("Item recebido deveria liberar o pedido")
+	}
+}
+
+// Testa que um bloco atravessa a linha a-b-c pelas sessões, repassado por b, sem voltar a quem já o tem
+func TestBlocoRepassadoPelasSessoes(t *testing.T) {
+	a, b, c := NovoBlockchain(nil), NovoBlockchain(nil), NovoBlockchain(nil)
+	enderecoA := servirPeer(t, a)
+	enderecoB := servirPeer(t, b)
+	servirPeer(t, c)
+	for _, bc := range []*Blockchain{a, b, c} {
+		t.Cleanup(bc.sessoes.Encerrar)
+	}
+	conectar(t, b, enderecoA)
+	conectar(t, c, enderecoB)
+	b.ConectarSessoes()
+	c.ConectarSessoes()
+	esperar(t, "as sessões a-b e b-c", func() bool { return len(b.sessoes.Listar()) == 2 && len(c.sessoes.Listar()) == 1 })
+	if len(a.sessoes.Listar()) != 1 {
+		t.Fatalf("a deveria ter sessão só com b, obtido %d", len(a.sessoes.Listar()))
+	}
+
+	bloco := a.AdicionarRegistro("A")
+	a.NotificarPeers(bloco)
+	esperar(t, "o bloco chegar a c por b", func() bool { return pontaDe(c) == bloco.HashAtual })
+	for _, bc := range []*Blockchain{a, b, c} {
+		for _, s := range bc.sessoes.Listar() {
+			if !s.conhecidos.Contem(bloco.HashAtual) {
+				t.Errorf("A sessão de %s com %s deveria registrar que o peer tem o bloco", bc.peers.proprio, s)
+			}
+		}
+	}
+}
+
+// Testa o repasse pelo HTTP entre peers sem sessão, registrando o remetente como quem já tem o bloco
+func TestBlocoRepassadoPorHTTP(t *testing.T) {
+	a, b, c := NovoBlockchain(nil), NovoBlockchain(nil), NovoBlockchain(nil)
+	enderecoA := servirPeer(t, a)
+	enderecoB := servirPeer(t, b)
+	enderecoC := servirPeer(t, c)
+	conectar(t, a, enderecoB)
+	conectar(t, b, enderecoA, enderecoC)
+	conectar(t, c, enderecoB)
+
+	bloco := a.AdicionarRegistro("A")
+	a.NotificarPeers(bloco)
+	esperar(t, "o bloco chegar a c por b", func() bool { return pontaDe(c) == bloco.HashAtual })
+	if b.peers.marcarConhecido(enderecoA, bloco.HashAtual) || b.peers.marcarConhecido(enderecoC, bloco.HashAtual) {
+		t.Error("b deveria saber que a mandou o bloco e que c já o recebeu")
+	}
+	if c.peers.marcarConhecido(enderecoB, bloco.HashAtual) {
+		t.Error("c não deveria devolver o bloco a b")
+	}
+	if a.peers.marcarConhecido(enderecoB, bloco.HashAtual) {
+		t.Error("a não deveria mandar o bloco duas vezes a b")
+	}
+}
+
+// Testa que o cabeçalho de origem só vale vindo do host de um peer ativo, para que ninguém impeça o repasse a um peer
+func TestOrigemDeclaradaSoDePeerAtivo(t *testing.T) {
+	a, b := NovoBlockchain(nil), NovoBlockchain(nil)
+	enderecoA := servirPeer(t, a)
+	servirPeer(t, b)
+	conectar(t, b, enderecoA)
+
+	receber := func(remoto, origem, hash string) {
+		corpo, _ := json.Marshal(Bloco{Indice: 1, HashAtual: hash})
+		req := httptest.NewRequest(http.MethodPost, "/receber-bloco", bytes.NewReader(corpo))
+		req.RemoteAddr = remoto
+		req.Header.Set(cabecalhoOrigem, origem)
+		b.ReceberBloco(httptest.NewRecorder(), req)
+	}
+	receber("192.0.2.1:1234", enderecoA, "forjado")
+	if !b.peers.marcarConhecido(enderecoA, "forjado") {
+		t.Error("Origem declarada de outro host não deveria marcar o bloco como conhecido por a")
+	}
+	receber("127.0.0.1:1234", enderecoA, "legitimo")
+	if b.peers.marcarConhecido(enderecoA, "legitimo") {
+		t.Error("Bloco vindo do host de a deveria ficar marcado como conhecido por a")
+	}
+}
@@ -6,19 +6,89 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 )
 
 func main() {
-	// Obtém a lista de peers a partir de variáveis de ambiente
+	// Sementes: os primeiros peers procurados; os demais são descobertos por eles
 	peersEnv := os.Getenv("PEERS")
 	var peers []string
 	if peersEnv != "" {
 		peers = strings.Split(peersEnv, ",")
 	}
 
-	blockchain := NovoBlockchain(peers)
+	// Especificação do gênesis: compilada por padrão ou lida de GENESIS_FILE
+	especificacao := GenesisPadrao
+	if arquivoGenesis := os.Getenv("GENESIS_FILE"); arquivoGenesis != "" {
+		var err error
+		especificacao, err = CarregarGenesis(arquivoGenesis)
+		if err != nil {
+			log.Fatalf("Erro ao carregar o gênesis: %v", err)
+		}
+	}
+
+	// Diretório onde os blocos são gravados; sobrevive a reinícios do contêiner
+	diretorioDados := os.Getenv("DATA_DIR")
+	if diretorioDados == "" {
+		diretorioDados = "./dados"
+	}
+	armazenamento, err := AbrirArmazenamentoArquivo(diretorioDados)
+	if err != nil {
+		log.Fatalf("Erro ao abrir o armazenamento em %s: %v", diretorioDados, err)
+	}
+	blockchain, err := CarregarBlockchain(peers, armazenamento, especificacao)
+	if err != nil {
+		log.Fatalf("Erro ao carregar a blockchain: %v", err)
+	}
+
+	// Carteira do nó: assina as transações criadas pelo próprio nó
+	carteira, err := CarregarCarteira(filepath.Join(diretorioDados, "carteira.key"))
+	if err != nil {
+		log.Fatalf("Erro ao carregar a carteira do nó: %v", err)
+	}
+	blockchain.carteira = carteira
+	log.Printf("Carteira do nó: %s", carteira.Endereco)
+
+	// URL pela qual os outros nós alcançam este, anunciada no handshake
+	if endereco := os.Getenv("NODE_ADDR"); endereco != "" {
+		proprio, err := normalizarEnderecoPeer(endereco)
+		if err != nil {
+			log.Fatalf("NODE_ADDR inválido: %v", err)
+		}
+		blockchain.peers.proprio = proprio
+	}
+	if maxPeers := os.Getenv("MAX_PEERS"); maxPeers != "" {
+		n, err := strconv.Atoi(maxPeers)
+		if err != nil || n < 1 {
+			log.Fatalf("MAX_PEERS inválido: %q", maxPeers)
+		}
+		blockchain.peers.maxPeers = n
+	}
+	// Numa rede local (como a do docker-compose) os peers têm endereços
+	// privados, que por padrão não são aceitos de outros nós
+	if privados := os.Getenv("ALLOW_PRIVATE_PEERS"); privados != "" {
+		permitir, err := strconv.ParseBool(privados)
+		if err != nil {
+			log.Fatalf("ALLOW_PRIVATE_PEERS inválido: %q", privados)
+		}
+		blockchain.peers.permitirPrivados = permitir
+	}
+	blockchain.tokenAdmin = os.Getenv("ADMIN_TOKEN")
+	if blockchain.tokenAdmin == "" {
+		log.Println("ADMIN_TOKEN não definido: endpoints de administração desativados")
+	}
+
+	// Número de goroutines que fazem a prova de trabalho em paralelo
+	if trabalhadores := os.Getenv("MINING_WORKERS"); trabalhadores != "" {
+		n, err := strconv.Atoi(trabalhadores)
+		if err != nil || n < 1 {
+			log.Fatalf("MINING_WORKERS inválido: %q", trabalhadores)
+		}
+		blockchain.trabalhadoresMineracao = n
+	}
 
 	// Inicializa os endpoints HTTP
 	blockchain.InicializarEndpoints()
@@ -31,11 +101,23 @@ func main() {
 		}
 	}()
 
+	// Empacota as transações pendentes em blocos
+	go blockchain.Minerar()
+
+	// Handshake, verificação de vida e descoberta de peers
+	go func() {
+		for {
+			blockchain.ManterPeers()
+			blockchain.ConectarSessoes()
+			time.Sleep(intervaloPeers)
+		}
+	}()
+
 	// Sincroniza com os peers periodicamente
 	go func() {
 		for {
 			blockchain.SincronizarComPeers()
-			time.Sleep(10 * time.Second) // Intervalo de sincronização
+			time.Sleep(intervaloSincronizacao)
 		}
 	}()
 
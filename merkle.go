@@ -0,0 +1,140 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+)
+
+type PassoMerkle struct {
+	Hash    string `json:"hash"`
+	Direita bool   `json:"direita"`
+}
+
+type ProvaMerkle struct {
+	Transacao   Transacao     `json:"transacao"`
+	IndiceBloco int           `json:"indice_bloco"`
+	HashBloco   string        `json:"hash_bloco"`
+	RaizMerkle  string        `json:"raiz_merkle"`
+	Caminho     []PassoMerkle `json:"caminho"`
+}
+
+func hashPar(esquerda, direita []byte) []byte {
+	h := sha256.New()
+	h.Write(esquerda)
+	h.Write(direita)
+	return h.Sum(nil)
+}
+
+func folhasMerkle(ids []string) [][]byte {
+	folhas := make([][]byte, len(ids))
+	for i, id := range ids {
+		folha := sha256.Sum256([]byte(id))
+		folhas[i] = folha[:]
+	}
+	return folhas
+}
+
+// proximoNivel combina os hashes dois a dois; num nível ímpar o último é
+// combinado com ele mesmo.
+func proximoNivel(nivel [][]byte) [][]byte {
+	proximo := make([][]byte, 0, (len(nivel)+1)/2)
+	for i := 0; i < len(nivel); i += 2 {
+		direita := nivel[i]
+		if i+1 < len(nivel) {
+			direita = nivel[i+1]
+		}
+		proximo = append(proximo, hashPar(nivel[i], direita))
+	}
+	return proximo
+}
+
+func raizMerkle(ids []string) string {
+	if len(ids) == 0 {
+		return ""
+	}
+	nivel := folhasMerkle(ids)
+	for len(nivel) > 1 {
+		nivel = proximoNivel(nivel)
+	}
+	return hex.EncodeToString(nivel[0])
+}
+
+// caminhoMerkle devolve os irmãos necessários para ir da folha indice até a raiz.
+func caminhoMerkle(ids []string, indice int) []PassoMerkle {
+	var caminho []PassoMerkle
+	nivel := folhasMerkle(ids)
+	for len(nivel) > 1 {
+		irmao := indice ^ 1
+		if irmao >= len(nivel) {
+			irmao = indice
+		}
+		caminho = append(caminho, PassoMerkle{
+			Hash:    hex.EncodeToString(nivel[irmao]),
+			Direita: irmao >= indice,
+		})
+		nivel = proximoNivel(nivel)
+		indice /= 2
+	}
+	return caminho
+}
+
+func VerificarProvaMerkle(id string, caminho []PassoMerkle, raiz string) bool {
+	folha := sha256.Sum256([]byte(id))
+	atual := folha[:]
+	for _, passo := range caminho {
+		irmao, err := hex.DecodeString(passo.Hash)
+		if err != nil {
+			return false
+		}
+		if passo.Direita {
+			atual = hashPar(atual, irmao)
+		} else {
+			atual = hashPar(irmao, atual)
+		}
+	}
+	return hex.EncodeToString(atual) == raiz
+}
+
+func (bc *Blockchain) HandleProvaMerkle(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	if r.Method == "OPTIONS" {
+		return
+	}
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		http.Error(w, "Parâmetro 'id' é obrigatório", http.StatusBadRequest)
+		return
+	}
+	bc.mu.Lock()
+	indiceBloco, confirmada := bc.txConfirmadas[id]
+	var bloco Bloco
+	if confirmada {
+		bloco = bc.Blocos[indiceBloco]
+	}
+	bc.mu.Unlock()
+	if !confirmada {
+		http.Error(w, "Transação não encontrada na blockchain", http.StatusNotFound)
+		return
+	}
+	ids := make([]string, len(bloco.Transacoes))
+	posicao := 0
+	for i, tx := range bloco.Transacoes {
+		ids[i] = tx.ID
+		if tx.ID == id {
+			posicao = i
+		}
+	}
+	prova := ProvaMerkle{
+		Transacao:   bloco.Transacoes[posicao],
+		IndiceBloco: bloco.Indice,
+		HashBloco:   bloco.HashAtual,
+		RaizMerkle:  bloco.RaizMerkle,
+		Caminho:     caminhoMerkle(ids, posicao),
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(prova)
+}
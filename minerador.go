@@ -0,0 +1,171 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Tempo que o minerador espera depois de a primeira transação chegar, para
+// juntar as que chegam logo em seguida no mesmo bloco.
+const esperaLote = 200 * time.Millisecond
+
+// Quantos nonces cada trabalhador testa antes de conferir se a ponta mudou.
+const noncesPorVerificacao = 1 << 12
+
+// errPontaMudou indica que a mineração foi abandonada porque outro bloco
+// passou a ser a ponta da cadeia enquanto a prova de trabalho rodava.
+var errPontaMudou = errors.New("a ponta da cadeia mudou durante a mineração")
+
+func trabalhadoresPadrao() int {
+	return runtime.NumCPU()
+}
+
+// Minerar roda para sempre empacotando as transações do mempool em blocos.
+func (bc *Blockchain) Minerar() {
+	for {
+		<-bc.mempool.novas
+		time.Sleep(esperaLote)
+		for bc.mempool.Tamanho() > 0 {
+			if _, ok := bc.MinerarPendentes(); !ok {
+				break
+			}
+		}
+	}
+}
+
+// MinerarPendentes minera um bloco com as transações pendentes mais antigas.
+// Se a ponta mudar no meio da prova de trabalho, as transações são
+// selecionadas de novo sobre a nova ponta.
+func (bc *Blockchain) MinerarPendentes() (Bloco, bool) {
+	for {
+		transacoes := bc.selecionarTransacoes()
+		if len(transacoes) == 0 {
+			return Bloco{}, false
+		}
+		bloco, err := bc.minerarBloco(transacoes)
+		if errors.Is(err, errPontaMudou) {
+			log.Printf("Ponta mudou durante a mineração; recomeçando sobre a nova ponta")
+			continue
+		}
+		if err != nil {
+			log.Printf("Erro ao minerar bloco com %d transação(ões): %v", len(transacoes), err)
+			return Bloco{}, false
+		}
+		log.Printf("Bloco %d minerado com %d transação(ões)", bloco.Indice, len(transacoes))
+		return bloco, true
+	}
+}
+
+// selecionarTransacoes escolhe, na ordem de chegada, as transações pendentes
+// que o estado atual aceita. As recusadas (nonce já usado, saldo
+// insuficiente...) saem do mempool; as de nonce adiantado esperam as
+// anteriores da mesma conta.
+func (bc *Blockchain) selecionarTransacoes() []Transacao {
+	bc.mu.Lock()
+	// O bloco terá um timestamp igual ou pouco posterior a este; uma aposta
+	// que perca o prazo nesse meio tempo é recusada na próxima seleção.
+	instante, _ := time.Parse(time.RFC3339, timestampCanonico(bc.ponta.bloco))
+	selecionadas, recusadas := bc.estado.Simular(bc.mempool.Pendentes(), instante, maxTransacoesPorBloco)
+	bc.mu.Unlock()
+	bc.mempool.Remover(idsTransacoes(recusadas)...)
+	return selecionadas
+}
+
+// minerarBloco monta um bloco sobre a ponta atual e faz a prova de trabalho
+// sem segurar bc.mu, para não travar os endpoints de leitura nem a recepção de
+// blocos dos peers. Devolve errPontaMudou se a ponta mudar antes do fim.
+func (bc *Blockchain) minerarBloco(transacoes []Transacao) (Bloco, error) {
+	// Um bloco por vez: blocos minerados em paralelo pelo próprio nó só
+	// competiriam entre si pela mesma ponta.
+	bc.muMineracao.Lock()
+	defer bc.muMineracao.Unlock()
+	bc.mu.Lock()
+	ultimoBloco := bc.ponta.bloco
+	// O estado da ponta já está aplicado, então não há erro possível
+	dificuldade, _ := bc.dificuldadeEsperada(bc.ponta)
+	novoBloco := Bloco{
+		Versao:       versaoCabecalhoAtual,
+		ChainID:      bc.genesis.ChainID,
+		Indice:       ultimoBloco.Indice + 1,
+		Timestamp:    timestampCanonico(ultimoBloco),
+		Evento:       "transacoes",
+		HashAnterior: ultimoBloco.HashAtual,
+		Dificuldade:  dificuldade,
+		RaizMerkle:   raizMerkle(idsTransacoes(transacoes)),
+		Transacoes:   transacoes,
+	}
+	pontaMudou := bc.novaPonta
+	trabalhadores := bc.trabalhadoresMineracao
+	bc.mu.Unlock()
+
+	nonce, hash, ok := provaDeTrabalhoParalela(novoBloco, trabalhadores, pontaMudou)
+	if !ok {
+		return Bloco{}, errPontaMudou
+	}
+	novoBloco.Nonce = nonce
+	novoBloco.HashAtual = hash
+
+	bc.mu.Lock()
+	if bc.ponta.bloco.HashAtual != novoBloco.HashAnterior {
+		bc.mu.Unlock()
+		return Bloco{}, errPontaMudou
+	}
+	err := bc.inserirBloco(novoBloco)
+	bc.mu.Unlock()
+	if err != nil {
+		return Bloco{}, err
+	}
+	go bc.NotificarPeers(novoBloco)
+	return novoBloco, nil
+}
+
+// provaDeTrabalhoParalela divide a busca do nonce entre trabalhadores: o
+// trabalhador i testa os nonces i, i+n, i+2n... Devolve ok falso se cancelar
+// for fechado antes de algum deles encontrar um hash válido.
+func provaDeTrabalhoParalela(bloco Bloco, trabalhadores int, cancelar <-chan struct{}) (int, string, bool) {
+	if trabalhadores < 1 {
+		trabalhadores = 1
+	}
+	prefixo := strings.Repeat("0", bloco.Dificuldade)
+	type resultado struct {
+		nonce int
+		hash  string
+	}
+	encontrado := make(chan resultado, trabalhadores)
+	parar := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < trabalhadores; i++ {
+		wg.Add(1)
+		go func(candidato Bloco, inicio int) {
+			defer wg.Done()
+			for nonce := inicio; ; nonce += trabalhadores {
+				if (nonce/trabalhadores)%noncesPorVerificacao == 0 {
+					select {
+					case <-parar:
+						return
+					case <-cancelar:
+						return
+					default:
+					}
+				}
+				candidato.Nonce = nonce
+				hash := calculaHash(candidato)
+				if strings.HasPrefix(hash, prefixo) {
+					encontrado <- resultado{nonce, hash}
+					return
+				}
+			}
+		}(bloco, i)
+	}
+	go func() {
+		wg.Wait()
+		close(encontrado)
+	}()
+	r, ok := <-encontrado
+	close(parar)
+	return r.nonce, r.hash, ok
+}
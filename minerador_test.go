@@ -0,0 +1,48 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// Testa que a prova de trabalho dividida entre vários trabalhadores encontra um hash válido
+func TestProvaDeTrabalhoParalela(t *testing.T) {
+	bloco := Bloco{Indice: 1, Timestamp: "2024-01-01T00:00:00Z", Evento: "teste", Dificuldade: 3}
+	nonce, hash, ok := provaDeTrabalhoParalela(bloco, 4, make(chan struct{}))
+	if !ok {
+		t.Fatal("Esperado um nonce válido")
+	}
+	bloco.Nonce = nonce
+	if hash != calculaHash(bloco) || !strings.HasPrefix(hash, "000") {
+		t.Errorf("Hash %s não confere com o nonce %d", hash, nonce)
+	}
+}
+
+// Testa que a mineração em andamento é abandonada quando outro bloco vira a ponta
+func TestMineracaoAbandonadaQuandoPontaMuda(t *testing.T) {
+	bc := NovoBlockchain(nil)
+	bc.mu.Lock()
+	pontaMudou := bc.novaPonta
+	bc.mu.Unlock()
+
+	// Dificuldade impossível: só termina se for cancelada
+	bloco := Bloco{Indice: 1, Timestamp: "2024-01-01T00:00:00Z", Evento: "teste", Dificuldade: 64}
+	terminou := make(chan bool)
+	go func() {
+		_, _, ok := provaDeTrabalhoParalela(bloco, 2, pontaMudou)
+		terminou <- ok
+	}()
+
+	if novo := bc.AdicionarRegistro("registro"); novo.HashAtual == "" {
+		t.Fatal("Bloco deveria ter sido minerado com a outra mineração em andamento")
+	}
+	select {
+	case ok := <-terminou:
+		if ok {
+			t.Error("Mineração não deveria ter encontrado um nonce")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Mineração não foi abandonada depois da mudança de ponta")
+	}
+}
@@ -0,0 +1,333 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+)
+
+const (
+	maxOrfaos      = 200
+	maxBytesOrfaos = 4 << 20
+	validadeOrfao  = 10 * time.Minute
+	// Além desta distância da ponta, pedir os ancestrais um a um sai mais
+	// caro que uma rodada de sincronização por cabeçalhos.
+	maxAncestraisBuscados = 32
+)
+
+// orfao é um bloco recebido antes do pai.
+type orfao struct {
+	bloco    Bloco
+	origem   string
+	recebido time.Time
+	tamanho  int
+}
+
+// Orfao descreve um bloco do pool para /orfaos.
+type Orfao struct {
+	Hash         string `json:"hash"`
+	Indice       int    `json:"index"`
+	HashAnterior string `json:"hash_anterior"`
+	Origem       string `json:"origem,omitempty"`
+	Recebido     string `json:"recebido"`
+}
+
+// PoolOrfaos guarda blocos cujo pai ainda não é conhecido, até o pai chegar
+// ou o prazo de validade passar. Quando o pool enche, os mais antigos saem
+// primeiro. Como a árvore, deve ser usado com bc.mu travado.
+type PoolOrfaos struct {
+	orfaos map[string]*orfao
+	// filhos indexa os órfãos pelo hash do pai que falta
+	filhos map[string][]string
+	bytes  int
+	// buscando marca os ancestrais que já estão sendo pedidos a algum peer
+	buscando map[string]bool
+}
+
+func NovoPoolOrfaos() *PoolOrfaos {
+	return &PoolOrfaos{
+		orfaos:   make(map[string]*orfao),
+		filhos:   make(map[string][]string),
+		buscando: make(map[string]bool),
+	}
+}
+
+func (p *PoolOrfaos) Contem(hash string) bool {
+	_, existe := p.orfaos[hash]
+	return existe
+}
+
+func (p *PoolOrfaos) Tamanho() int {
+	return len(p.orfaos)
+}
+
+// Adicionar guarda o bloco, abrindo espaço com a saída dos mais antigos.
+// Devolve false se ele já estava no pool ou sozinho não cabe no limite.
+func (p *PoolOrfaos) Adicionar(bloco Bloco, origem string, agora time.Time) bool {
+	p.expirar(agora)
+	if p.Contem(bloco.HashAtual) {
+		return false
+	}
+	dados, err := json.Marshal(bloco)
+	if err != nil || len(dados) > maxBytesOrfaos {
+		return false
+	}
+	for len(p.orfaos) >= maxOrfaos || p.bytes+len(dados) > maxBytesOrfaos {
+		p.remover(p.maisAntigo())
+	}
+	p.orfaos[bloco.HashAtual] = &orfao{bloco: bloco, origem: origem, recebido: agora, tamanho: len(dados)}
+	p.filhos[bloco.HashAnterior] = append(p.filhos[bloco.HashAnterior], bloco.HashAtual)
+	p.bytes += len(dados)
+	return true
+}
+
+func (p *PoolOrfaos) maisAntigo() string {
+	var antigo *orfao
+	for _, o := range p.orfaos {
+		if antigo == nil || o.recebido.Before(antigo.recebido) {
+			antigo = o
+		}
+	}
+	return antigo.bloco.HashAtual
+}
+
+func (p *PoolOrfaos) expirar(agora time.Time) {
+	for hash, o := range p.orfaos {
+		if agora.Sub(o.recebido) > validadeOrfao {
+			p.remover(hash)
+		}
+	}
+}
+
+func (p *PoolOrfaos) remover(hash string) {
+	o, existe := p.orfaos[hash]
+	if !existe {
+		return
+	}
+	delete(p.orfaos, hash)
+	p.bytes -= o.tamanho
+	irmaos := p.filhos[o.bloco.HashAnterior]
+	for i, irmao := range irmaos {
+		if irmao == hash {
+			irmaos = append(irmaos[:i:i], irmaos[i+1:]...)
+			break
+		}
+	}
+	if len(irmaos) == 0 {
+		delete(p.filhos, o.bloco.HashAnterior)
+	} else {
+		p.filhos[o.bloco.HashAnterior] = irmaos
+	}
+}
+
+// retirarFilhos tira do pool e devolve os órfãos cujo pai é hash.
+func (p *PoolOrfaos) retirarFilhos(hash string) []*orfao {
+	var filhos []*orfao
+	for _, filho := range append([]string(nil), p.filhos[hash]...) {
+		filhos = append(filhos, p.orfaos[filho])
+		p.remover(filho)
+	}
+	return filhos
+}
+
+// descartarDescendentes tira do pool tudo o que descende de hash, que não
+// poderá mais ser ligado à árvore.
+func (p *PoolOrfaos) descartarDescendentes(hash string) {
+	for _, filho := range p.retirarFilhos(hash) {
+		p.descartarDescendentes(filho.bloco.HashAtual)
+	}
+}
+
+// ancestralFaltando sobe pelos órfãos a partir de hash e devolve o hash do
+// primeiro bloco que nem a árvore nem o pool têm.
+func (p *PoolOrfaos) ancestralFaltando(hash string) string {
+	for {
+		o, existe := p.orfaos[hash]
+		if !existe {
+			return hash
+		}
+		hash = o.bloco.HashAnterior
+	}
+}
+
+func (p *PoolOrfaos) Listar() []Orfao {
+	lista := make([]Orfao, 0, len(p.orfaos))
+	for _, o := range p.orfaos {
+		lista = append(lista, Orfao{
+			Hash:         o.bloco.HashAtual,
+			Indice:       o.bloco.Indice,
+			HashAnterior: o.bloco.HashAnterior,
+			Origem:       o.origem,
+			Recebido:     o.recebido.Format(time.RFC3339),
+		})
+	}
+	sort.Slice(lista, func(i, j int) bool {
+		if lista[i].Indice != lista[j].Indice {
+			return lista[i].Indice < lista[j].Indice
+		}
+		return lista[i].Hash < lista[j].Hash
+	})
+	return lista
+}
+
+// receberBloco guarda um bloco vindo de um peer e repassa aos demais peers
+// os blocos que entraram na árvore por causa dele. Se o pai ainda não for
+// conhecido, o bloco vai para o pool de órfãos e faltando é o hash do
+// ancestral que precisa ser pedido (vazio se já estiver sendo pedido). Deve
+// ser chamado com bc.mu travado.
+func (bc *Blockchain) receberBloco(bloco Bloco, origem string) (no *noBloco, faltando string, err error) {
+	if bc.arvore.Contem(bloco.HashAnterior) {
+		novo := !bc.arvore.Contem(bloco.HashAtual)
+		if no, err = bc.guardarBloco(bloco); err != nil {
+			return nil, "", err
+		}
+		melhor, ligados := bc.conectarOrfaos(no)
+		err = bc.escolherPonta(melhor)
+		if novo {
+			ligados = append([]*noBloco{no}, ligados...)
+		}
+		var itens []ItemInventario
+		for _, ligado := range ligados {
+			// Um ramo que não pôde ser aplicado não se espalha
+			if !ligado.invalido {
+				itens = append(itens, ItemInventario{Tipo: invBloco, Hash: ligado.bloco.HashAtual})
+			}
+		}
+		if len(itens) > 0 {
+			go bc.anunciar(itens...)
+		}
+		return no, "", err
+	}
+	// Só a prova de trabalho impede que o pool se encha de lixo: o resto
+	// depende do pai. Exigir ao menos a dificuldade que a ponta ainda
+	// permite na altura do órfão impede que órfãos baratos de minerar ocupem
+	// o pool e disparem buscas. A faixa da dificuldade vem antes, porque a
+	// prova de trabalho não aceita qualquer valor.
+	if bc.genesis.limitarDificuldade(bloco.Dificuldade) != bloco.Dificuldade {
+		return nil, "", rejeitar(MotivoDificuldade, "órfão com dificuldade %d fora da faixa", bloco.Dificuldade)
+	}
+	ponta := bc.ponta.bloco
+	if minima := bc.genesis.dificuldadeMinimaAte(ponta.Dificuldade, ponta.Indice, bloco.Indice); bloco.Dificuldade < minima {
+		return nil, "", rejeitar(MotivoDificuldade, "órfão com dificuldade %d, abaixo da %d possível na altura %d", bloco.Dificuldade, minima, bloco.Indice)
+	}
+	if !bc.ValidarBloco(bloco) {
+		return nil, "", rejeitar(MotivoHashInvalido, "órfão com hash ou prova de trabalho inválidos")
+	}
+	if !bc.orfaos.Adicionar(bloco, origem, time.Now()) {
+		return nil, "", nil
+	}
+	faltando = bc.orfaos.ancestralFaltando(bloco.HashAtual)
+	if bc.orfaos.buscando[faltando] {
+		return nil, "", nil
+	}
+	bc.orfaos.buscando[faltando] = true
+	return nil, faltando, nil
+}
+
+// receberBlocoTravando chama receberBloco com bc.mu travado e diz também se
+// o bloco virou a ponta. Deve ser chamado sem bc.mu.
+func (bc *Blockchain) receberBlocoTravando(bloco Bloco, origem string) (no *noBloco, faltando string, adicionado bool, err error) {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	no, faltando, err = bc.receberBloco(bloco, origem)
+	return no, faltando, no != nil && bc.ponta == no, err
+}
+
+// conectarOrfaos guarda na árvore os órfãos que descendem de no e devolve,
+// entre no e eles, o de maior trabalho acumulado, além dos que foram
+// ligados. Deve ser chamado com bc.mu travado.
+func (bc *Blockchain) conectarOrfaos(no *noBloco) (melhor *noBloco, ligados []*noBloco) {
+	melhor = no
+	fila := []string{no.bloco.HashAtual}
+	for len(fila) > 0 {
+		hash := fila[0]
+		fila = fila[1:]
+		for _, o := range bc.orfaos.retirarFilhos(hash) {
+			filho, err := bc.guardarBloco(o.bloco)
+			if err != nil {
+				log.Printf("Órfão %d descartado: %v", o.bloco.Indice, err)
+				bc.orfaos.descartarDescendentes(o.bloco.HashAtual)
+				continue
+			}
+			if filho.trabalho.Cmp(melhor.trabalho) > 0 {
+				melhor = filho
+			}
+			ligados = append(ligados, filho)
+			fila = append(fila, filho.bloco.HashAtual)
+		}
+	}
+	return melhor, ligados
+}
+
+// buscarAncestrais pede os blocos que faltam para ligar um órfão à árvore,
+// do mais novo para o mais antigo, primeiro a quem mandou o órfão, se for um
+// peer ativo, e depois aos demais peers. A origem é só declarada por quem
+// mandou, e não pode levar este nó a discar um endereço qualquer. Se faltarem
+// muitos, recorre à sincronização por cabeçalhos.
+func (bc *Blockchain) buscarAncestrais(hash, origem string) {
+	marcados := []string{hash}
+	defer func() {
+		bc.mu.Lock()
+		defer bc.mu.Unlock()
+		for _, marcado := range marcados {
+			delete(bc.orfaos.buscando, marcado)
+		}
+	}()
+	fontes := bc.peers.Ativos()
+	if origem != "" && bc.peers.Ativo(origem) {
+		fontes = append([]string{origem}, fontes...)
+	}
+	for buscados := 0; hash != ""; buscados++ {
+		if buscados == maxAncestraisBuscados {
+			log.Printf("Mais de %d ancestrais faltando, sincronizando com os peers", maxAncestraisBuscados)
+			bc.SincronizarComPeers()
+			return
+		}
+		bloco, ok := bc.pedirAncestral(hash, fontes)
+		if !ok {
+			log.Printf("Nenhum peer tem o bloco %s", hash)
+			return
+		}
+		_, faltando, _, err := bc.receberBlocoTravando(bloco, origem)
+		if faltando != "" {
+			marcados = append(marcados, faltando)
+		}
+		if err != nil {
+			log.Printf("Ancestral %d recebido é inválido: %v", bloco.Indice, err)
+			return
+		}
+		hash = faltando
+	}
+}
+
+func (bc *Blockchain) pedirAncestral(hash string, fontes []string) (Bloco, bool) {
+	vistos := make(map[string]bool)
+	for _, endereco := range fontes {
+		if vistos[endereco] {
+			continue
+		}
+		vistos[endereco] = true
+		if blocos, err := bc.pedirBlocos(endereco, []string{hash}); err == nil {
+			return blocos[0], true
+		}
+	}
+	return Bloco{}, false
+}
+
+// HandleOrfaos lista os blocos que aguardam o pai.
+func (bc *Blockchain) HandleOrfaos(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	if r.Method == "OPTIONS" {
+		return
+	}
+	bc.mu.Lock()
+	bc.orfaos.expirar(time.Now())
+	orfaos := bc.orfaos.Listar()
+	bc.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(orfaos)
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Testa que blocos recebidos de trás para a frente esperam no pool e entram na cadeia quando o pai chega
+func TestOrfaosConectadosForaDeOrdem(t *testing.T) {
+	a, b := NovoBlockchain(nil), NovoBlockchain(nil)
+	minerarBlocos(a, 3, "A")
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	alterado := a.Blocos[3]
+	alterado.Nonce++
+	if _, _, err := b.receberBloco(alterado, ""); motivoDe(err) != MotivoHashInvalido {
+		t.Errorf("Órfão sem prova de trabalho deveria ser recusado, obtido %v", err)
+	}
+	// Órfão com prova de trabalho válida, mas abaixo da dificuldade da ponta
+	facil := a.Blocos[3]
+	facil.Dificuldade = b.ponta.bloco.Dificuldade - 1
+	for facil.HashAtual = calculaHash(facil); !b.ValidarBloco(facil); facil.HashAtual = calculaHash(facil) {
+		facil.Nonce++
+	}
+	if _, _, err := b.receberBloco(facil, ""); motivoDe(err) != MotivoDificuldade {
+		t.Errorf("Órfão abaixo da dificuldade da ponta deveria ser recusado, obtido %v", err)
+	}
+	// Depois de uma altura de ajuste a dificuldade pode ter baixado
+	ajustado := facil
+	ajustado.Indice = 2 * b.genesis.intervaloAjuste()
+	for ajustado.HashAtual = calculaHash(ajustado); !b.ValidarBloco(ajustado); ajustado.HashAtual = calculaHash(ajustado) {
+		ajustado.Nonce++
+	}
+	if _, faltando, err := b.receberBloco(ajustado, ""); err != nil || faltando != ajustado.HashAnterior {
+		t.Errorf("Órfão depois de um ajuste para baixo deveria esperar o pai, obtido %q, %v", faltando, err)
+	}
+	b.orfaos = NovoPoolOrfaos()
+	if _, faltando, err := b.receberBloco(a.Blocos[3], ""); err != nil || faltando != a.Blocos[2].HashAtual {
+		t.Fatalf("Deveria pedir o bloco 2, obtido %q, %v", faltando, err)
+	}
+	if _, faltando, _ := b.receberBloco(a.Blocos[3], ""); faltando != "" {
+		t.Errorf("Órfão repetido não deveria gerar novo pedido, obtido %q", faltando)
+	}
+	if _, faltando, _ := b.receberBloco(a.Blocos[2], ""); faltando != a.Blocos[1].HashAtual || b.orfaos.Tamanho() != 2 {
+		t.Fatalf("Deveria pedir o bloco 1 com dois órfãos no pool, obtido %q e %d", faltando, b.orfaos.Tamanho())
+	}
+	if _, _, err := b.receberBloco(a.Blocos[1], ""); err != nil {
+		t.Fatal(err)
+	}
+	if b.ponta.bloco.HashAtual != a.ponta.bloco.HashAtual || b.orfaos.Tamanho() != 0 {
+		t.Errorf("Órfãos deveriam ser ligados à cadeia, altura %d com %d no pool", len(b.Blocos)-1, b.orfaos.Tamanho())
+	}
+}
+
+// Testa que os ancestrais que faltam são pedidos a quem mandou o órfão, só se for um peer ativo
+func TestOrfaoBuscaAncestraisNoRemetente(t *testing.T) {
+	a, b := NovoBlockchain(nil), NovoBlockchain(nil)
+	minerarBlocos(a, 5, "A")
+	enderecoA := servirPeer(t, a)
+
+	b.mu.Lock()
+	_, faltando, err := b.receberBloco(a.Blocos[5], enderecoA)
+	b.mu.Unlock()
+	if err != nil || faltando == "" {
+		t.Fatalf("Bloco 5 deveria virar órfão, obtido %q, %v", faltando, err)
+	}
+	// A origem é só declarada: sem ser peer ativo, não é discada
+	b.buscarAncestrais(faltando, enderecoA)
+	if len(b.Blocos) != 1 || len(b.orfaos.buscando) != 0 {
+		t.Fatalf("Origem que não é peer ativo não deveria ser consultada, altura %d", len(b.Blocos)-1)
+	}
+	conectar(t, b, enderecoA)
+	b.buscarAncestrais(faltando, enderecoA)
+	if b.ponta.bloco.HashAtual != a.ponta.bloco.HashAtual {
+		t.Fatalf("b deveria alcançar a buscando os ancestrais, está na altura %d", len(b.Blocos)-1)
+	}
+	if b.orfaos.Tamanho() != 0 || len(b.orfaos.buscando) != 0 {
+		t.Errorf("Pool deveria estar vazio, obtido %+v", b.orfaos.Listar())
+	}
+}
+
+// Testa o limite de blocos do pool e a expiração dos órfãos antigos
+func TestLimitesDoPoolOrfaos(t *testing.T) {
+	pool := NovoPoolOrfaos()
+	inicio := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	for i := 0; i <= maxOrfaos; i++ {
+		bloco := Bloco{Indice: i + 2, HashAtual: fmt.Sprintf("h%d", i), HashAnterior: fmt.Sprintf("p%d", i)}
+		pool.Adicionar(bloco, "", inicio.Add(time.Duration(i)*time.Second))
+	}
+	if pool.Tamanho() != maxOrfaos || pool.Contem("h0") || !pool.Contem("h1") {
+		t.Errorf("O órfão mais antigo deveria sair quando o pool enche, obtido %d órfãos", pool.Tamanho())
+	}
+	pool.Adicionar(Bloco{Indice: 1, HashAtual: "novo", HashAnterior: "x"}, "", inicio.Add(2*validadeOrfao))
+	if pool.Tamanho() != 1 || !pool.Contem("novo") || len(pool.filhos) != 1 || pool.bytes != pool.orfaos["novo"].tamanho {
+		t.Errorf("Órfãos vencidos deveriam expirar, obtido %+v", pool.Listar())
+	}
+}
+
+// Testa que um órfão com dificuldade negativa é recusado sem derrubar o nó nem deixar a trava presa
+func TestOrfaoComDificuldadeNegativa(t *testing.T) {
+	a, b := NovoBlockchain(nil), NovoBlockchain(nil)
+	minerarBlocos(a, 3, "A")
+	negativo := a.Blocos[3]
+	negativo.Dificuldade = -1
+	negativo.HashAtual = calculaHash(negativo)
+	if b.ValidarBloco(negativo) {
+		t.Error("Bloco com dificuldade negativa não deveria ser válido")
+	}
+
+	corpo, _ := json.Marshal(negativo)
+	resposta := httptest.NewRecorder()
+	b.ReceberBloco(resposta, httptest.NewRequest(http.MethodPost, "/receber-bloco", bytes.NewReader(corpo)))
+	if !strings.Contains(resposta.Body.String(), "inválido") {
+		t.Errorf("Órfão com dificuldade negativa deveria ser recusado, obtido %q", resposta.Body.String())
+	}
+	if !b.mu.TryLock() {
+		t.Fatal("A trava do nó deveria estar livre depois do bloco recusado")
+	}
+	b.mu.Unlock()
+}
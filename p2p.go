@@ -0,0 +1,850 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Sessões persistentes entre nós. A conexão começa como uma requisição HTTP
+// em /p2p que é promovida (101 Switching Protocols) a um fluxo de mensagens
+// binárias, para que o nó continue ouvindo numa porta só. Cada sessão tem
+// uma fila de envio própria; quem discou reconecta com espera exponencial.
+
+const (
+	protocoloP2P       = "blockchain-p2p/1"
+	maxTamanhoMensagem = 8 << 20
+	maxItensInventario = 1000
+	tamanhoFilaEnvio   = 256
+	// Uma fila cheia por mais que isto indica um peer que não está lendo
+	esperaFilaCheia    = 2 * time.Second
+	intervaloPing      = 30 * time.Second
+	esperaReconexaoMin = time.Second
+	esperaReconexaoMax = time.Minute
+)
+
+// Tipos de mensagem. Handshake, blocos, transações e cabeçalhos levam o
+// mesmo JSON da API HTTP; inventários e pings têm codificação própria.
+const (
+	msgHandshake byte = iota + 1
+	msgInv
+	msgGetData
+	msgBloco
+	msgTransacao
+	msgPing
+	msgPong
+	msgGetHeaders
+	msgCabecalhos
+)
+
+// Tipos de item de inventário.
+const (
+	invBloco     byte = 1
+	invTransacao byte = 2
+)
+
+// Mensagem é um quadro do protocolo, com inteiros big-endian:
+//
+//	tamanho uint32 (só dos dados)
+//	tipo    uint8
+//	dados   tamanho bytes
+type Mensagem struct {
+	Tipo  byte
+	Dados []byte
+}
+
+func escreverMensagem(w io.Writer, m Mensagem) error {
+	if len(m.Dados) > maxTamanhoMensagem {
+		return fmt.Errorf("mensagem de %d bytes excede o limite", len(m.Dados))
+	}
+	quadro := make([]byte, 5+len(m.Dados))
+	binary.BigEndian.PutUint32(quadro, uint32(len(m.Dados)))
+	quadro[4] = m.Tipo
+	copy(quadro[5:], m.Dados)
+	_, err := w.Write(quadro)
+	return err
+}
+
+func lerMensagem(r io.Reader) (Mensagem, error) {
+	var cabecalho [5]byte
+	if _, err := io.ReadFull(r, cabecalho[:]); err != nil {
+		return Mensagem{}, err
+	}
+	tamanho := binary.BigEndian.Uint32(cabecalho[:4])
+	if tamanho > maxTamanhoMensagem {
+		return Mensagem{}, fmt.Errorf("mensagem de %d bytes excede o limite", tamanho)
+	}
+	m := Mensagem{Tipo: cabecalho[4], Dados: make([]byte, tamanho)}
+	_, err := io.ReadFull(r, m.Dados)
+	return m, err
+}
+
+func mensagemJSON(tipo byte, v interface{}) (Mensagem, error) {
+	dados, err := json.Marshal(v)
+	return Mensagem{Tipo: tipo, Dados: dados}, err
+}
+
+// ItemInventario identifica um bloco ou transação pelo hash.
+type ItemInventario struct {
+	Tipo byte
+	Hash string
+}
+
+// codificarInventario monta os dados de inv e getdata: cada item é o tipo
+// (uint8) seguido do hash (32 bytes).
+func codificarInventario(itens []ItemInventario) ([]byte, error) {
+	if len(itens) > maxItensInventario {
+		return nil, fmt.Errorf("%d itens excedem o limite de %d", len(itens), maxItensInventario)
+	}
+	dados := make([]byte, 0, len(itens)*(1+tamanhoHash))
+	for _, item := range itens {
+		hash, err := decodificarHash(item.Hash)
+		if err != nil {
+			return nil, err
+		}
+		dados = append(append(dados, item.Tipo), hash...)
+	}
+	return dados, nil
+}
+
+func decodificarInventario(dados []byte) ([]ItemInventario, error) {
+	tamanhoItem := 1 + tamanhoHash
+	if len(dados)%tamanhoItem != 0 || len(dados)/tamanhoItem > maxItensInventario {
+		return nil, fmt.Errorf("inventário de %d bytes malformado", len(dados))
+	}
+	itens := make([]ItemInventario, 0, len(dados)/tamanhoItem)
+	for i := 0; i < len(dados); i += tamanhoItem {
+		tipo := dados[i]
+		if tipo != invBloco && tipo != invTransacao {
+			return nil, fmt.Errorf("tipo de item %d desconhecido", tipo)
+		}
+		itens = append(itens, ItemInventario{Tipo: tipo, Hash: fmt.Sprintf("%x", dados[i+1:i+tamanhoItem])})
+	}
+	return itens, nil
+}
+
+// Sessao é uma conexão aberta com um peer. As mensagens a enviar passam pela
+// fila, que uma goroutine esvazia; as recebidas são tratadas uma por vez por
+// atenderSessao.
+type Sessao struct {
+	// No é a carteira do peer; Endereco a URL dele, vazia numa sessão de
+	// entrada de um nó que não informou como ser alcançado.
+	No       string
+	Endereco string
+	Saida    bool
+	Desde    time.Time
+	conn     net.Conn
+	leitor   *bufio.Reader
+	fila     chan Mensagem
+	fim      chan struct{}
+	fechar   sync.Once
+	// conhecidos é o que o peer já tem e não precisa ser anunciado a ele
+	conhecidos *inventarioConhecido
+}
+
+func novaSessao(conn net.Conn, leitor *bufio.Reader, info InfoNo, endereco string, saida bool) *Sessao {
+	return &Sessao{
+		No:         info.No,
+		Endereco:   endereco,
+		Saida:      saida,
+		Desde:      time.Now(),
+		conn:       conn,
+		leitor:     leitor,
+		fila:       make(chan Mensagem, tamanhoFilaEnvio),
+		fim:        make(chan struct{}),
+		conhecidos: novoInventarioConhecido(),
+	}
+}
+
+func (s *Sessao) String() string {
+	if s.Endereco != "" {
+		return s.Endereco
+	}
+	return s.conn.RemoteAddr().String()
+}
+
+// Enviar põe a mensagem na fila. Com a fila cheia espera um pouco e, se o
+// peer continuar sem ler, fecha a sessão em vez de acumular mensagens.
+func (s *Sessao) Enviar(m Mensagem) bool {
+	select {
+	case s.fila <- m:
+		return true
+	case <-s.fim:
+		return false
+	default:
+	}
+	espera := time.NewTimer(esperaFilaCheia)
+	defer espera.Stop()
+	select {
+	case s.fila <- m:
+		return true
+	case <-s.fim:
+		return false
+	case <-espera.C:
+		log.Printf("Fila de envio para %s cheia, encerrando a sessão", s)
+		s.Fechar()
+		return false
+	}
+}
+
+func (s *Sessao) Fechar() {
+	s.fechar.Do(func() {
+		close(s.fim)
+		s.conn.Close()
+	})
+}
+
+func (s *Sessao) escrever() {
+	for {
+		select {
+		case m := <-s.fila:
+			s.conn.SetWriteDeadline(time.Now().Add(tempoLimitePeer))
+			if err := escreverMensagem(s.conn, m); err != nil {
+				s.Fechar()
+				return
+			}
+		case <-s.fim:
+			return
+		}
+	}
+}
+
+func (s *Sessao) pingar() {
+	relogio := time.NewTicker(intervaloPing)
+	defer relogio.Stop()
+	for {
+		select {
+		case agora := <-relogio.C:
+			ping := make([]byte, 8)
+			binary.BigEndian.PutUint64(ping, uint64(agora.UnixNano()))
+			s.Enviar(Mensagem{Tipo: msgPing, Dados: ping})
+		case <-s.fim:
+			return
+		}
+	}
+}
+
+// GerenciadorSessoes guarda as sessões abertas, uma por nó, e os laços de
+// reconexão dos peers que este nó disca.
+type GerenciadorSessoes struct {
+	mu        sync.Mutex
+	sessoes   map[string]*Sessao
+	discando  map[string]bool
+	fim       chan struct{}
+	encerrado bool
+	// pedidos guarda quando cada item foi pedido por getdata
+	pedidos map[string]time.Time
+}
+
+func NovoGerenciadorSessoes() *GerenciadorSessoes {
+	return &GerenciadorSessoes{
+		sessoes:  make(map[string]*Sessao),
+		discando: make(map[string]bool),
+		fim:      make(chan struct{}),
+		pedidos:  make(map[string]time.Time),
+	}
+}
+
+// registrar guarda a sessão. Se os dois nós discaram um para o outro, fica
+// a sessão iniciada pelo nó de carteira menor, decisão que os dois lados
+// tomam igual sem combinar. Sessões de entrada de nós novos são recusadas
+// quando já há maxEntrada delas.
+func (g *GerenciadorSessoes) registrar(s *Sessao, proprio string, maxEntrada int) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.encerrado || (!s.Saida && !g.cabeEntrada(s.No, maxEntrada)) {
+		return false
+	}
+	iniciador := func(s *Sessao) string {
+		if s.Saida {
+			return proprio
+		}
+		return s.No
+	}
+	if existente, ok := g.sessoes[s.No]; ok {
+		if iniciador(s) >= iniciador(existente) {
+			return false
+		}
+		existente.Fechar()
+	}
+	g.sessoes[s.No] = s
+	return true
+}
+
+// aceitaEntrada diz se ainda cabe uma sessão de entrada do nó.
+func (g *GerenciadorSessoes) aceitaEntrada(no string, maxEntrada int) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.cabeEntrada(no, maxEntrada)
+}
+
+// cabeEntrada deve ser chamado com g.mu travado. Uma sessão que substitui a
+// do mesmo nó não aumenta o número de sessões.
+func (g *GerenciadorSessoes) cabeEntrada(no string, maxEntrada int) bool {
+	if _, existe := g.sessoes[no]; existe {
+		return true
+	}
+	entradas := 0
+	for _, s := range g.sessoes {
+		if !s.Saida {
+			entradas++
+		}
+	}
+	return entradas < maxEntrada
+}
+
+func (g *GerenciadorSessoes) remover(s *Sessao) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.sessoes[s.No] == s {
+		delete(g.sessoes, s.No)
+	}
+}
+
+// Listar devolve as sessões abertas, das mais antigas para as mais novas.
+func (g *GerenciadorSessoes) Listar() []*Sessao {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	sessoes := make([]*Sessao, 0, len(g.sessoes))
+	for _, s := range g.sessoes {
+		sessoes = append(sessoes, s)
+	}
+	sort.Slice(sessoes, func(i, j int) bool { return sessoes[i].Desde.Before(sessoes[j].Desde) })
+	return sessoes
+}
+
+func (g *GerenciadorSessoes) conectadoA(endereco string) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for _, s := range g.sessoes {
+		if s.Endereco == endereco {
+			return true
+		}
+	}
+	return false
+}
+
+// Encerrar fecha todas as sessões e para as reconexões.
+func (g *GerenciadorSessoes) Encerrar() {
+	g.mu.Lock()
+	if g.encerrado {
+		g.mu.Unlock()
+		return
+	}
+	g.encerrado = true
+	close(g.fim)
+	sessoes := make([]*Sessao, 0, len(g.sessoes))
+	for _, s := range g.sessoes {
+		sessoes = append(sessoes, s)
+	}
+	g.mu.Unlock()
+	for _, s := range sessoes {
+		s.Fechar()
+	}
+}
+
+// ConectarSessoes abre um laço de conexão para cada peer ativo que ainda não
+// tem um.
+func (bc *Blockchain) ConectarSessoes() {
+	for _, endereco := range bc.peers.Ativos() {
+		bc.sessoes.mu.Lock()
+		novo := !bc.sessoes.discando[endereco] && !bc.sessoes.encerrado
+		bc.sessoes.discando[endereco] = true
+		bc.sessoes.mu.Unlock()
+		if novo {
+			go bc.manterSessao(endereco)
+		}
+	}
+}
+
+// manterSessao mantém uma sessão aberta com o peer enquanto ele for
+// conhecido, dobrando a espera entre tentativas que falham.
+func (bc *Blockchain) manterSessao(endereco string) {
+	defer func() {
+		bc.sessoes.mu.Lock()
+		delete(bc.sessoes.discando, endereco)
+		bc.sessoes.mu.Unlock()
+	}()
+	espera := esperaReconexaoMin
+	for bc.peers.Conhece(endereco) {
+		// Uma sessão aberta pelo próprio peer também serve
+		if !bc.sessoes.conectadoA(endereco) {
+			estabelecida, err := bc.conectarSessao(endereco)
+			if estabelecida {
+				espera = esperaReconexaoMin
+			} else if err != nil {
+				log.Printf("Sessão com %s falhou: %v (nova tentativa em %s)", endereco, err, espera)
+			}
+		}
+		select {
+		case <-bc.sessoes.fim:
+			return
+		case <-time.After(espera):
+		}
+		espera = min(2*espera, esperaReconexaoMax)
+	}
+}
+
+// conectarSessao disca o peer e atende a sessão até ela cair.
+func (bc *Blockchain) conectarSessao(endereco string) (estabelecida bool, err error) {
+	conn, leitor, err := discarP2P(endereco, bc.peers.discadorPara(endereco))
+	if err != nil {
+		return false, err
+	}
+	info, err := bc.handshakeSessao(conn, leitor, true)
+	if err != nil {
+		conn.Close()
+		return false, err
+	}
+	s := novaSessao(conn, leitor, info, endereco, true)
+	if !bc.sessoes.registrar(s, bc.carteira.Endereco, bc.peers.maxPeers) {
+		s.Fechar()
+		return false, nil
+	}
+	bc.atenderSessao(s)
+	return true, nil
+}
+
+func discarP2P(endereco string, discador *net.Dialer) (net.Conn, *bufio.Reader, error) {
+	u, err := url.Parse(endereco)
+	if err != nil {
+		return nil, nil, err
+	}
+	if u.Scheme != "http" {
+		return nil, nil, fmt.Errorf("sessões só são abertas sobre http")
+	}
+	porta := u.Port()
+	if porta == "" {
+		porta = "80"
+	}
+	conn, err := discador.Dial("tcp", net.JoinHostPort(u.Hostname(), porta))
+	if err != nil {
+		return nil, nil, err
+	}
+	conn.SetDeadline(time.Now().Add(tempoLimitePeer))
+	req, err := http.NewRequest(http.MethodGet, endereco+"/p2p", nil)
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", protocoloP2P)
+	if err := req.Write(conn); err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	leitor := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(leitor, req)
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		conn.Close()
+		return nil, nil, fmt.Errorf("upgrade recusado com status %d", resp.StatusCode)
+	}
+	conn.SetDeadline(time.Time{})
+	return conn, leitor, nil
+}
+
+// handshakeSessao troca a descrição dos nós pela própria sessão e confere
+// que o peer tem a chave do nó que diz ser. Quem discou fala primeiro e manda
+// um desafio; a resposta traz a assinatura dele e outro desafio, que quem
+// discou assina numa terceira mensagem.
+func (bc *Blockchain) handshakeSessao(conn net.Conn, leitor *bufio.Reader, saida bool) (InfoNo, error) {
+	conn.SetDeadline(time.Now().Add(tempoLimitePeer))
+	defer conn.SetDeadline(time.Time{})
+	desafio, err := novoDesafio()
+	if err != nil {
+		return InfoNo{}, err
+	}
+	proprio := bc.infoNo()
+	proprio.Desafio = desafio
+	if saida {
+		if err := enviarHandshake(conn, proprio); err != nil {
+			return InfoNo{}, err
+		}
+	}
+	info, err := lerHandshake(leitor)
+	if err != nil {
+		return InfoNo{}, err
+	}
+	if err := bc.conferirInfo(info); err != nil {
+		return InfoNo{}, err
+	}
+	if saida {
+		if err := conferirProva(info, desafio); err != nil {
+			return InfoNo{}, err
+		}
+		return info, enviarHandshake(conn, InfoNo{Assinatura: bc.carteira.AssinarDesafio(info.Desafio)})
+	}
+	proprio.Assinatura = bc.carteira.AssinarDesafio(info.Desafio)
+	if err := enviarHandshake(conn, proprio); err != nil {
+		return InfoNo{}, err
+	}
+	prova, err := lerHandshake(leitor)
+	if err != nil {
+		return InfoNo{}, err
+	}
+	info.Assinatura = prova.Assinatura
+	return info, conferirProva(info, desafio)
+}
+
+func enviarHandshake(conn net.Conn, info InfoNo) error {
+	m, err := mensagemJSON(msgHandshake, info)
+	if err != nil {
+		return err
+	}
+	return escreverMensagem(conn, m)
+}
+
+func lerHandshake(leitor *bufio.Reader) (InfoNo, error) {
+	m, err := lerMensagem(leitor)
+	if err != nil {
+		return InfoNo{}, err
+	}
+	if m.Tipo != msgHandshake {
+		return InfoNo{}, fmt.Errorf("esperado handshake, recebida mensagem %d", m.Tipo)
+	}
+	var info InfoNo
+	if err := json.Unmarshal(m.Dados, &info); err != nil {
+		return InfoNo{}, fmt.Errorf("handshake inválido: %w", err)
+	}
+	return info, nil
+}
+
+// aceitarSessao atende uma sessão aberta por outro nó. O endereço que ele
+// informa só é usado, e incluído como candidato a peer, depois de confirmado
+// discando de volta; as sessões de entrada contam no limite de peers.
+func (bc *Blockchain) aceitarSessao(conn net.Conn, leitor *bufio.Reader) {
+	info, err := bc.handshakeSessao(conn, leitor, false)
+	if err != nil {
+		log.Printf("Sessão de %s recusada: %v", conn.RemoteAddr(), err)
+		conn.Close()
+		return
+	}
+	if !bc.sessoes.aceitaEntrada(info.No, bc.peers.maxPeers) {
+		log.Printf("Sessão de %s recusada: limite de %d peers atingido", conn.RemoteAddr(), bc.peers.maxPeers)
+		conn.Close()
+		return
+	}
+	endereco := ""
+	if info.Endereco != "" {
+		if err := bc.confirmarEndereco(info.Endereco, info.No); err != nil {
+			log.Printf("Endereço %s informado por %s não confirmado: %v", info.Endereco, conn.RemoteAddr(), err)
+		} else if endereco, err = bc.peers.AdicionarAprendido(info.Endereco); err != nil {
+			endereco, _ = normalizarEnderecoPeer(info.Endereco)
+		}
+	}
+	s := novaSessao(conn, leitor, info, endereco, false)
+	if !bc.sessoes.registrar(s, bc.carteira.Endereco, bc.peers.maxPeers) {
+		s.Fechar()
+		return
+	}
+	bc.atenderSessao(s)
+}
+
+// atenderSessao trata as mensagens do peer na ordem em que chegam, uma por
+// vez, até a sessão cair. Se o nó não der conta, o TCP segura o peer em vez
+// de as mensagens se acumularem na memória.
+func (bc *Blockchain) atenderSessao(s *Sessao) {
+	defer bc.sessoes.remover(s)
+	defer s.Fechar()
+	go s.escrever()
+	go s.pingar()
+	log.Printf("Sessão aberta com %s", s)
+	bc.pedirCabecalhosSessao(s)
+	for {
+		// Sem nada em dois pings, nem o pong, o peer é dado como fora do ar
+		s.conn.SetReadDeadline(time.Now().Add(2*intervaloPing + tempoLimitePeer))
+		m, err := lerMensagem(s.leitor)
+		if err != nil {
+			select {
+			case <-s.fim:
+			default:
+				log.Printf("Sessão com %s encerrada: %v", s, err)
+			}
+			return
+		}
+		if err := bc.tratarMensagem(s, m); err != nil {
+			log.Printf("Mensagem %d de %s violou o protocolo: %v", m.Tipo, s, err)
+			return
+		}
+	}
+}
+
+// pedirCabecalhosSessao pede ao peer os cabeçalhos depois da ponta local,
+// para alcançá-lo assim que a sessão abre.
+func (bc *Blockchain) pedirCabecalhosSessao(s *Sessao) {
+	bc.mu.Lock()
+	pedido := PedidoCabecalhos{Localizador: localizador(bc.ponta), Max: maxCabecalhosPorPedido}
+	bc.mu.Unlock()
+	if len(pedido.Localizador) > maxLocalizador {
+		pedido.Localizador = append(pedido.Localizador[:maxLocalizador-1], bc.hashGenesis)
+	}
+	if m, err := mensagemJSON(msgGetHeaders, pedido); err == nil {
+		s.Enviar(m)
+	}
+}
+
+// tratarMensagem devolve erro só para violações do protocolo, que encerram a
+// sessão; blocos e transações inválidos são apenas recusados.
+func (bc *Blockchain) tratarMensagem(s *Sessao, m Mensagem) error {
+	switch m.Tipo {
+	case msgPing:
+		s.Enviar(Mensagem{Tipo: msgPong, Dados: m.Dados})
+	case msgPong:
+		// A leitura já renovou o prazo da sessão
+	case msgBloco:
+		var bloco Bloco
+		if err := json.Unmarshal(m.Dados, &bloco); err != nil {
+			return err
+		}
+		s.conhecidos.Adicionar(bloco.HashAtual)
+		bc.sessoes.liberarPedido(bloco.HashAtual)
+		bc.receberBlocoDaSessao(s, bloco)
+	case msgTransacao:
+		var tx Transacao
+		if err := json.Unmarshal(m.Dados, &tx); err != nil {
+			return err
+		}
+		s.conhecidos.Adicionar(tx.ID)
+		bc.sessoes.liberarPedido(tx.ID)
+		if _, err := bc.receberTransacao(tx); err != nil {
+			log.Printf("Transação de %s recusada: %v", s, err)
+		}
+	case msgInv:
+		itens, err := decodificarInventario(m.Dados)
+		if err != nil {
+			return err
+		}
+		var faltando []ItemInventario
+		agora := time.Now()
+		for _, item := range itens {
+			s.conhecidos.Adicionar(item.Hash)
+			if !bc.conheceItem(item) && bc.sessoes.reservarPedido(item.Hash, agora) {
+				faltando = append(faltando, item)
+			}
+		}
+		bc.pedirItens(s, faltando)
+	case msgGetData:
+		itens, err := decodificarInventario(m.Dados)
+		if err != nil {
+			return err
+		}
+		for _, item := range itens {
+			if resposta, ok := bc.mensagemDoItem(item); ok {
+				s.conhecidos.Adicionar(item.Hash)
+				s.Enviar(resposta)
+			}
+		}
+	case msgGetHeaders:
+		var pedido PedidoCabecalhos
+		if err := json.Unmarshal(m.Dados, &pedido); err != nil {
+			return err
+		}
+		if len(pedido.Localizador) > maxLocalizador {
+			return fmt.Errorf("localizador com %d hashes", len(pedido.Localizador))
+		}
+		if pedido.Max <= 0 || pedido.Max > maxCabecalhosPorPedido {
+			pedido.Max = maxCabecalhosPorPedido
+		}
+		bc.mu.Lock()
+		cabecalhos := bc.cabecalhosApos(pedido.Localizador, pedido.Max)
+		bc.mu.Unlock()
+		if resposta, err := mensagemJSON(msgCabecalhos, cabecalhos); err == nil {
+			s.Enviar(resposta)
+		}
+	case msgCabecalhos:
+		var cabecalhos []Bloco
+		if err := json.Unmarshal(m.Dados, &cabecalhos); err != nil {
+			return err
+		}
+		if len(cabecalhos) > maxCabecalhosPorPedido {
+			return fmt.Errorf("%d cabeçalhos numa mensagem", len(cabecalhos))
+		}
+		bc.receberCabecalhos(s, cabecalhos)
+	default:
+		// Tipos novos de versões futuras do protocolo
+		log.Printf("Mensagem de tipo %d de %s ignorada", m.Tipo, s)
+	}
+	return nil
+}
+
+func (bc *Blockchain) receberBlocoDaSessao(s *Sessao, bloco Bloco) {
+	_, faltando, _, err := bc.receberBlocoTravando(bloco, s.Endereco)
+	if err != nil {
+		log.Printf("Bloco %d de %s recusado: %v", bloco.Indice, s, err)
+	}
+	if faltando != "" {
+		go bc.buscarAncestrais(faltando, s.Endereco)
+	}
+}
+
+// receberCabecalhos pede os corpos dos cabeçalhos que ainda não tem. Um lote
+// cheio indica que o peer tem mais, e o seguinte é pedido a partir do último.
+// Cabeçalhos que não se ligam a nenhum bloco conhecido ficam para a
+// sincronização.
+func (bc *Blockchain) receberCabecalhos(s *Sessao, cabecalhos []Bloco) {
+	if len(cabecalhos) == 0 {
+		return
+	}
+	bc.mu.Lock()
+	pai, existe := bc.arvore.nos[cabecalhos[0].HashAnterior]
+	bc.mu.Unlock()
+	if !existe {
+		go bc.SincronizarComPeers()
+		return
+	}
+	anterior := pai.bloco
+	var faltando []ItemInventario
+	agora := time.Now()
+	for _, cabecalho := range cabecalhos {
+		if err := bc.validarCabecalhoIsolado(cabecalho, anterior); err != nil {
+			log.Printf("Cabeçalho %d de %s recusado: %v", cabecalho.Indice, s, err)
+			return
+		}
+		anterior = cabecalho
+		s.conhecidos.Adicionar(cabecalho.HashAtual)
+		bc.mu.Lock()
+		conhecido := bc.arvore.Contem(cabecalho.HashAtual)
+		bc.mu.Unlock()
+		if !conhecido && bc.sessoes.reservarPedido(cabecalho.HashAtual, agora) {
+			faltando = append(faltando, ItemInventario{Tipo: invBloco, Hash: cabecalho.HashAtual})
+		}
+	}
+	bc.pedirItens(s, faltando)
+	if len(cabecalhos) == maxCabecalhosPorPedido {
+		pedido := PedidoCabecalhos{Localizador: []string{anterior.HashAtual}, Max: maxCabecalhosPorPedido}
+		if m, err := mensagemJSON(msgGetHeaders, pedido); err == nil {
+			s.Enviar(m)
+		}
+	}
+}
+
+// pedirItens manda getdata em lotes que respeitam o limite do inventário.
+func (bc *Blockchain) pedirItens(s *Sessao, itens []ItemInventario) {
+	for inicio := 0; inicio < len(itens); inicio += maxItensInventario {
+		dados, err := codificarInventario(itens[inicio:min(inicio+maxItensInventario, len(itens))])
+		if err != nil {
+			log.Printf("Pedido a %s não codificado: %v", s, err)
+			return
+		}
+		s.Enviar(Mensagem{Tipo: msgGetData, Dados: dados})
+	}
+}
+
+// conheceItem diz se o bloco ou transação já está na árvore, no pool de
+// órfãos, confirmado ou no mempool.
+func (bc *Blockchain) conheceItem(item ItemInventario) bool {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	if item.Tipo == invBloco {
+		return bc.arvore.Contem(item.Hash) || bc.orfaos.Contem(item.Hash)
+	}
+	if _, confirmada := bc.txConfirmadas[item.Hash]; confirmada {
+		return true
+	}
+	_, pendente := bc.mempool.Obter(item.Hash)
+	return pendente
+}
+
+// mensagemDoItem monta a resposta a um getdata, se o item for conhecido.
+func (bc *Blockchain) mensagemDoItem(item ItemInventario) (Mensagem, bool) {
+	var conteudo interface{}
+	tipo := msgBloco
+	if item.Tipo == invBloco {
+		bc.mu.Lock()
+		no, existe := bc.arvore.nos[item.Hash]
+		bc.mu.Unlock()
+		if !existe || no.invalido {
+			return Mensagem{}, false
+		}
+		conteudo = no.bloco
+	} else {
+		tx, existe := bc.mempool.Obter(item.Hash)
+		if !existe {
+			return Mensagem{}, false
+		}
+		conteudo, tipo = tx, msgTransacao
+	}
+	m, err := mensagemJSON(tipo, conteudo)
+	return m, err == nil
+}
+
+// HandleP2P promove a requisição a uma sessão persistente com o nó que
+// chamou.
+func (bc *Blockchain) HandleP2P(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	if r.Method == "OPTIONS" {
+		return
+	}
+	if !strings.EqualFold(r.Header.Get("Upgrade"), protocoloP2P) {
+		w.Header().Set("Upgrade", protocoloP2P)
+		http.Error(w, "Esperado Upgrade: "+protocoloP2P, http.StatusUpgradeRequired)
+		return
+	}
+	promovivel, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "Conexão não pode ser promovida", http.StatusInternalServerError)
+		return
+	}
+	conn, buf, err := promovivel.Hijack()
+	if err != nil {
+		log.Printf("Erro ao promover conexão de %s: %v", r.RemoteAddr, err)
+		return
+	}
+	buf.WriteString("HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: " + protocoloP2P + "\r\n\r\n")
+	if err := buf.Flush(); err != nil {
+		conn.Close()
+		return
+	}
+	go bc.aceitarSessao(conn, buf.Reader)
+}
+
+// InfoSessao descreve uma sessão aberta para /admin/sessoes.
+type InfoSessao struct {
+	No       string `json:"no"`
+	Endereco string `json:"endereco,omitempty"`
+	Saida    bool   `json:"saida"`
+	Desde    string `json:"desde"`
+	Fila     int    `json:"fila"`
+}
+
+// HandleAdminSessoes mostra as sessões abertas e quanto há na fila de envio
+// de cada uma.
+func (bc *Blockchain) HandleAdminSessoes(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, "+cabecalhoTokenAdmin)
+	if r.Method == "OPTIONS" {
+		return
+	}
+	if !bc.autorizarAdmin(w, r) {
+		return
+	}
+	sessoes := []InfoSessao{}
+	for _, s := range bc.sessoes.Listar() {
+		sessoes = append(sessoes, InfoSessao{
+			No:       s.No,
+			Endereco: s.Endereco,
+			Saida:    s.Saida,
+			Desde:    s.Desde.Format(time.RFC3339),
+			Fila:     len(s.fila),
+		})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sessoes)
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// esperar repete a condição até ela valer ou o prazo acabar.
+func esperar(t *testing.T, descricao string, condicao func() bool) {
+	t.Helper()
+	limite := time.Now().Add(5 * time.Second)
+	for !condicao() {
+		if time.Now().After(limite) {
+			t.Fatalf("Tempo esgotado esperando %s", descricao)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func pontaDe(bc *Blockchain) string {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	return bc.ponta.bloco.HashAtual
+}
+
+// Testa a codificação dos quadros e dos inventários
+func TestCodificacaoMensagens(t *testing.T) {
+	var buf bytes.Buffer
+	enviadas := []Mensagem{{Tipo: msgPing, Dados: []byte{1, 2, 3}}, {Tipo: msgPong, Dados: []byte{}}}
+	for _, m := range enviadas {
+		if err := escreverMensagem(&buf, m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, esperada := range enviadas {
+		m, err := lerMensagem(&buf)
+		if err != nil || !reflect.DeepEqual(m, esperada) {
+			t.Errorf("Esperado %+v, obtido %+v (%v)", esperada, m, err)
+		}
+	}
+	grande := make([]byte, 5)
+	binary.BigEndian.PutUint32(grande, maxTamanhoMensagem+1)
+	if _, err := lerMensagem(bytes.NewReader(grande)); err == nil {
+		t.Error("Quadro acima do limite deveria ser recusado")
+	}
+
+	itens := []ItemInventario{{Tipo: invBloco, Hash: strings.Repeat("ab", 32)}, {Tipo: invTransacao, Hash: strings.Repeat("0f", 32)}}
+	dados, err := codificarInventario(itens)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lidos, err := decodificarInventario(dados); err != nil || !reflect.DeepEqual(lidos, itens) {
+		t.Errorf("Inventário deveria voltar igual, obtido %+v (%v)", lidos, err)
+	}
+	if _, err := decodificarInventario(dados[1:]); err == nil {
+		t.Error("Inventário truncado deveria ser recusado")
+	}
+	if _, err := codificarInventario([]ItemInventario{{Tipo: invBloco, Hash: "curto"}}); err == nil {
+		t.Error("Hash inválido não deveria ser codificado")
+	}
+}
+
+// Testa que a sessão alcança o peer pelos cabeçalhos, propaga blocos novos e reconecta depois de cair
+func TestSessaoPersistente(t *testing.T) {
+	a, b := NovoBlockchain(nil), NovoBlockchain(nil)
+	enderecoA := servirPeer(t, a)
+	servirPeer(t, b)
+	t.Cleanup(a.sessoes.Encerrar)
+	t.Cleanup(b.sessoes.Encerrar)
+	minerarBlocos(a, 3, "A")
+	conectar(t, b, enderecoA)
+
+	b.ConectarSessoes()
+	esperar(t, "b alcançar a pela sessão", func() bool { return pontaDe(b) == pontaDe(a) })
+	if sessoes := a.sessoes.Listar(); len(sessoes) != 1 || sessoes[0].Saida || sessoes[0].No != b.carteira.Endereco {
+		t.Fatalf("a deveria ter uma sessão de entrada com b, obtido %+v", sessoes)
+	}
+	if !a.peers.Conhece(b.peers.proprio) {
+		t.Error("A sessão de entrada deveria apresentar b como candidato a peer")
+	}
+
+	bloco := a.AdicionarRegistro("A")
+	a.NotificarPeers(bloco)
+	esperar(t, "o bloco novo chegar pela sessão", func() bool { return pontaDe(b) == bloco.HashAtual })
+
+	// Cai a sessão do lado de a; b volta a discar depois da espera
+	anterior := b.sessoes.Listar()[0]
+	a.sessoes.Listar()[0].Fechar()
+	esperar(t, "b reconectar", func() bool {
+		sessoes := b.sessoes.Listar()
+		return len(sessoes) == 1 && sessoes[0] != anterior && len(a.sessoes.Listar()) == 1
+	})
+}
+
+// Testa que a sessão exige a prova da chave do nó, só usa o endereço informado depois de discá-lo de volta e respeita o limite de peers nas sessões de entrada
+func TestSessaoAutenticada(t *testing.T) {
+	a, b, c := NovoBlockchain(nil), NovoBlockchain(nil), NovoBlockchain(nil)
+	enderecoA := servirPeer(t, a)
+	enderecoB := servirPeer(t, b)
+	enderecoC := servirPeer(t, c)
+	for _, bc := range []*Blockchain{a, b, c} {
+		t.Cleanup(bc.sessoes.Encerrar)
+	}
+
+	// Um impostor se apresenta como b, com a chave e o endereço dele, mas não assina o desafio
+	conn, leitor, err := discarP2P(enderecoA, &net.Dialer{Timeout: tempoLimitePeer})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	impostor := b.infoNo()
+	impostor.Desafio = "00"
+	if err := enviarHandshake(conn, impostor); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := lerHandshake(leitor); err != nil {
+		t.Fatal(err)
+	}
+	if err := enviarHandshake(conn, InfoNo{Assinatura: "00"}); err != nil {
+		t.Fatal(err)
+	}
+	conn.SetReadDeadline(time.Now().Add(tempoLimitePeer))
+	if _, err := lerMensagem(leitor); err == nil {
+		t.Error("Sessão sem prova da chave deveria ser encerrada")
+	}
+	if len(a.sessoes.Listar()) != 0 || a.peers.Conhece(enderecoB) {
+		t.Fatalf("Impostor não deveria abrir sessão nem virar peer, obtido %+v", a.sessoes.Listar())
+	}
+
+	// b diz ser alcançado no endereço de c: a sessão vale, mas o endereço não
+	a.peers.maxPeers = 1
+	b.peers.proprio = enderecoC
+	go b.conectarSessao(enderecoA)
+	esperar(t, "a aceitar a sessão de b", func() bool { return len(a.sessoes.Listar()) == 1 })
+	if s := a.sessoes.Listar()[0]; s.No != b.carteira.Endereco || s.Endereco != "" || a.peers.Conhece(enderecoC) {
+		t.Errorf("Endereço de outro nó não deveria ser aceito, obtido %+v", s)
+	}
+
+	// Com o limite de um peer, a segunda sessão de entrada é recusada
+	c.conectarSessao(enderecoA)
+	if sessoes := a.sessoes.Listar(); len(sessoes) != 1 || sessoes[0].No != b.carteira.Endereco {
+		t.Errorf("Sessão de entrada acima do limite deveria ser recusada, obtido %+v", sessoes)
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+)
+
+// Valores usados quando o gênesis não define os parâmetros.
+var (
+	periodoContestacaoPadrao = 3600
+	caucaoContestacaoPadrao  = Reais(10)
+	caucaoResolucaoPadrao    = Reais(10)
+	janelaApelacaoPadrao     = 86400
+	quorumApelacaoPadrao     = 3
+	maioriaApelacaoPadrao    = 66
+	opcoesMinimasPadrao      = 2
+	apostaMinimaPadrao       = Quantia(1)
+	janelaGovernancaPadrao   = 100
+	quorumGovernancaPadrao   = 3
+	maioriaGovernancaPadrao  = 66
+)
+
+// Parametros são as regras da rede aplicadas pelo estado. Começam com os
+// valores do gênesis e mudam por propostas de governança aprovadas (ver
+// governanca.go); o nome JSON de cada campo é o nome usado nas propostas.
+// Tempos em segundos, a não ser quando indicado.
+type Parametros struct {
+	// quanto tempo depois da conclusão o resultado pode ser contestado; os
+	// prêmios só são creditados depois disso
+	PeriodoContestacao int `json:"periodo_contestacao"`
+	// quanto o contestante deposita; perde o valor se a apelação mantiver o
+	// resultado
+	CaucaoContestacao Quantia `json:"caucao_contestacao"`
+	// quanto quem conclui um evento deposita; o valor vai para o
+	// contestante se a apelação reverter o resultado
+	CaucaoResolucao Quantia `json:"caucao_resolucao"`
+	// duração da votação de apelação, aberta aos apostadores do evento
+	JanelaApelacao  int `json:"janela_apelacao"`
+	QuorumApelacao  int `json:"quorum_apelacao"`
+	MaioriaApelacao int `json:"maioria_apelacao"`
+	OpcoesMinimas   int `json:"opcoes_minimas"`
+	// limites de cada aposta; ApostaMaxima zero não limita
+	ApostaMinima Quantia `json:"aposta_minima"`
+	ApostaMaxima Quantia `json:"aposta_maxima"`
+	// tempo alvo entre blocos usado no ajuste de dificuldade
+	TempoAlvoBloco int `json:"tempo_alvo_bloco"`
+	// duração da votação de uma proposta, em blocos, e quantos votantes e
+	// que porcentagem do saldo deles votando sim ela precisa para ser
+	// aprovada
+	JanelaGovernanca  int `json:"janela_governanca"`
+	QuorumGovernanca  int `json:"quorum_governanca"`
+	MaioriaGovernanca int `json:"maioria_governanca"`
+}
+
+func parametrosPadrao() Parametros {
+	return Parametros{
+		PeriodoContestacao: periodoContestacaoPadrao,
+		CaucaoContestacao:  caucaoContestacaoPadrao,
+		CaucaoResolucao:    caucaoResolucaoPadrao,
+		JanelaApelacao:     janelaApelacaoPadrao,
+		QuorumApelacao:     quorumApelacaoPadrao,
+		MaioriaApelacao:    maioriaApelacaoPadrao,
+		OpcoesMinimas:      opcoesMinimasPadrao,
+		ApostaMinima:       apostaMinimaPadrao,
+		TempoAlvoBloco:     tempoAlvoBlocoPadrao,
+		JanelaGovernanca:   janelaGovernancaPadrao,
+		QuorumGovernanca:   quorumGovernancaPadrao,
+		MaioriaGovernanca:  maioriaGovernancaPadrao,
+	}
+}
+
+// parametros devolve os parâmetros da especificação, com os valores padrão
+// no lugar dos que não foram definidos.
+func (e EspecificacaoGenesis) parametros() Parametros {
+	parametros := parametrosPadrao()
+	parametros.TempoAlvoBloco = e.tempoAlvoBloco()
+	if e.PeriodoContestacao > 0 {
+		parametros.PeriodoContestacao = e.PeriodoContestacao
+	}
+	if e.CaucaoContestacao > 0 {
+		parametros.CaucaoContestacao = e.CaucaoContestacao
+	}
+	if e.CaucaoResolucao > 0 {
+		parametros.CaucaoResolucao = e.CaucaoResolucao
+	}
+	if e.JanelaApelacao > 0 {
+		parametros.JanelaApelacao = e.JanelaApelacao
+	}
+	if e.QuorumApelacao > 0 {
+		parametros.QuorumApelacao = e.QuorumApelacao
+	}
+	if e.MaioriaApelacao > 0 {
+		parametros.MaioriaApelacao = e.MaioriaApelacao
+	}
+	return parametros
+}
+
+func (p Parametros) Validar() error {
+	if p.PeriodoContestacao < 1 || p.JanelaApelacao < 1 {
+		return fmt.Errorf("período de contestação e janela de apelação devem ser positivos")
+	}
+	if p.CaucaoContestacao < 0 || p.CaucaoResolucao < 0 {
+		return fmt.Errorf("cauções de contestação e de resolução não podem ser negativas")
+	}
+	if p.QuorumApelacao < 1 {
+		return fmt.Errorf("quórum da apelação deve ser de pelo menos um votante")
+	}
+	if p.MaioriaApelacao <= 50 || p.MaioriaApelacao > 100 {
+		return fmt.Errorf("maioria da apelação de %d%% deve estar entre 51 e 100", p.MaioriaApelacao)
+	}
+	if p.OpcoesMinimas < 2 {
+		return fmt.Errorf("eventos precisam de pelo menos duas opções")
+	}
+	if p.ApostaMinima < 1 || p.ApostaMaxima < 0 || (p.ApostaMaxima > 0 && p.ApostaMaxima < p.ApostaMinima) {
+		return fmt.Errorf("limites de aposta inválidos: mínima %s, máxima %s", p.ApostaMinima, p.ApostaMaxima)
+	}
+	if p.TempoAlvoBloco < 1 {
+		return fmt.Errorf("tempo alvo dos blocos deve ser positivo")
+	}
+	if p.JanelaGovernanca < 1 || p.QuorumGovernanca < 1 {
+		return fmt.Errorf("janela e quórum da governança devem ser positivos")
+	}
+	if p.MaioriaGovernanca <= 50 || p.MaioriaGovernanca > 100 {
+		return fmt.Errorf("maioria da governança de %d%% deve estar entre 51 e 100", p.MaioriaGovernanca)
+	}
+	return nil
+}
@@ -0,0 +1,740 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	// versaoProtocolo muda quando nós antigos deixam de entender os novos
+	versaoProtocolo = 1
+	maxPeersPadrao  = 8
+	maxFalhasPeer   = 3
+	intervaloPeers  = 15 * time.Second
+	tempoLimitePeer = 5 * time.Second
+	// discagens de volta em andamento para confirmar endereços informados
+	maxConfirmacoes     = 4
+	cabecalhoTokenAdmin = "X-Token-Admin"
+	// enviado com blocos e transações repassados por HTTP
+	cabecalhoOrigem = "X-Endereco-No"
+)
+
+// InfoNo é o que dois nós trocam no handshake. No é o endereço da carteira
+// do nó, que o identifica mesmo atrás de URLs diferentes; Endereco é a URL
+// pela qual os outros nós o alcançam, vazia se ele não a conhece. Como os dois
+// são só declarados, o nó prova que tem a chave de No assinando o Desafio do
+// outro lado (ver conferirProva), e o Endereco é confirmado discando de volta.
+type InfoNo struct {
+	ChainID    string `json:"chain_id"`
+	Genesis    string `json:"genesis"`
+	Versao     int    `json:"versao"`
+	No         string `json:"no"`
+	Endereco   string `json:"endereco,omitempty"`
+	Altura     int    `json:"altura"`
+	Chave      string `json:"chave,omitempty"`
+	Desafio    string `json:"desafio,omitempty"`
+	Assinatura string `json:"assinatura,omitempty"`
+}
+
+// Peer é um nó conhecido. Só os ativos, que passaram pelo último handshake,
+// recebem blocos e transações; os demais são candidatos ou estão fora do ar.
+type Peer struct {
+	Endereco      string `json:"endereco"`
+	Semente       bool   `json:"semente,omitempty"`
+	Ativo         bool   `json:"ativo"`
+	Altura        int    `json:"altura"`
+	UltimoContato string `json:"ultimo_contato,omitempty"`
+	Falhas        int    `json:"falhas"`
+	// aprendido de outro nó, e não semente nem incluído pelo administrador:
+	// só é discado conferindo que não está na rede local
+	Aprendido bool `json:"aprendido,omitempty"`
+}
+
+// GerenciadorPeers guarda os peers conhecidos. Sementes nunca são
+// esquecidas, só marcadas como inativas; os demais são removidos depois de
+// maxFalhasPeer handshakes seguidos sem resposta.
+type GerenciadorPeers struct {
+	mu       sync.Mutex
+	peers    map[string]*Peer
+	proprio  string
+	maxPeers int
+	cliente  *http.Client
+	// usados com endereços aprendidos de outros nós (ver controlarDiscagem)
+	clienteRestrito  *http.Client
+	discadorRestrito *net.Dialer
+	// aceita endereços da rede local (loopback, privados, link-local)
+	// aprendidos de outros nós; sementes e peers do administrador sempre valem
+	permitirPrivados bool
+	// o que cada peer sem sessão já recebeu ou mandou por HTTP
+	conhecidos map[string]*inventarioConhecido
+	// endereços sendo confirmados por incluirConfirmado
+	confirmando map[string]bool
+}
+
+func NovoGerenciadorPeers(sementes []string) *GerenciadorPeers {
+	g := &GerenciadorPeers{
+		peers:       make(map[string]*Peer),
+		maxPeers:    maxPeersPadrao,
+		conhecidos:  make(map[string]*inventarioConhecido),
+		confirmando: make(map[string]bool),
+	}
+	// Nós não redirecionam: seguir um redirecionamento discaria um endereço
+	// que ninguém conferiu
+	semRedirecionar := func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+	g.cliente = &http.Client{Timeout: tempoLimitePeer, CheckRedirect: semRedirecionar}
+	g.discadorRestrito = &net.Dialer{Timeout: tempoLimitePeer, Control: g.controlarDiscagem}
+	g.clienteRestrito = &http.Client{
+		Timeout:       tempoLimitePeer,
+		CheckRedirect: semRedirecionar,
+		Transport:     &http.Transport{DialContext: g.discadorRestrito.DialContext},
+	}
+	for _, semente := range sementes {
+		endereco, err := normalizarEnderecoPeer(semente)
+		if err != nil {
+			log.Printf("Semente %q ignorada: %v", semente, err)
+			continue
+		}
+		g.peers[endereco] = &Peer{Endereco: endereco, Semente: true}
+	}
+	return g
+}
+
+// normalizarEnderecoPeer aceita só URLs http(s) com host e tira a barra
+// final, para que o mesmo nó não apareça duas vezes.
+func normalizarEnderecoPeer(endereco string) (string, error) {
+	u, err := url.Parse(strings.TrimSpace(endereco))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", fmt.Errorf("endereço de peer %q inválido", endereco)
+	}
+	return strings.TrimRight(u.Scheme+"://"+u.Host+u.Path, "/"), nil
+}
+
+// controlarDiscagem recusa conexões a IPs da rede local, para que um peer
+// não faça este nó discar serviços internos, a não ser que o nó permita. Roda
+// com o IP que vai de fato ser discado, depois da resolução de nomes, então
+// um DNS que muda a resposta entre uma conferência e a conexão não escapa.
+func (g *GerenciadorPeers) controlarDiscagem(rede, endereco string, _ syscall.RawConn) error {
+	if g.permitirPrivados {
+		return nil
+	}
+	host, _, err := net.SplitHostPort(endereco)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsUnspecified() || ip.IsMulticast() {
+		return fmt.Errorf("%s é da rede local", host)
+	}
+	return nil
+}
+
+// restrito diz se o endereço deve ser discado com controlarDiscagem: um peer
+// aprendido de outro nó ou um endereço que ainda nem é peer.
+func (g *GerenciadorPeers) restrito(endereco string) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	peer, existe := g.peers[endereco]
+	return !existe || peer.Aprendido
+}
+
+// clientePara devolve o cliente HTTP com que o endereço deve ser discado.
+func (g *GerenciadorPeers) clientePara(endereco string) *http.Client {
+	if g.restrito(endereco) {
+		return g.clienteRestrito
+	}
+	return g.cliente
+}
+
+// discadorPara devolve o discador das sessões com o endereço.
+func (g *GerenciadorPeers) discadorPara(endereco string) *net.Dialer {
+	if g.restrito(endereco) {
+		return g.discadorRestrito
+	}
+	return &net.Dialer{Timeout: tempoLimitePeer}
+}
+
+// Ativos devolve os endereços dos peers que responderam ao último handshake.
+func (g *GerenciadorPeers) Ativos() []string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	var ativos []string
+	for endereco, peer := range g.peers {
+		if peer.Ativo {
+			ativos = append(ativos, endereco)
+		}
+	}
+	sort.Strings(ativos)
+	return ativos
+}
+
+// Ativo diz se o endereço é de um peer que respondeu ao último handshake.
+func (g *GerenciadorPeers) Ativo(endereco string) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	peer, existe := g.peers[endereco]
+	return existe && peer.Ativo
+}
+
+// Listar devolve uma cópia de todos os peers conhecidos.
+func (g *GerenciadorPeers) Listar() []Peer {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	peers := make([]Peer, 0, len(g.peers))
+	for _, peer := range g.peers {
+		peers = append(peers, *peer)
+	}
+	sort.Slice(peers, func(i, j int) bool { return peers[i].Endereco < peers[j].Endereco })
+	return peers
+}
+
+func (g *GerenciadorPeers) Conhece(endereco string) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	_, existe := g.peers[endereco]
+	return existe
+}
+
+func (g *GerenciadorPeers) enderecos() []string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	enderecos := make([]string, 0, len(g.peers))
+	for endereco := range g.peers {
+		enderecos = append(enderecos, endereco)
+	}
+	sort.Strings(enderecos)
+	return enderecos
+}
+
+// Adicionar inclui um candidato, que só fica ativo depois do handshake.
+// Devolve erro se o endereço for inválido, for o próprio nó ou o limite de
+// peers tiver sido atingido.
+func (g *GerenciadorPeers) Adicionar(endereco string) (string, error) {
+	endereco, err := normalizarEnderecoPeer(endereco)
+	if err != nil {
+		return "", err
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if endereco == g.proprio {
+		return "", fmt.Errorf("%s é o próprio nó", endereco)
+	}
+	if _, existe := g.peers[endereco]; existe {
+		return endereco, nil
+	}
+	if len(g.peers) >= g.maxPeers {
+		return "", fmt.Errorf("limite de %d peers atingido", g.maxPeers)
+	}
+	g.peers[endereco] = &Peer{Endereco: endereco}
+	return endereco, nil
+}
+
+// reservarConfirmacao marca o endereço como sendo confirmado, se ele ainda não
+// estiver e houver vaga.
+func (g *GerenciadorPeers) reservarConfirmacao(endereco string) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.confirmando[endereco] || len(g.confirmando) >= maxConfirmacoes {
+		return false
+	}
+	g.confirmando[endereco] = true
+	return true
+}
+
+// liberarConfirmacao desfaz reservarConfirmacao.
+func (g *GerenciadorPeers) liberarConfirmacao(endereco string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	delete(g.confirmando, endereco)
+}
+
+// AdicionarAprendido inclui um endereço aprendido de outro nó, que continua
+// sendo discado com as restrições de controlarDiscagem.
+func (g *GerenciadorPeers) AdicionarAprendido(endereco string) (string, error) {
+	endereco, err := g.Adicionar(endereco)
+	if err != nil {
+		return "", err
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if peer := g.peers[endereco]; !peer.Semente {
+		peer.Aprendido = true
+	}
+	return endereco, nil
+}
+
+// Remover esquece o peer, mesmo que seja semente.
+func (g *GerenciadorPeers) Remover(endereco string) bool {
+	if normalizado, err := normalizarEnderecoPeer(endereco); err == nil {
+		endereco = normalizado
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	_, existe := g.peers[endereco]
+	delete(g.peers, endereco)
+	delete(g.conhecidos, endereco)
+	return existe
+}
+
+// marcarConhecido registra que o peer tem o item e devolve false se isso já
+// era sabido. Endereços que não são peers não são lembrados.
+func (g *GerenciadorPeers) marcarConhecido(endereco, hash string) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if _, existe := g.peers[endereco]; !existe {
+		return true
+	}
+	conhecidos, existe := g.conhecidos[endereco]
+	if !existe {
+		conhecidos = novoInventarioConhecido()
+		g.conhecidos[endereco] = conhecidos
+	}
+	return conhecidos.Adicionar(hash)
+}
+
+func (g *GerenciadorPeers) registrarContato(endereco string, info InfoNo) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if peer, existe := g.peers[endereco]; existe {
+		peer.Ativo = true
+		peer.Falhas = 0
+		peer.Altura = info.Altura
+		peer.UltimoContato = time.Now().UTC().Format(time.RFC3339)
+	}
+}
+
+// registrarFalha desativa o peer e, passado o limite de falhas, esquece os
+// que não são sementes. Peers incompatíveis são esquecidos de uma vez.
+func (g *GerenciadorPeers) registrarFalha(endereco string, incompativel bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	peer, existe := g.peers[endereco]
+	if !existe {
+		return
+	}
+	peer.Ativo = false
+	peer.Falhas++
+	if !peer.Semente && (incompativel || peer.Falhas >= maxFalhasPeer) {
+		delete(g.peers, endereco)
+		delete(g.conhecidos, endereco)
+	}
+}
+
+// origemDoPeer devolve o endereço que o peer informou ao repassar um bloco ou
+// transação. O cabeçalho é só declarado, então vale apenas para um peer ativo
+// ou com sessão aberta, e só se a requisição vier do host desse endereço;
+// do contrário qualquer um faria o nó deixar de repassar itens a um peer.
+func (bc *Blockchain) origemDoPeer(r *http.Request) string {
+	origem, err := normalizarEnderecoPeer(r.Header.Get(cabecalhoOrigem))
+	if err != nil {
+		return ""
+	}
+	if !bc.peers.Ativo(origem) && !bc.sessoes.conectadoA(origem) {
+		return ""
+	}
+	if !vemDoHost(r, origem) {
+		return ""
+	}
+	return origem
+}
+
+// vemDoHost diz se a requisição partiu de um dos IPs do host do endereço.
+func vemDoHost(r *http.Request, endereco string) bool {
+	remoto, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return false
+	}
+	ipRemoto := net.ParseIP(remoto)
+	u, err := url.Parse(endereco)
+	if ipRemoto == nil || err != nil {
+		return false
+	}
+	ctx, cancelar := context.WithTimeout(context.Background(), tempoLimitePeer)
+	defer cancelar()
+	ips, err := net.DefaultResolver.LookupIPAddr(ctx, u.Hostname())
+	if err != nil {
+		return false
+	}
+	for _, ip := range ips {
+		if ip.IP.Equal(ipRemoto) {
+			return true
+		}
+	}
+	return false
+}
+
+// errPeerIncompativel indica um peer de outra rede ou versão.
+type errPeerIncompativel struct{ motivo string }
+
+func (e errPeerIncompativel) Error() string { return e.motivo }
+
+// infoNo descreve este nó para o handshake. Deve ser chamado sem bc.mu.
+func (bc *Blockchain) infoNo() InfoNo {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	return InfoNo{
+		ChainID:  bc.genesis.ChainID,
+		Genesis:  bc.hashGenesis,
+		Versao:   versaoProtocolo,
+		No:       bc.carteira.Endereco,
+		Endereco: bc.peers.proprio,
+		Altura:   len(bc.Blocos) - 1,
+		Chave:    hex.EncodeToString(bc.carteira.Publica),
+	}
+}
+
+// novoDesafio sorteia o desafio que o peer deve assinar.
+func novoDesafio() (string, error) {
+	desafio := make([]byte, 32)
+	if _, err := rand.Read(desafio); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(desafio), nil
+}
+
+// conferirProva confere que o peer tem a chave do nó que diz ser: a chave
+// corresponde a info.No e assina o desafio.
+func conferirProva(info InfoNo, desafio string) error {
+	publica, err := hex.DecodeString(info.Chave)
+	if err != nil || len(publica) != ed25519.PublicKeySize || EnderecoDe(publica) != info.No {
+		return fmt.Errorf("chave do nó %s inválida", info.No)
+	}
+	assinatura, err := hex.DecodeString(info.Assinatura)
+	if err != nil || !ed25519.Verify(publica, mensagemDesafio(desafio), assinatura) {
+		return fmt.Errorf("nó %s não provou ter a chave", info.No)
+	}
+	return nil
+}
+
+// sondar disca um endereço aprendido de outro nó e confere que ele responde ao
+// handshake como um nó compatível, com a chave que diz ter. Endereços da rede
+// local são recusados ao discar (ver controlarDiscagem).
+func (bc *Blockchain) sondar(endereco string) (InfoNo, error) {
+	desafio, err := novoDesafio()
+	if err != nil {
+		return InfoNo{}, err
+	}
+	resp, err := bc.peers.clientePara(endereco).Get(endereco + "/handshake?desafio=" + desafio)
+	if err != nil {
+		return InfoNo{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return InfoNo{}, fmt.Errorf("handshake recusado com status %d", resp.StatusCode)
+	}
+	var info InfoNo
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		return InfoNo{}, fmt.Errorf("resposta de handshake inválida: %w", err)
+	}
+	if err := bc.conferirInfo(info); err != nil {
+		return InfoNo{}, err
+	}
+	return info, conferirProva(info, desafio)
+}
+
+// confirmarEndereco confere que quem responde no endereço informado por um
+// peer é o nó no, com a chave dele. Impede que um nó se apresente com a URL de
+// outro.
+func (bc *Blockchain) confirmarEndereco(endereco, no string) error {
+	info, err := bc.sondar(endereco)
+	if err != nil {
+		return err
+	}
+	if info.No != no {
+		return fmt.Errorf("%s pertence ao nó %s, não a %s", endereco, info.No, no)
+	}
+	return nil
+}
+
+// incluirConfirmado inclui como candidato o endereço informado pelo nó no
+// depois de confirmá-lo.
+func (bc *Blockchain) incluirConfirmado(endereco, no string) {
+	normalizado, err := normalizarEnderecoPeer(endereco)
+	if err != nil || bc.peers.Conhece(normalizado) || normalizado == bc.peers.proprio {
+		return
+	}
+	if err := bc.confirmarEndereco(normalizado, no); err != nil {
+		log.Printf("Peer %s não incluído: %v", normalizado, err)
+		return
+	}
+	if _, err := bc.peers.AdicionarAprendido(normalizado); err != nil {
+		log.Printf("Peer %s não incluído: %v", normalizado, err)
+	}
+}
+
+// conferirInfo recusa nós de outra rede, de outro gênesis, de versão
+// diferente do protocolo ou o próprio nó.
+func (bc *Blockchain) conferirInfo(info InfoNo) error {
+	proprio := bc.infoNo()
+	switch {
+	case info.ChainID != proprio.ChainID:
+		return errPeerIncompativel{fmt.Sprintf("rede %q, esperada %q", info.ChainID, proprio.ChainID)}
+	case info.Genesis != proprio.Genesis:
+		return errPeerIncompativel{fmt.Sprintf("gênesis %s, esperado %s", info.Genesis, proprio.Genesis)}
+	case info.Versao != versaoProtocolo:
+		return errPeerIncompativel{fmt.Sprintf("protocolo v%d, esperado v%d", info.Versao, versaoProtocolo)}
+	case info.No == proprio.No:
+		return errPeerIncompativel{"conexão com o próprio nó"}
+	}
+	return nil
+}
+
+// Handshake apresenta este nó ao peer e confere a resposta. O resultado
+// atualiza a situação do peer no gerenciador.
+func (bc *Blockchain) Handshake(endereco string) error {
+	err := bc.handshake(endereco)
+	if err != nil {
+		_, incompativel := err.(errPeerIncompativel)
+		bc.peers.registrarFalha(endereco, incompativel)
+	}
+	return err
+}
+
+func (bc *Blockchain) handshake(endereco string) error {
+	corpo, err := json.Marshal(bc.infoNo())
+	if err != nil {
+		return err
+	}
+	resp, err := bc.peers.clientePara(endereco).Post(endereco+"/handshake", "application/json", bytes.NewReader(corpo))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return errPeerIncompativel{fmt.Sprintf("handshake recusado com status %d", resp.StatusCode)}
+	}
+	var info InfoNo
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		return fmt.Errorf("resposta de handshake inválida: %w", err)
+	}
+	if err := bc.conferirInfo(info); err != nil {
+		return err
+	}
+	bc.peers.registrarContato(endereco, info)
+	return nil
+}
+
+// ManterPeers refaz o handshake com todos os peers conhecidos, o que também
+// serve de verificação de vida, e pede aos ativos os peers que eles
+// conhecem.
+func (bc *Blockchain) ManterPeers() {
+	var wg sync.WaitGroup
+	for _, endereco := range bc.peers.enderecos() {
+		wg.Add(1)
+		go func(endereco string) {
+			defer wg.Done()
+			if err := bc.Handshake(endereco); err != nil {
+				log.Printf("Handshake com %s falhou: %v", endereco, err)
+			}
+		}(endereco)
+	}
+	wg.Wait()
+	for _, endereco := range bc.peers.Ativos() {
+		bc.descobrirPeers(endereco)
+	}
+}
+
+// descobrirPeers inclui como candidatos os peers ativos de um peer que
+// responderem ao handshake quando discados.
+func (bc *Blockchain) descobrirPeers(endereco string) {
+	resp, err := bc.peers.clientePara(endereco).Get(endereco + "/peers")
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	var conhecidos []string
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxTamanhoMensagem)).Decode(&conhecidos); err != nil {
+		return
+	}
+	// Endereços inválidos, o próprio nó e o que passar do limite são ignorados
+	for _, conhecido := range conhecidos {
+		normalizado, err := normalizarEnderecoPeer(conhecido)
+		if err != nil || bc.peers.Conhece(normalizado) || normalizado == bc.peers.proprio {
+			continue
+		}
+		if _, err := bc.sondar(normalizado); err != nil {
+			log.Printf("Peer %s anunciado por %s não incluído: %v", normalizado, endereco, err)
+			continue
+		}
+		bc.peers.AdicionarAprendido(normalizado)
+	}
+}
+
+// HandleHandshake responde com a descrição deste nó. Se quem chamou informar
+// um endereço e for compatível, ele vira candidato a peer depois de
+// confirmado discando de volta (ver incluirConfirmado). Um GET com desafio
+// responde a qualquer um com o desafio assinado, que é como outro nó confirma
+// o endereço e a chave deste; a assinatura só vale como desafio (ver
+// mensagemDesafio).
+func (bc *Blockchain) HandleHandshake(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	if r.Method == "OPTIONS" {
+		return
+	}
+	if r.Method == http.MethodGet {
+		desafio := r.URL.Query().Get("desafio")
+		if desafio == "" {
+			http.Error(w, "Desafio obrigatório", http.StatusBadRequest)
+			return
+		}
+		info := bc.infoNo()
+		info.Assinatura = bc.carteira.AssinarDesafio(desafio)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(info)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Método não permitido", http.StatusMethodNotAllowed)
+		return
+	}
+	var info InfoNo
+	if err := json.NewDecoder(r.Body).Decode(&info); err != nil {
+		http.Error(w, "Dados inválidos", http.StatusBadRequest)
+		return
+	}
+	if err := bc.conferirInfo(info); err != nil {
+		http.Error(w, fmt.Sprintf("Nó incompatível: %v", err), http.StatusBadRequest)
+		return
+	}
+	// Confirmar o endereço pode demorar o prazo de um peer inteiro, então
+	// roda em segundo plano; o mesmo endereço é discado uma vez só e, com
+	// maxConfirmacoes em andamento, os pedidos são ignorados
+	if normalizado, err := normalizarEnderecoPeer(info.Endereco); err == nil && bc.peers.reservarConfirmacao(normalizado) {
+		go func() {
+			defer bc.peers.liberarConfirmacao(normalizado)
+			bc.incluirConfirmado(normalizado, info.No)
+		}()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(bc.infoNo())
+}
+
+// HandlePeers devolve os endereços dos peers ativos, para que outros nós os
+// descubram.
+func (bc *Blockchain) HandlePeers(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	if r.Method == "OPTIONS" {
+		return
+	}
+	ativos := bc.peers.Ativos()
+	if ativos == nil {
+		ativos = []string{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ativos)
+}
+
+// autorizarAdmin confere o token de administração. Sem token configurado os
+// endpoints de administração ficam fechados. A comparação leva o mesmo tempo
+// qualquer que seja o token enviado, para não revelá-lo aos poucos.
+func (bc *Blockchain) autorizarAdmin(w http.ResponseWriter, r *http.Request) bool {
+	if bc.tokenAdmin == "" {
+		http.Error(w, "Administração desativada: ADMIN_TOKEN não definido", http.StatusForbidden)
+		return false
+	}
+	if subtle.ConstantTimeCompare([]byte(r.Header.Get(cabecalhoTokenAdmin)), []byte(bc.tokenAdmin)) != 1 {
+		http.Error(w, "Token de administração inválido", http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
+
+// HandleAdminPeers mostra a situação de todos os peers conhecidos.
+func (bc *Blockchain) HandleAdminPeers(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, "+cabecalhoTokenAdmin)
+	if r.Method == "OPTIONS" {
+		return
+	}
+	if !bc.autorizarAdmin(w, r) {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(bc.peers.Listar())
+}
+
+// HandleAdicionarPeer inclui um peer e faz o handshake na hora.
+func (bc *Blockchain) HandleAdicionarPeer(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, "+cabecalhoTokenAdmin)
+	if r.Method == "OPTIONS" {
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Método não permitido", http.StatusMethodNotAllowed)
+		return
+	}
+	if !bc.autorizarAdmin(w, r) {
+		return
+	}
+	var req struct {
+		Endereco string `json:"endereco"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Dados inválidos", http.StatusBadRequest)
+		return
+	}
+	endereco, err := bc.peers.Adicionar(req.Endereco)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Peer não adicionado: %v", err), http.StatusBadRequest)
+		return
+	}
+	if err := bc.Handshake(endereco); err != nil {
+		http.Error(w, fmt.Sprintf("Handshake com %s falhou: %v", endereco, err), http.StatusBadGateway)
+		return
+	}
+	log.Printf("Peer %s adicionado pelo administrador", endereco)
+	fmt.Fprintf(w, "Peer %s conectado", endereco)
+}
+
+// HandleRemoverPeer esquece um peer. Se ele continuar sendo anunciado por
+// outros nós, pode voltar pela descoberta.
+func (bc *Blockchain) HandleRemoverPeer(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, "+cabecalhoTokenAdmin)
+	if r.Method == "OPTIONS" {
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Método não permitido", http.StatusMethodNotAllowed)
+		return
+	}
+	if !bc.autorizarAdmin(w, r) {
+		return
+	}
+	var req struct {
+		Endereco string `json:"endereco"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Dados inválidos", http.StatusBadRequest)
+		return
+	}
+	if !bc.peers.Remover(req.Endereco) {
+		http.Error(w, "Peer desconhecido", http.StatusNotFound)
+		return
+	}
+	log.Printf("Peer %s removido pelo administrador", req.Endereco)
+	fmt.Fprintf(w, "Peer %s removido", req.Endereco)
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// servirPeer expõe os endpoints de peers, de sincronização e de sessão do
+// nó num servidor de teste e anuncia o endereço dele no handshake. Os
+// servidores de teste ouvem em loopback, que o nó passa a aceitar de peers.
+func servirPeer(t *testing.T, bc *Blockchain) string {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/handshake", bc.HandleHandshake)
+	mux.HandleFunc("/peers", bc.HandlePeers)
+	mux.HandleFunc("/ponta", bc.HandlePonta)
+	mux.HandleFunc("/cabecalhos", bc.HandleCabecalhos)
+	mux.HandleFunc("/blocos", bc.HandleBlocosPorHash)
+	mux.HandleFunc("/p2p", bc.HandleP2P)
+	mux.HandleFunc("/receber-bloco", bc.ReceberBloco)
+	mux.HandleFunc("/receber-transacao", bc.ReceberTransacao)
+	servidor := httptest.NewServer(mux)
+	t.Cleanup(servidor.Close)
+	bc.peers.proprio = servidor.URL
+	bc.peers.permitirPrivados = true
+	return servidor.URL
+}
+
+// Testa o handshake entre dois nós e a descoberta de um terceiro pelos peers de um peer
+func TestHandshakeEDescobertaDePeers(t *testing.T) {
+	a, b, c := NovoBlockchain(nil), NovoBlockchain(nil), NovoBlockchain(nil)
+	enderecoA := servirPeer(t, a)
+	enderecoB := servirPeer(t, b)
+	servirPeer(t, c)
+
+	// b conhece a; c só conhece b
+	if _, err := b.peers.Adicionar(enderecoA + "/"); err != nil {
+		t.Fatal(err)
+	}
+	b.ManterPeers()
+	if ativos := b.peers.Ativos(); len(ativos) != 1 || ativos[0] != enderecoA {
+		t.Fatalf("b deveria estar conectado a a, obtido %v", ativos)
+	}
+	if _, err := c.peers.Adicionar(enderecoB); err != nil {
+		t.Fatal(err)
+	}
+	c.ManterPeers()
+	c.ManterPeers()
+	if ativos := c.peers.Ativos(); len(ativos) != 2 {
+		t.Errorf("c deveria descobrir a por meio de b, obtido %v", ativos)
+	}
+	// Os handshakes apresentaram b e c a a, que os inclui como candidatos
+	// depois de discá-los de volta
+	esperar(t, "a conhecer b e c", func() bool { return len(a.peers.Listar()) == 2 })
+	if !a.peers.Conhece(enderecoB) {
+		t.Errorf("a deveria conhecer b depois do handshake, obtido %+v", a.peers.Listar())
+	}
+}
+
+// Testa que nós de outra rede, o próprio nó e peers fora do ar são recusados ou esquecidos
+func TestPeersIncompativeisEFalhas(t *testing.T) {
+	a := NovoBlockchain(nil)
+	outraRede := GenesisPadrao
+	outraRede.ChainID = "outra-rede"
+	estranho, err := CarregarBlockchain(nil, NovoArmazenamentoMemoria(), outraRede)
+	if err != nil {
+		t.Fatal(err)
+	}
+	enderecoEstranho := servirPeer(t, estranho)
+	proprio := servirPeer(t, a)
+	fora := httptest.NewServer(http.NotFoundHandler())
+	fora.Close()
+
+	if _, err := a.peers.Adicionar(proprio); err == nil {
+		t.Error("O próprio endereço não deveria virar peer")
+	}
+	a.peers.Adicionar(enderecoEstranho)
+	if err := a.Handshake(enderecoEstranho); err == nil {
+		t.Error("Handshake com outra rede deveria falhar")
+	}
+	if len(a.peers.Listar()) != 0 {
+		t.Errorf("Peer incompatível deveria ser esquecido, obtido %+v", a.peers.Listar())
+	}
+
+	a.peers = NovoGerenciadorPeers([]string{fora.URL})
+	a.peers.Adicionar(fora.URL + "/outro")
+	for i := 0; i < maxFalhasPeer; i++ {
+		a.ManterPeers()
+	}
+	if peers := a.peers.Listar(); len(peers) != 1 || !peers[0].Semente || peers[0].Ativo {
+		t.Errorf("Só a semente deveria continuar conhecida, inativa, obtido %+v", peers)
+	}
+}
+
+// Testa o limite de peers e a normalização dos endereços
+func TestLimiteDePeers(t *testing.T) {
+	g := NovoGerenciadorPeers([]string{"http://semente:8080/", "não é url"})
+	g.maxPeers = 2
+	if _, err := g.Adicionar("http://semente:8080"); err != nil {
+		t.Errorf("Endereço repetido não deveria falhar, obtido %v", err)
+	}
+	if _, err := g.Adicionar("http://outro:8080"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := g.Adicionar("http://terceiro:8080"); err == nil {
+		t.Error("Peer além do limite deveria ser recusado")
+	}
+	if _, err := g.Adicionar("ftp://x"); err == nil {
+		t.Error("Endereço que não é http deveria ser recusado")
+	}
+	if !g.Remover("http://semente:8080/") || len(g.Listar()) != 1 {
+		t.Errorf("Remover deveria esquecer a semente, obtido %+v", g.Listar())
+	}
+}
+
+// Testa que os endpoints de administração ficam fechados sem token configurado e exigem o token certo
+func TestAutorizacaoAdmin(t *testing.T) {
+	bc := NovoBlockchain(nil)
+	pedir := func(token string) int {
+		r := httptest.NewRequest(http.MethodGet, "/admin/peers", nil)
+		if token != "" {
+			r.Header.Set(cabecalhoTokenAdmin, token)
+		}
+		w := httptest.NewRecorder()
+		bc.HandleAdminPeers(w, r)
+		return w.Code
+	}
+	if codigo := pedir(""); codigo != http.StatusForbidden {
+		t.Errorf("Sem ADMIN_TOKEN a administração deveria ser recusada, obtido %d", codigo)
+	}
+	bc.tokenAdmin = "segredo"
+	for token, esperado := range map[string]int{"": http.StatusUnauthorized, "segred": http.StatusUnauthorized, "segredo": http.StatusOK} {
+		if codigo := pedir(token); codigo != esperado {
+			t.Errorf("Token %q: esperado %d, obtido %d", token, esperado, codigo)
+		}
+	}
+}
+
+// Testa que endereços recebidos de outros nós só viram peers depois de responderem ao handshake e que a rede local é recusada sem permissão
+func TestEnderecosAnunciadosConfirmados(t *testing.T) {
+	a, b := NovoBlockchain(nil), NovoBlockchain(nil)
+	enderecoA := servirPeer(t, a)
+	enderecoB := servirPeer(t, b)
+	fora := httptest.NewServer(http.NotFoundHandler())
+	fora.Close()
+
+	// Um peer anuncia a e um endereço fora do ar; só a é incluído
+	anunciante := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode([]string{enderecoA, fora.URL})
+	}))
+	defer anunciante.Close()
+	c := NovoBlockchain(nil)
+	c.peers.permitirPrivados = true
+	c.descobrirPeers(anunciante.URL)
+	if peers := c.peers.Listar(); len(peers) != 1 || peers[0].Endereco != enderecoA {
+		t.Errorf("Só o endereço que respondeu ao handshake deveria ser incluído, obtido %+v", peers)
+	}
+
+	// Um handshake que se apresenta com o endereço de a não o torna peer
+	falso := b.infoNo()
+	falso.Endereco = enderecoA
+	b.incluirConfirmado(enderecoA, falso.No)
+	if b.peers.Conhece(enderecoA) {
+		t.Error("Endereço de outro nó não deveria ser aceito")
+	}
+
+	// Sem permissão, endereços de loopback anunciados não são discados
+	a.peers.permitirPrivados = false
+	a.incluirConfirmado(enderecoB, b.carteira.Endereco)
+	// (o anunciante é incluído pelo administrador, então ele mesmo é discado)
+	c.peers = NovoGerenciadorPeers([]string{anunciante.URL})
+	c.descobrirPeers(anunciante.URL)
+	if a.peers.Conhece(enderecoB) || len(c.peers.Listar()) != 1 {
+		t.Errorf("Endereços de loopback deveriam ser recusados, obtido %+v e %+v", a.peers.Listar(), c.peers.Listar())
+	}
+	if _, err := c.sondar(enderecoA); err == nil {
+		t.Error("A sondagem de um endereço de loopback deveria falhar ao discar")
+	}
+
+	// Mesmo com a rede local permitida, um redirecionamento não é seguido
+	redireciona := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, enderecoA+r.URL.RequestURI(), http.StatusFound)
+	}))
+	defer redireciona.Close()
+	c.peers.permitirPrivados = true
+	if _, err := c.sondar(redireciona.URL); err == nil {
+		t.Error("A sondagem não deveria seguir redirecionamentos")
+	}
+}
+
+// Testa que handshakes com endereço disparam no máximo maxConfirmacoes discagens de volta, uma por endereço
+func TestConfirmacoesDeEnderecoLimitadas(t *testing.T) {
+	liberar := make(chan struct{})
+	var discagens atomic.Int32
+	lento := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		discagens.Add(1)
+		<-liberar
+	}))
+	defer lento.Close()
+	defer close(liberar)
+
+	a, b := NovoBlockchain(nil), NovoBlockchain(nil)
+	a.peers.permitirPrivados = true
+	handshake := func(endereco string) {
+		info := b.infoNo()
+		info.Endereco = endereco
+		corpo, _ := json.Marshal(info)
+		w := httptest.NewRecorder()
+		a.HandleHandshake(w, httptest.NewRequest(http.MethodPost, "/handshake", bytes.NewReader(corpo)))
+		if w.Code != http.StatusOK {
+			t.Fatalf("Handshake recusado: %d %s", w.Code, w.Body)
+		}
+	}
+
+	// Cada endereço é pedido duas vezes, mas discado uma só
+	for i := 0; i < 2*maxConfirmacoes; i++ {
+		handshake(lento.URL + "/no" + strconv.Itoa(i/2))
+	}
+	esperar(t, "as discagens de volta", func() bool { return discagens.Load() == maxConfirmacoes })
+
+	// Com todas as vagas ocupadas, os pedidos seguintes são ignorados
+	for i := 0; i < maxConfirmacoes; i++ {
+		handshake(lento.URL + "/extra" + strconv.Itoa(i))
+	}
+	time.Sleep(100 * time.Millisecond)
+	if n := discagens.Load(); n != maxConfirmacoes {
+		t.Errorf("Esperadas %d discagens de volta, obtidas %d", maxConfirmacoes, n)
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/hex"
+)
+
+// Tipos de conjunto de resolvedores de um evento.
+const (
+	ResolucaoChave    = "chave"
+	ResolucaoMultisig = "multisig"
+	ResolucaoOraculo  = "oraculo"
+	ResolucaoVotacao  = "votacao"
+)
+
+// decisaoCancelar é a aprovação de um resolvedor para cancelar o evento em vez
+// de concluí-lo. Opções nunca são vazias, então não há colisão.
+const decisaoCancelar = ""
+
+// Resolvedores define quem pode concluir ou cancelar um evento:
+//
+//   - chave: uma única conta, em Chaves[0];
+//   - multisig: pelo menos Minimo das contas em Chaves. Cada resolvedor envia
+//     a própria transação de conclusão (ou cancelamento), assinada por ele, e
+//     o evento só é liquidado quando Minimo delas concordam;
+//   - oraculo: a conta registrada com o nome Oraculo no gênesis;
+//   - votacao: a comunidade, com transações votar enviadas durante as
+//     JanelaVotacao segundos seguintes ao prazo das apostas (ver votacao.go).
+//     Ninguém conclui nem cancela o evento manualmente.
+//
+// Um evento criado sem resolvedores é resolvido pelo próprio criador.
+type Resolvedores struct {
+	Tipo    string   `json:"tipo"`
+	Chaves  []string `json:"chaves,omitempty"`
+	Minimo  int      `json:"minimo,omitempty"`
+	Oraculo string   `json:"oraculo,omitempty"`
+	// PesoConta ou PesoAposta
+	Peso          string `json:"peso,omitempty"`
+	JanelaVotacao int    `json:"janela_votacao,omitempty"`
+	// votantes mínimos e porcentagem do peso que a vencedora precisa ter
+	Quorum  int `json:"quorum,omitempty"`
+	Maioria int `json:"maioria,omitempty"`
+}
+
+func enderecoValido(endereco string) bool {
+	bytes, err := hex.DecodeString(endereco)
+	return err == nil && len(bytes) == 20 && hex.EncodeToString(bytes) == endereco
+}
+
+// validarResolvedores confere o conjunto de resolvedores de um evento novo.
+func (e *EstadoMundo) validarResolvedores(resolvedores *Resolvedores) *ErroValidacao {
+	switch resolvedores.Tipo {
+	case ResolucaoChave:
+		if len(resolvedores.Chaves) != 1 || !enderecoValido(resolvedores.Chaves[0]) {
+			return rejeitar(MotivoEventoInvalido, "resolvedor do tipo chave precisa de exatamente um endereço válido")
+		}
+	case ResolucaoMultisig:
+		vistas := make(map[string]bool)
+		for _, chave := range resolvedores.Chaves {
+			if !enderecoValido(chave) || vistas[chave] {
+				return rejeitar(MotivoEventoInvalido, "resolvedor %q inválido ou repetido", chave)
+			}
+			vistas[chave] = true
+		}
+		if resolvedores.Minimo < 1 || resolvedores.Minimo > len(resolvedores.Chaves) {
+			return rejeitar(MotivoEventoInvalido, "mínimo de %d assinaturas para %d resolvedores", resolvedores.Minimo, len(resolvedores.Chaves))
+		}
+	case ResolucaoOraculo:
+		if _, existe := e.oraculos[resolvedores.Oraculo]; !existe {
+			return rejeitar(MotivoEventoInvalido, "oráculo %q não está registrado no gênesis", resolvedores.Oraculo)
+		}
+	case ResolucaoVotacao:
+		return validarVotacao(resolvedores)
+	default:
+		return rejeitar(MotivoEventoInvalido, "tipo de resolvedores %q desconhecido", resolvedores.Tipo)
+	}
+	return nil
+}
+
+// PodeResolver diz se a conta pode concluir ou cancelar o evento sozinha ou
+// aprovando como parte de um multisig. Eventos gravados antes dos resolvedores
+// existirem podem ser resolvidos por qualquer conta.
+func (e *EstadoMundo) PodeResolver(evento *Evento, conta string) bool {
+	resolvedores := evento.Resolvedores
+	if resolvedores == nil {
+		return true
+	}
+	switch resolvedores.Tipo {
+	case ResolucaoChave, ResolucaoMultisig:
+		for _, chave := range resolvedores.Chaves {
+			if chave == conta {
+				return true
+			}
+		}
+	case ResolucaoOraculo:
+		return conta != "" && e.oraculos[resolvedores.Oraculo] == conta
+	}
+	return false
+}
+
+// decidir registra a decisão (uma opção vencedora ou decisaoCancelar) de quem
+// assinou a transação e diz se ela já vale. Num multisig a decisão só vale
+// quando o mínimo de resolvedores tiver aprovado a mesma coisa; um resolvedor
+// pode trocar a própria aprovação enquanto isso não acontece.
+func (e *EstadoMundo) decidir(evento *Evento, conta, decisao string, alteracoes *alteracoesBloco) (bool, *ErroValidacao) {
+	if !e.PodeResolver(evento, conta) {
+		return false, rejeitar(MotivoNaoAutorizado, "conta %s não resolve o evento %d", conta, evento.ID)
+	}
+	if evento.Resolvedores == nil || evento.Resolvedores.Tipo != ResolucaoMultisig {
+		return true, nil
+	}
+	// O mapa é substituído, não alterado, para que Desfazer e as cópias
+	// devolvidas por Evento continuem vendo o mapa anterior.
+	aprovacoes := make(map[string]string, len(evento.Aprovacoes)+1)
+	for resolvedor, anterior := range evento.Aprovacoes {
+		aprovacoes[resolvedor] = anterior
+	}
+	aprovacoes[conta] = decisao
+	e.registrarEvento(evento, alteracoes)
+	evento.Aprovacoes = aprovacoes
+
+	concordam := 0
+	for _, aprovada := range aprovacoes {
+		if aprovada == decisao {
+			concordam++
+		}
+	}
+	return concordam >= evento.Resolvedores.Minimo, nil
+}
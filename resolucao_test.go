@@ -0,0 +1,109 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// Testa que num multisig 2 de 3 o evento só é liquidado quando dois resolvedores concordam
+func TestResolucaoMultisig(t *testing.T) {
+	criador, _ := NovaCarteira()
+	r1, _ := NovaCarteira()
+	r2, _ := NovaCarteira()
+	r3, _ := NovaCarteira()
+	estado := estadoComSaldos(t, map[*Carteira]Quantia{criador: Reais(10), r3: Reais(10)})
+	inicio := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	resolvedores := &Resolvedores{Tipo: ResolucaoMultisig, Chaves: []string{r1.Endereco, r2.Endereco, r3.Endereco}, Minimo: 2}
+	if err := estado.Aplicar(blocoEm(inicio,
+		transacaoAssinada(t, criador, 0, "criar_evento", Evento{Nome: "Final", Opcoes: []string{"X", "Y"}, Resolvedores: resolvedores}),
+		transacaoAssinada(t, criador, 1, "apostar", Aposta{Usuario: criador.Endereco, Valor: Reais(10), EventoID: 1, Opcao: "X"}),
+	)); err != nil {
+		t.Fatal(err)
+	}
+
+	concluir := func(carteira *Carteira, nonce uint64, opcao string) Transacao {
+		return transacaoAssinada(t, carteira, nonce, "concluir_evento", map[string]interface{}{"evento_id": 1, "opcao_vencedora": opcao})
+	}
+	if err := estado.Aplicar(blocoEm(inicio, concluir(criador, 2, "X"))); motivoDe(err) != MotivoNaoAutorizado {
+		t.Errorf("Criador fora do multisig não deveria concluir, obtido %v", err)
+	}
+	// Aprovações divergentes não chegam ao mínimo
+	if err := estado.Aplicar(blocoEm(inicio, concluir(r1, 0, "X"), concluir(r2, 0, "Y"))); err != nil {
+		t.Fatal(err)
+	}
+	if evento, _ := estado.Evento(1); evento.Situacao != SituacaoAberto || len(evento.Aprovacoes) != 2 {
+		t.Fatalf("Evento não deveria ser liquidado com aprovações divergentes, obtido %+v", evento)
+	}
+	// Quem completa o mínimo deposita a caução de resolução
+	saque := transacaoAssinada(t, r3, 0, "ajustar_saldo", map[string]interface{}{"usuario": r3.Endereco, "valor": "-10"})
+	if err := estado.Aplicar(blocoEm(inicio, saque, concluir(r3, 1, "X"))); motivoDe(err) != MotivoSaldoInsuficiente {
+		t.Errorf("Aprovação decisiva sem saldo para a caução deveria ser recusada, obtido %v", err)
+	}
+	if err := estado.Aplicar(blocoEm(inicio, concluir(r3, 0, "X"))); err != nil {
+		t.Fatal(err)
+	}
+	evento, _ := estado.Evento(1)
+	if evento.Situacao != SituacaoResolvido || evento.Resultado != "X" || evento.Premios[criador.Endereco] != Reais(10) {
+		t.Errorf("Duas aprovações em X deveriam liquidar o evento, obtido %+v", evento)
+	}
+	if evento.Resolvedor != r3.Endereco || estado.Saldos[r3.Endereco] != 0 {
+		t.Errorf("Caução de resolução deveria ser debitada de r3, obtido %+v", evento)
+	}
+
+	// Desfazer a aprovação decisiva volta às aprovações anteriores
+	estado.Desfazer()
+	if evento, _ := estado.Evento(1); evento.Situacao != SituacaoAberto || len(evento.Aprovacoes) != 2 || evento.Aprovacoes[r3.Endereco] != "" {
+		t.Errorf("Desfazer deveria restaurar as aprovações, obtido %+v", evento)
+	}
+}
+
+// Testa que um evento com oráculo só é resolvido pela conta registrada no gênesis
+func TestResolucaoPorOraculo(t *testing.T) {
+	oraculo, _ := NovaCarteira()
+	outro, _ := NovaCarteira()
+	especificacao := GenesisPadrao
+	especificacao.Oraculos = map[string]string{"placar": oraculo.Endereco}
+	especificacao.Saldos = map[string]Quantia{oraculo.Endereco: Reais(10)}
+	estado := NovoEstadoMundo()
+	if err := estado.Aplicar(especificacao.Bloco()); err != nil {
+		t.Fatal(err)
+	}
+	inicio := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	desconhecido := transacaoAssinada(t, outro, 0, "criar_evento", Evento{Nome: "Final", Opcoes: []string{"X", "Y"}, Resolvedores: &Resolvedores{Tipo: ResolucaoOraculo, Oraculo: "clima"}})
+	if err := estado.Aplicar(blocoEm(inicio, desconhecido)); motivoDe(err) != MotivoEventoInvalido {
+		t.Errorf("Oráculo não registrado deveria ser recusado, obtido %v", err)
+	}
+	criacao := transacaoAssinada(t, outro, 0, "criar_evento", Evento{Nome: "Final", Opcoes: []string{"X", "Y"}, Resolvedores: &Resolvedores{Tipo: ResolucaoOraculo, Oraculo: "placar"}})
+	if err := estado.Aplicar(blocoEm(inicio, criacao)); err != nil {
+		t.Fatal(err)
+	}
+	if err := estado.Aplicar(blocoEm(inicio, transacaoAssinada(t, outro, 1, "cancelar_evento", map[string]interface{}{"evento_id": 1}))); motivoDe(err) != MotivoNaoAutorizado {
+		t.Errorf("Criador não deveria cancelar evento resolvido por oráculo, obtido %v", err)
+	}
+	if err := estado.Aplicar(blocoEm(inicio, transacaoAssinada(t, oraculo, 0, "concluir_evento", map[string]interface{}{"evento_id": 1, "opcao_vencedora": "Y"}))); err != nil {
+		t.Fatal(err)
+	}
+	if evento, _ := estado.Evento(1); evento.Resultado != "Y" || evento.Criador != outro.Endereco {
+		t.Errorf("Oráculo deveria concluir o evento, obtido %+v", evento)
+	}
+}
+
+// Testa que conjuntos de resolvedores malformados são recusados na criação
+func TestResolvedoresInvalidos(t *testing.T) {
+	criador, _ := NovaCarteira()
+	casos := map[string]*Resolvedores{
+		"tipo desconhecido":  {Tipo: "comite"},
+		"chave sem endereço": {Tipo: ResolucaoChave},
+		"endereço inválido":  {Tipo: ResolucaoChave, Chaves: []string{"alice"}},
+		"mínimo acima":       {Tipo: ResolucaoMultisig, Chaves: []string{criador.Endereco}, Minimo: 2},
+		"chave repetida":     {Tipo: ResolucaoMultisig, Chaves: []string{criador.Endereco, criador.Endereco}, Minimo: 1},
+	}
+	for nome, resolvedores := range casos {
+		estado := NovoEstadoMundo()
+		tx := transacaoAssinada(t, criador, 0, "criar_evento", Evento{Nome: "Final", Opcoes: []string{"X", "Y"}, Resolvedores: resolvedores})
+		if err := estado.Aplicar(blocoEm(time.Now(), tx)); motivoDe(err) != MotivoEventoInvalido {
+			t.Errorf("%s: esperado %q, obtido %v", nome, MotivoEventoInvalido, err)
+		}
+	}
+}
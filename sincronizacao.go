@@ -0,0 +1,604 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A sincronização pede primeiro os cabeçalhos: o nó consulta a ponta dos
+// peers, pede ao de mais trabalho os cabeçalhos a partir de um localizador
+// (para achar onde as cadeias divergem), confere a prova de trabalho deles e
+// só então baixa os corpos que faltam, em lotes distribuídos entre os peers.
+
+const intervaloSincronizacao = 10 * time.Second
+
+// Limites da sincronização. São variáveis para que os testes usem lotes
+// pequenos.
+var (
+	maxCabecalhosPorPedido = 500
+	maxCabecalhosPorRodada = 2000
+	maxLocalizador         = 64
+	maxBlocosPorPedido     = 100
+	tamanhoLoteBlocos      = 50
+	downloadsParalelos     = 4
+)
+
+// PontaCadeia resume a cadeia principal de um nó. O trabalho acumulado vai
+// em decimal porque não cabe num número JSON.
+type PontaCadeia struct {
+	Altura   int    `json:"altura"`
+	Hash     string `json:"hash"`
+	Trabalho string `json:"trabalho"`
+}
+
+type PedidoCabecalhos struct {
+	Localizador []string `json:"localizador"`
+	Max         int      `json:"max,omitempty"`
+}
+
+type PedidoBlocos struct {
+	Hashes []string `json:"hashes"`
+}
+
+// ProgressoSincronizacao é o que /sincronizacao mostra da rodada atual, ou
+// da última se nenhuma estiver em andamento.
+type ProgressoSincronizacao struct {
+	Sincronizando  bool   `json:"sincronizando"`
+	Peer           string `json:"peer,omitempty"`
+	AlturaLocal    int    `json:"altura_local"`
+	AlturaAlvo     int    `json:"altura_alvo"`
+	Cabecalhos     int    `json:"cabecalhos"`
+	BlocosBaixados int    `json:"blocos_baixados"`
+	BlocosFaltando int    `json:"blocos_faltando"`
+	Inicio         string `json:"inicio,omitempty"`
+	UltimaRodada   string `json:"ultima_rodada,omitempty"`
+	Erro           string `json:"erro,omitempty"`
+}
+
+// sincronizacao guarda o progresso e o ponto de retomada entre rodadas.
+type sincronizacao struct {
+	// rodada impede que duas rodadas baixem os mesmos blocos ao mesmo tempo
+	rodada    sync.Mutex
+	mu        sync.Mutex
+	progresso ProgressoSincronizacao
+	// retomarDe é o último bloco guardado de um ramo que ainda não virou a
+	// cadeia principal; a rodada seguinte pede cabeçalhos a partir dele em
+	// vez de recomeçar do ponto de divergência.
+	retomarDe string
+}
+
+func (s *sincronizacao) atualizar(alterar func(*ProgressoSincronizacao)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	alterar(&s.progresso)
+}
+
+func (s *sincronizacao) Progresso() ProgressoSincronizacao {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.progresso
+}
+
+// pontaPeer é a ponta anunciada por um peer, com o trabalho já convertido.
+type pontaPeer struct {
+	endereco string
+	ponta    PontaCadeia
+	trabalho *big.Int
+}
+
+// pontaCadeia deve ser chamado com bc.mu travado.
+func (bc *Blockchain) pontaCadeia() PontaCadeia {
+	return PontaCadeia{
+		Altura:   bc.ponta.bloco.Indice,
+		Hash:     bc.ponta.bloco.HashAtual,
+		Trabalho: bc.ponta.trabalho.String(),
+	}
+}
+
+// naCadeiaPrincipal deve ser chamado com bc.mu travado.
+func (bc *Blockchain) naCadeiaPrincipal(hash string) (int, bool) {
+	no, existe := bc.arvore.nos[hash]
+	if !existe || no.bloco.Indice >= len(bc.Blocos) || bc.Blocos[no.bloco.Indice].HashAtual != hash {
+		return 0, false
+	}
+	return no.bloco.Indice, true
+}
+
+// cabecalhosApos devolve até max cabeçalhos da cadeia principal depois do
+// primeiro hash do localizador que estiver nela, ou depois do gênesis se
+// nenhum estiver. Deve ser chamado com bc.mu travado.
+func (bc *Blockchain) cabecalhosApos(localizador []string, max int) []Bloco {
+	inicio := 0
+	for _, hash := range localizador {
+		if indice, ok := bc.naCadeiaPrincipal(hash); ok {
+			inicio = indice
+			break
+		}
+	}
+	fim := min(inicio+1+max, len(bc.Blocos))
+	cabecalhos := make([]Bloco, 0, fim-inicio-1)
+	for _, bloco := range bc.Blocos[inicio+1 : fim] {
+		bloco.Transacoes = nil
+		cabecalhos = append(cabecalhos, bloco)
+	}
+	return cabecalhos
+}
+
+// localizador lista hashes do ramo de no, do mais novo para o mais antigo:
+// os dez últimos um a um e depois com passos que dobram, terminando sempre
+// no gênesis. Assim o peer acha o ponto de divergência com poucos hashes.
+func localizador(no *noBloco) []string {
+	var hashes []string
+	passo := 1
+	for {
+		hashes = append(hashes, no.bloco.HashAtual)
+		if no.pai == nil {
+			return hashes
+		}
+		if len(hashes) >= 10 {
+			passo *= 2
+		}
+		for i := 0; i < passo && no.pai != nil; i++ {
+			no = no.pai
+		}
+	}
+}
+
+// dificuldadePlausivel confere a dificuldade de um cabeçalho sem o estado do
+// ramo: fora das alturas de ajuste ela repete a do pai, e nelas muda no
+// máximo um zero dentro dos limites da rede. O valor exato é conferido quando
+// o corpo chega.
+func (bc *Blockchain) dificuldadePlausivel(cabecalho, pai Bloco) bool {
+	switch {
+	case cabecalho.Indice <= 1:
+		return cabecalho.Dificuldade == bc.genesis.Dificuldade
+	case !bc.genesis.alturaDeAjuste(cabecalho.Indice):
+		return cabecalho.Dificuldade == pai.Dificuldade
+	}
+	variacao := cabecalho.Dificuldade - pai.Dificuldade
+	return variacao >= -1 && variacao <= 1 && bc.genesis.limitarDificuldade(cabecalho.Dificuldade) == cabecalho.Dificuldade
+}
+
+// validarCabecalhoIsolado confere o que dá para conferir só com o cabeçalho:
+// encadeamento, versão, timestamp, dificuldade plausível e prova de
+// trabalho. Transações e regras da aplicação ficam para guardarBloco.
+func (bc *Blockchain) validarCabecalhoIsolado(cabecalho, pai Bloco) error {
+	if cabecalho.Indice != pai.Indice+1 || cabecalho.HashAnterior != pai.HashAtual {
+		return rejeitar(MotivoEncadeamento, "cabeçalho não aponta para o pai %s", pai.HashAtual)
+	}
+	if err := bc.validarVersao(cabecalho, pai); err != nil {
+		return err
+	}
+	if !bc.dificuldadePlausivel(cabecalho, pai) {
+		return rejeitar(MotivoDificuldade, "dificuldade %d implausível depois de %d", cabecalho.Dificuldade, pai.Dificuldade)
+	}
+	if !timestampValido(cabecalho, pai) {
+		return rejeitar(MotivoTimestamp, "timestamp %s inválido", cabecalho.Timestamp)
+	}
+	if cabecalho.HashAtual != calculaHash(cabecalho) || !strings.HasPrefix(cabecalho.HashAtual, strings.Repeat("0", cabecalho.Dificuldade)) {
+		return rejeitar(MotivoHashInvalido, "hash ou prova de trabalho inválidos")
+	}
+	return nil
+}
+
+// SincronizarComPeers faz uma rodada de sincronização com o peer ativo de
+// maior trabalho acumulado. Se a rodada anterior ainda estiver baixando
+// blocos, esta não faz nada.
+func (bc *Blockchain) SincronizarComPeers() {
+	if !bc.sincronia.rodada.TryLock() {
+		return
+	}
+	defer bc.sincronia.rodada.Unlock()
+	err := bc.sincronizar()
+	if err != nil {
+		log.Printf("Sincronização interrompida: %v", err)
+	}
+	bc.sincronia.atualizar(func(p *ProgressoSincronizacao) {
+		p.Sincronizando = false
+		p.UltimaRodada = time.Now().Format(time.RFC3339)
+		p.Erro = ""
+		if err != nil {
+			p.Erro = err.Error()
+		}
+	})
+}
+
+func (bc *Blockchain) sincronizar() error {
+	pontas := bc.consultarPontas()
+	bc.mu.Lock()
+	nossoTrabalho := bc.ponta.trabalho
+	bc.mu.Unlock()
+	if len(pontas) == 0 || pontas[0].trabalho.Cmp(nossoTrabalho) <= 0 {
+		return nil
+	}
+	melhor := pontas[0]
+	bc.sincronia.atualizar(func(p *ProgressoSincronizacao) {
+		*p = ProgressoSincronizacao{
+			Sincronizando: true,
+			Peer:          melhor.endereco,
+			AlturaAlvo:    melhor.ponta.Altura,
+			Inicio:        time.Now().Format(time.RFC3339),
+		}
+	})
+
+	cabecalhos, completos, err := bc.baixarCabecalhos(melhor.endereco)
+	if err != nil {
+		return fmt.Errorf("cabeçalhos de %s: %w", melhor.endereco, err)
+	}
+	// Corpos guardados numa rodada anterior não são baixados de novo
+	bc.mu.Lock()
+	var faltando []Bloco
+	for _, cabecalho := range cabecalhos {
+		if !bc.arvore.Contem(cabecalho.HashAtual) {
+			faltando = append(faltando, cabecalho)
+		}
+	}
+	bc.mu.Unlock()
+	bc.sincronia.atualizar(func(p *ProgressoSincronizacao) {
+		p.Cabecalhos = len(cabecalhos)
+		p.BlocosFaltando = len(faltando)
+	})
+	if len(faltando) > 0 {
+		// Só servem de fonte os peers cuja cadeia chega até o último cabeçalho
+		var fontes []string
+		for _, ponta := range pontas {
+			if ponta.ponta.Altura >= faltando[len(faltando)-1].Indice {
+				fontes = append(fontes, ponta.endereco)
+			}
+		}
+		if err := bc.baixarCorpos(faltando, fontes); err != nil {
+			return err
+		}
+	}
+	if completos {
+		bc.sincronia.mu.Lock()
+		bc.sincronia.retomarDe = ""
+		bc.sincronia.mu.Unlock()
+	}
+	return nil
+}
+
+// consultarPontas pergunta a ponta de todos os peers ativos ao mesmo tempo e
+// devolve as respostas do maior para o menor trabalho.
+func (bc *Blockchain) consultarPontas() []pontaPeer {
+	var (
+		mu     sync.Mutex
+		wg     sync.WaitGroup
+		pontas []pontaPeer
+	)
+	for _, endereco := range bc.peers.Ativos() {
+		wg.Add(1)
+		go func(endereco string) {
+			defer wg.Done()
+			ponta, err := bc.pedirPonta(endereco)
+			if err != nil {
+				log.Printf("Ponta de %s indisponível: %v", endereco, err)
+				return
+			}
+			mu.Lock()
+			pontas = append(pontas, ponta)
+			mu.Unlock()
+		}(endereco)
+	}
+	wg.Wait()
+	sort.Slice(pontas, func(i, j int) bool {
+		if c := pontas[i].trabalho.Cmp(pontas[j].trabalho); c != 0 {
+			return c > 0
+		}
+		return pontas[i].endereco < pontas[j].endereco
+	})
+	return pontas
+}
+
+func (bc *Blockchain) pedirPonta(endereco string) (pontaPeer, error) {
+	resp, err := bc.peers.clientePara(endereco).Get(endereco + "/ponta")
+	if err != nil {
+		return pontaPeer{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return pontaPeer{}, fmt.Errorf("status %d", resp.StatusCode)
+	}
+	var ponta PontaCadeia
+	if err := json.NewDecoder(resp.Body).Decode(&ponta); err != nil {
+		return pontaPeer{}, err
+	}
+	trabalho, ok := new(big.Int).SetString(ponta.Trabalho, 10)
+	if !ok {
+		return pontaPeer{}, fmt.Errorf("trabalho %q inválido", ponta.Trabalho)
+	}
+	return pontaPeer{endereco: endereco, ponta: ponta, trabalho: trabalho}, nil
+}
+
+// baixarCabecalhos pede cabeçalhos ao peer até ele não ter mais ou até o
+// limite da rodada, e os valida em sequência a partir de um bloco conhecido.
+// completos diz se o peer não tinha mais cabeçalhos a mandar.
+func (bc *Blockchain) baixarCabecalhos(endereco string) (cabecalhos []Bloco, completos bool, err error) {
+	bc.sincronia.mu.Lock()
+	retomarDe := bc.sincronia.retomarDe
+	bc.sincronia.mu.Unlock()
+	bc.mu.Lock()
+	inicio := bc.ponta
+	// Um ramo baixado em parte continua de onde parou, desde que ainda não
+	// faça parte da cadeia principal
+	if no, existe := bc.arvore.nos[retomarDe]; existe && !no.invalido && ancestralComum(no, bc.ponta) != no {
+		inicio = no
+	}
+	pedido := localizador(inicio)
+	bc.mu.Unlock()
+
+	for len(cabecalhos) < maxCabecalhosPorRodada {
+		lote, err := bc.pedirCabecalhos(endereco, pedido, min(maxCabecalhosPorPedido, maxCabecalhosPorRodada-len(cabecalhos)))
+		if err != nil {
+			return nil, false, err
+		}
+		cabecalhos = append(cabecalhos, lote...)
+		if len(lote) < maxCabecalhosPorPedido {
+			completos = true
+			break
+		}
+		pedido = []string{lote[len(lote)-1].HashAtual}
+	}
+	if len(cabecalhos) == 0 {
+		return nil, true, nil
+	}
+
+	bc.mu.Lock()
+	pai, existe := bc.arvore.nos[cabecalhos[0].HashAnterior]
+	bc.mu.Unlock()
+	if !existe || pai.invalido {
+		return nil, false, fmt.Errorf("primeiro cabeçalho aponta para bloco desconhecido %s", cabecalhos[0].HashAnterior)
+	}
+	trabalho := new(big.Int).Set(pai.trabalho)
+	anterior := pai.bloco
+	for _, cabecalho := range cabecalhos {
+		if err := bc.validarCabecalhoIsolado(cabecalho, anterior); err != nil {
+			return nil, false, comBloco(err, cabecalho.Indice)
+		}
+		trabalho.Add(trabalho, trabalhoDoBloco(cabecalho))
+		anterior = cabecalho
+	}
+	bc.mu.Lock()
+	nossoTrabalho := bc.ponta.trabalho
+	bc.mu.Unlock()
+	// Se o peer já mandou tudo, os cabeçalhos precisam provar o trabalho que
+	// ele anunciou; senão a rodada seguinte continua de onde esta parar
+	if completos && trabalho.Cmp(nossoTrabalho) <= 0 {
+		return nil, false, fmt.Errorf("cabeçalhos somam menos trabalho que a cadeia local")
+	}
+	return cabecalhos, completos, nil
+}
+
+func (bc *Blockchain) pedirCabecalhos(endereco string, localizador []string, max int) ([]Bloco, error) {
+	corpo, err := json.Marshal(PedidoCabecalhos{Localizador: localizador, Max: max})
+	if err != nil {
+		return nil, err
+	}
+	resp, err := bc.peers.clientePara(endereco).Post(endereco+"/cabecalhos", "application/json", bytes.NewReader(corpo))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status %d", resp.StatusCode)
+	}
+	var cabecalhos []Bloco
+	if err := json.NewDecoder(resp.Body).Decode(&cabecalhos); err != nil {
+		return nil, err
+	}
+	if len(cabecalhos) > max {
+		return nil, fmt.Errorf("%d cabeçalhos, pedidos no máximo %d", len(cabecalhos), max)
+	}
+	return cabecalhos, nil
+}
+
+// baixarCorpos busca os corpos em janelas de lotes paralelos, cada lote num
+// peer diferente, e guarda cada janela em ordem antes de passar à seguinte.
+// Assim o que já foi baixado fica gravado mesmo que a rodada pare no meio.
+func (bc *Blockchain) baixarCorpos(cabecalhos []Bloco, fontes []string) error {
+	var lotes [][]Bloco
+	for i := 0; i < len(cabecalhos); i += tamanhoLoteBlocos {
+		lotes = append(lotes, cabecalhos[i:min(i+tamanhoLoteBlocos, len(cabecalhos))])
+	}
+	for inicio := 0; inicio < len(lotes); inicio += downloadsParalelos {
+		janela := lotes[inicio:min(inicio+downloadsParalelos, len(lotes))]
+		corpos := make([][]Bloco, len(janela))
+		erros := make([]error, len(janela))
+		var wg sync.WaitGroup
+		for i, lote := range janela {
+			wg.Add(1)
+			go func(i int, lote []Bloco) {
+				defer wg.Done()
+				corpos[i], erros[i] = bc.baixarLote(lote, fontes, inicio+i)
+			}(i, lote)
+		}
+		wg.Wait()
+		for i := range janela {
+			if erros[i] != nil {
+				return erros[i]
+			}
+			if err := bc.guardarCorpos(corpos[i]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// baixarLote pede o lote a um dos peers e, se ele falhar, tenta os seguintes.
+func (bc *Blockchain) baixarLote(lote []Bloco, fontes []string, n int) ([]Bloco, error) {
+	hashes := make([]string, len(lote))
+	for i, cabecalho := range lote {
+		hashes[i] = cabecalho.HashAtual
+	}
+	err := fmt.Errorf("nenhum peer tem os blocos a partir do %d", lote[0].Indice)
+	for tentativa := 0; tentativa < len(fontes); tentativa++ {
+		endereco := fontes[(n+tentativa)%len(fontes)]
+		var blocos []Bloco
+		if blocos, err = bc.pedirBlocos(endereco, hashes); err == nil {
+			return blocos, nil
+		}
+		log.Printf("Blocos a partir do %d indisponíveis em %s: %v", lote[0].Indice, endereco, err)
+	}
+	return nil, err
+}
+
+// pedirBlocos pede ao peer os blocos completos, na ordem dos hashes.
+func (bc *Blockchain) pedirBlocos(endereco string, hashes []string) ([]Bloco, error) {
+	corpo, err := json.Marshal(PedidoBlocos{Hashes: hashes})
+	if err != nil {
+		return nil, err
+	}
+	resp, err := bc.peers.clientePara(endereco).Post(endereco+"/blocos", "application/json", bytes.NewReader(corpo))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status %d", resp.StatusCode)
+	}
+	var blocos []Bloco
+	if err := json.NewDecoder(resp.Body).Decode(&blocos); err != nil {
+		return nil, err
+	}
+	if len(blocos) != len(hashes) {
+		return nil, fmt.Errorf("%d de %d blocos", len(blocos), len(hashes))
+	}
+	// O hash é recalculado em guardarBloco, então um corpo que não
+	// corresponda ao cabeçalho é recusado lá
+	for i, bloco := range blocos {
+		if bloco.HashAtual != hashes[i] {
+			return nil, fmt.Errorf("bloco %s fora de ordem", bloco.HashAtual)
+		}
+	}
+	return blocos, nil
+}
+
+// guardarCorpos valida e guarda um lote baixado e aplica a escolha de ramo.
+func (bc *Blockchain) guardarCorpos(blocos []Bloco) error {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	var ultimo, melhor *noBloco
+	for _, bloco := range blocos {
+		no, err := bc.guardarBloco(bloco)
+		if err != nil {
+			return err
+		}
+		ultimo = no
+		// Órfãos que esperavam por este bloco entram junto
+		if candidato, _ := bc.conectarOrfaos(no); melhor == nil || candidato.trabalho.Cmp(melhor.trabalho) > 0 {
+			melhor = candidato
+		}
+	}
+	bc.sincronia.mu.Lock()
+	bc.sincronia.retomarDe = ultimo.bloco.HashAtual
+	bc.sincronia.progresso.BlocosBaixados += len(blocos)
+	bc.sincronia.progresso.BlocosFaltando -= len(blocos)
+	bc.sincronia.mu.Unlock()
+	return bc.escolherPonta(melhor)
+}
+
+// HandlePonta responde com a ponta da cadeia principal.
+func (bc *Blockchain) HandlePonta(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	if r.Method == "OPTIONS" {
+		return
+	}
+	bc.mu.Lock()
+	ponta := bc.pontaCadeia()
+	bc.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ponta)
+}
+
+// HandleCabecalhos responde com os cabeçalhos (blocos sem as transações) da
+// cadeia principal depois do ponto indicado pelo localizador.
+func (bc *Blockchain) HandleCabecalhos(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	if r.Method == "OPTIONS" {
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Método não permitido", http.StatusMethodNotAllowed)
+		return
+	}
+	var pedido PedidoCabecalhos
+	if err := json.NewDecoder(r.Body).Decode(&pedido); err != nil {
+		http.Error(w, "Erro ao decodificar pedido", http.StatusBadRequest)
+		return
+	}
+	if len(pedido.Localizador) > maxLocalizador {
+		http.Error(w, "Localizador longo demais", http.StatusBadRequest)
+		return
+	}
+	if pedido.Max <= 0 || pedido.Max > maxCabecalhosPorPedido {
+		pedido.Max = maxCabecalhosPorPedido
+	}
+	bc.mu.Lock()
+	cabecalhos := bc.cabecalhosApos(pedido.Localizador, pedido.Max)
+	bc.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(cabecalhos)
+}
+
+// HandleBlocosPorHash responde com os blocos completos pedidos, de qualquer
+// ramo conhecido, na ordem do pedido. Hashes desconhecidos são omitidos.
+func (bc *Blockchain) HandleBlocosPorHash(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	if r.Method == "OPTIONS" {
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Método não permitido", http.StatusMethodNotAllowed)
+		return
+	}
+	var pedido PedidoBlocos
+	if err := json.NewDecoder(r.Body).Decode(&pedido); err != nil {
+		http.Error(w, "Erro ao decodificar pedido", http.StatusBadRequest)
+		return
+	}
+	if len(pedido.Hashes) > maxBlocosPorPedido {
+		http.Error(w, fmt.Sprintf("No máximo %d blocos por pedido", maxBlocosPorPedido), http.StatusBadRequest)
+		return
+	}
+	blocos := []Bloco{}
+	bc.mu.Lock()
+	for _, hash := range pedido.Hashes {
+		if no, existe := bc.arvore.nos[hash]; existe && !no.invalido {
+			blocos = append(blocos, no.bloco)
+		}
+	}
+	bc.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(blocos)
+}
+
+// HandleSincronizacao mostra o progresso da sincronização.
+func (bc *Blockchain) HandleSincronizacao(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	if r.Method == "OPTIONS" {
+		return
+	}
+	progresso := bc.sincronia.Progresso()
+	bc.mu.Lock()
+	progresso.AlturaLocal = len(bc.Blocos) - 1
+	bc.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(progresso)
+}
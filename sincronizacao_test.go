@@ -0,0 +1,115 @@
+package main
+
+import (
+	"strconv"
+	"testing"
+)
+
+// limitesPequenos reduz os lotes da sincronização durante o teste.
+func limitesPequenos(t *testing.T, porPedido, porRodada, lote int) {
+	pedido, rodada, tamanho, paralelos := maxCabecalhosPorPedido, maxCabecalhosPorRodada, tamanhoLoteBlocos, downloadsParalelos
+	maxCabecalhosPorPedido, maxCabecalhosPorRodada, tamanhoLoteBlocos, downloadsParalelos = porPedido, porRodada, lote, 2
+	t.Cleanup(func() {
+		maxCabecalhosPorPedido, maxCabecalhosPorRodada, tamanhoLoteBlocos, downloadsParalelos = pedido, rodada, tamanho, paralelos
+	})
+}
+
+func conectar(t *testing.T, bc *Blockchain, enderecos ...string) {
+	t.Helper()
+	for _, endereco := range enderecos {
+		bc.peers.Adicionar(endereco)
+		if err := bc.Handshake(endereco); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func minerarBlocos(bc *Blockchain, n int, evento string) {
+	for i := 0; i < n; i++ {
+		bc.AdicionarRegistro(evento + strconv.Itoa(i))
+	}
+}
+
+// Testa que um nó novo baixa a cadeia em lotes de dois peers a partir dos cabeçalhos
+func TestSincronizacaoPorCabecalhos(t *testing.T) {
+	limitesPequenos(t, 7, 100, 4)
+	a, b, c := novoBlockchainTeste(t), novoBlockchainTeste(t), novoBlockchainTeste(t)
+	minerarBlocos(a, 25, "A")
+	incorporar(t, c, a.Blocos)
+	conectar(t, b, servirPeer(t, a), servirPeer(t, c))
+
+	b.SincronizarComPeers()
+	if len(b.Blocos) != len(a.Blocos) || b.ponta.bloco.HashAtual != a.ponta.bloco.HashAtual {
+		t.Fatalf("b deveria alcançar a ponta de a, está na altura %d", len(b.Blocos)-1)
+	}
+	if !b.ValidarBlockchain() {
+		t.Error("Cadeia sincronizada deveria ser válida")
+	}
+	progresso := b.sincronia.Progresso()
+	if progresso.Cabecalhos != 25 || progresso.BlocosBaixados != 25 || progresso.BlocosFaltando != 0 || progresso.Sincronizando || progresso.Erro != "" {
+		t.Errorf("Progresso inesperado: %+v", progresso)
+	}
+
+	// Em dia, a rodada seguinte não pede nada
+	b.SincronizarComPeers()
+	if progresso := b.sincronia.Progresso(); progresso.BlocosBaixados != 25 {
+		t.Errorf("Nó em dia não deveria baixar blocos, obtido %+v", progresso)
+	}
+}
+
+// Testa que um ramo com mais trabalho é baixado em rodadas que continuam de onde a anterior parou
+func TestSincronizacaoRetomaRamoAlternativo(t *testing.T) {
+	limitesPequenos(t, 5, 5, 3)
+	a, b := NovoBlockchain(nil), NovoBlockchain(nil)
+	minerarBlocos(a, 2, "Comum")
+	incorporar(t, b, a.Blocos)
+	minerarBlocos(a, 12, "A")
+	minerarBlocos(b, 8, "B")
+	conectar(t, b, servirPeer(t, a))
+	pontaB := b.ponta.bloco.HashAtual
+
+	// A primeira rodada só chega à altura 7 do ramo de a, ainda atrás de b
+	b.SincronizarComPeers()
+	if b.ponta.bloco.HashAtual != pontaB || !b.arvore.Contem(a.Blocos[7].HashAtual) || b.arvore.Contem(a.Blocos[8].HashAtual) {
+		t.Fatalf("Primeira rodada deveria guardar o ramo de a até a altura 7 sem trocar a ponta, progresso %+v", b.sincronia.Progresso())
+	}
+
+	b.SincronizarComPeers()
+	if progresso := b.sincronia.Progresso(); progresso.Cabecalhos != 5 || progresso.BlocosBaixados != 5 {
+		t.Errorf("Segunda rodada deveria pedir só os cabeçalhos depois da altura 7, obtido %+v", progresso)
+	}
+	b.SincronizarComPeers()
+	if b.ponta.bloco.HashAtual != a.ponta.bloco.HashAtual {
+		t.Fatalf("b deveria adotar o ramo de a, está na altura %d", len(b.Blocos)-1)
+	}
+	if len(b.reorgs) != 1 || b.reorgs[0].AncestralComum != 2 {
+		t.Errorf("Esperada uma reorganização a partir do bloco 2, obtido %+v", b.reorgs)
+	}
+	if b.sincronia.retomarDe != "" {
+		t.Errorf("Sincronização completa não deveria deixar ponto de retomada, obtido %s", b.sincronia.retomarDe)
+	}
+}
+
+// Testa que cabeçalhos sem prova de trabalho ou com dificuldade implausível são recusados
+func TestCabecalhoSemProvaRecusado(t *testing.T) {
+	bc := NovoBlockchain(nil)
+	minerarBlocos(bc, 2, "A")
+	cabecalho, pai := bc.Blocos[2], bc.Blocos[1]
+	cabecalho.Transacoes = nil
+	if err := bc.validarCabecalhoIsolado(cabecalho, pai); err != nil {
+		t.Fatalf("Cabeçalho válido recusado: %v", err)
+	}
+	alterado := cabecalho
+	alterado.Nonce++
+	if err := bc.validarCabecalhoIsolado(alterado, pai); motivoDe(err) != MotivoHashInvalido {
+		t.Errorf("Nonce alterado deveria invalidar a prova de trabalho, obtido %v", err)
+	}
+	alterado = cabecalho
+	alterado.Dificuldade = 1
+	if err := bc.validarCabecalhoIsolado(alterado, pai); motivoDe(err) != MotivoDificuldade {
+		t.Errorf("Dificuldade menor fora da altura de ajuste deveria ser recusada, obtido %v", err)
+	}
+	if hashes := localizador(bc.ponta); len(hashes) != 3 || hashes[2] != bc.hashGenesis {
+		t.Errorf("Localizador deveria terminar no gênesis, obtido %v", hashes)
+	}
+}
@@ -0,0 +1,349 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	maxTransacoesPorBloco = 100
+	limiteMempool         = 5000
+	// Uma conta pode ter no mempool transações com nonces até este tanto à
+	// frente do seu; mais que isso não seria minerado tão cedo.
+	maxAdiantadasPorConta = 64
+	validadeMempool       = time.Hour
+)
+
+// Transacao é uma operação da aplicação (aposta, depósito, criação de
+// evento...). Várias transações são empacotadas em um mesmo bloco.
+type Transacao struct {
+	ID           string `json:"id"`
+	Tipo         string `json:"tipo"`
+	Dados        string `json:"dados"`
+	Timestamp    string `json:"timestamp"`
+	ChavePublica string `json:"chave_publica"`
+	Nonce        uint64 `json:"nonce"`
+	// rede para a qual a transação foi assinada; impede que ela seja
+	// repetida em outra cadeia
+	ChainID    string `json:"chain_id,omitempty"`
+	Assinatura string `json:"assinatura"`
+}
+
+func NovaTransacao(tipo string, dados interface{}) (Transacao, error) {
+	dadosBytes, err := json.Marshal(dados)
+	if err != nil {
+		return Transacao{}, err
+	}
+	tx := Transacao{
+		Tipo:      tipo,
+		Dados:     string(dadosBytes),
+		Timestamp: time.Now().Format(time.RFC3339Nano),
+	}
+	tx.ID = calculaIDTransacao(tx)
+	return tx, nil
+}
+
+func calculaIDTransacao(tx Transacao) string {
+	// O tamanho de cada campo entra no hash para que as fronteiras entre eles
+	// não sejam ambíguas.
+	dados := fmt.Sprintf("%d:%s%d:%s%d:%s%d:%s%d", len(tx.Tipo), tx.Tipo, len(tx.Dados), tx.Dados, len(tx.Timestamp), tx.Timestamp, len(tx.ChavePublica), tx.ChavePublica, tx.Nonce)
+	// Sem chain ID o ID fica como antes, para não mudar o hash do gênesis
+	if tx.ChainID != "" {
+		dados += fmt.Sprintf(":%d:%s", len(tx.ChainID), tx.ChainID)
+	}
+	hash := sha256.Sum256([]byte(dados))
+	return hex.EncodeToString(hash[:])
+}
+
+// transacoesDoBloco devolve as transações de um bloco. O gênesis guarda a
+// especificação da rede em Evento/Resultado, que é tratada como uma
+// transação; nos demais blocos esses campos não têm efeito.
+func transacoesDoBloco(bloco Bloco) []Transacao {
+	if bloco.Indice == 0 && bloco.Evento == "genesis" {
+		return []Transacao{{Tipo: bloco.Evento, Dados: bloco.Resultado, Timestamp: bloco.Timestamp}}
+	}
+	return bloco.Transacoes
+}
+
+func idsTransacoes(transacoes []Transacao) []string {
+	ids := make([]string, len(transacoes))
+	for i, tx := range transacoes {
+		ids[i] = tx.ID
+	}
+	return ids
+}
+
+// validarTransacoesBloco confere assinaturas, a ausência de repetidas e a raiz
+// de Merkle gravada no cabeçalho. Depois do gênesis todo bloco traz ao menos
+// uma transação assinada.
+func validarTransacoesBloco(bloco Bloco) bool {
+	if len(bloco.Transacoes) > maxTransacoesPorBloco || (bloco.Indice > 0 && len(bloco.Transacoes) == 0) {
+		return false
+	}
+	vistas := make(map[string]bool, len(bloco.Transacoes))
+	for _, tx := range bloco.Transacoes {
+		if validarTransacaoAssinada(tx) != nil || vistas[tx.ID] {
+			return false
+		}
+		vistas[tx.ID] = true
+	}
+	return bloco.RaizMerkle == raizMerkle(idsTransacoes(bloco.Transacoes))
+}
+
+// indexarTransacoes registra as transações de um bloco que entrou na cadeia
+// principal. Deve ser chamado com bc.mu travado.
+func (bc *Blockchain) indexarTransacoes(bloco Bloco) {
+	for _, tx := range bloco.Transacoes {
+		bc.txConfirmadas[tx.ID] = bloco.Indice
+	}
+}
+
+func (bc *Blockchain) desindexarTransacoes(bloco Bloco) {
+	for _, tx := range bloco.Transacoes {
+		delete(bc.txConfirmadas, tx.ID)
+	}
+}
+
+type Mempool struct {
+	mu         sync.Mutex
+	transacoes map[string]Transacao
+	ordem      []string
+	// chegada de cada transação, para expirar as que ficam paradas
+	chegadas map[string]time.Time
+	// porConta indexa as pendentes pelo remetente e pelo nonce
+	porConta map[string]map[uint64]string
+	novas    chan struct{}
+}
+
+func NovoMempool() *Mempool {
+	return &Mempool{
+		transacoes: make(map[string]Transacao),
+		chegadas:   make(map[string]time.Time),
+		porConta:   make(map[string]map[uint64]string),
+		novas:      make(chan struct{}, 1),
+	}
+}
+
+// Adicionar guarda a transação se ela puder ser minerada em breve: o nonce
+// não pode estar usado nem passar maxAdiantadasPorConta à frente do nonce da
+// conta em nonces, e a conta não pode ter outra pendente com o mesmo nonce.
+// Com o mempool cheio, sai a transação mais adiantada em relação à sua conta,
+// desde que mais adiantada que a nova; as que já podem ser mineradas nunca
+// saem para dar lugar a outras. Devolve false se a transação não entrou.
+func (m *Mempool) Adicionar(tx Transacao, nonces map[string]uint64, agora time.Time) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.expirar(agora)
+	if _, existe := m.transacoes[tx.ID]; existe {
+		return false
+	}
+	conta := remetente(tx)
+	proximo := nonces[conta]
+	if tx.Nonce < proximo || tx.Nonce-proximo >= maxAdiantadasPorConta {
+		return false
+	}
+	if _, ocupado := m.porConta[conta][tx.Nonce]; ocupado {
+		return false
+	}
+	if len(m.transacoes) >= limiteMempool {
+		descartar, adiantamento := "", tx.Nonce-proximo
+		for _, id := range m.ordem {
+			pendente := m.transacoes[id]
+			atual := nonces[remetente(pendente)]
+			a := pendente.Nonce - atual
+			if pendente.Nonce < atual {
+				// Nonce já usado: nunca será minerada
+				a = math.MaxUint64
+			}
+			if a > adiantamento {
+				descartar, adiantamento = id, a
+			}
+		}
+		if descartar == "" {
+			return false
+		}
+		m.remover(descartar)
+		m.compactar()
+	}
+	m.transacoes[tx.ID] = tx
+	m.chegadas[tx.ID] = agora
+	if m.porConta[conta] == nil {
+		m.porConta[conta] = make(map[uint64]string)
+	}
+	m.porConta[conta][tx.Nonce] = tx.ID
+	m.ordem = append(m.ordem, tx.ID)
+	select {
+	case m.novas <- struct{}{}:
+	default:
+	}
+	return true
+}
+
+// expirar descarta as transações que esperam há mais de validadeMempool.
+// Como ordem segue a chegada, basta olhar o começo.
+func (m *Mempool) expirar(agora time.Time) {
+	expiradas := 0
+	for _, id := range m.ordem {
+		if agora.Sub(m.chegadas[id]) <= validadeMempool {
+			break
+		}
+		m.remover(id)
+		expiradas++
+	}
+	if expiradas > 0 {
+		m.ordem = m.ordem[expiradas:]
+	}
+}
+
+// remover tira a transação dos índices; ordem é compactada por quem chama.
+func (m *Mempool) remover(id string) {
+	tx := m.transacoes[id]
+	conta := remetente(tx)
+	delete(m.transacoes, id)
+	delete(m.chegadas, id)
+	if nonces := m.porConta[conta]; nonces[tx.Nonce] == id {
+		delete(nonces, tx.Nonce)
+		if len(nonces) == 0 {
+			delete(m.porConta, conta)
+		}
+	}
+}
+
+func (m *Mempool) compactar() {
+	ordem := m.ordem[:0]
+	for _, id := range m.ordem {
+		if _, existe := m.transacoes[id]; existe {
+			ordem = append(ordem, id)
+		}
+	}
+	m.ordem = ordem
+}
+
+// Selecionar devolve até max transações pendentes, na ordem de chegada.
+func (m *Mempool) Selecionar(max int) []Transacao {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var selecionadas []Transacao
+	for _, id := range m.ordem {
+		if len(selecionadas) == max {
+			break
+		}
+		selecionadas = append(selecionadas, m.transacoes[id])
+	}
+	return selecionadas
+}
+
+func (m *Mempool) Remover(ids ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	removidas := false
+	for _, id := range ids {
+		if _, existe := m.transacoes[id]; existe {
+			m.remover(id)
+			removidas = true
+		}
+	}
+	if removidas {
+		m.compactar()
+	}
+}
+
+func (m *Mempool) Pendentes() []Transacao {
+	return m.Selecionar(limiteMempool)
+}
+
+func (m *Mempool) Obter(id string) (Transacao, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	tx, existe := m.transacoes[id]
+	return tx, existe
+}
+
+func (m *Mempool) Tamanho() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.transacoes)
+}
+
+// SubmeterTransacoes coloca transações criadas neste nó no mempool e as
+// repassa aos peers. Transações submetidas juntas ficam em sequência no
+// mempool e por isso costumam ser mineradas no mesmo bloco.
+func (bc *Blockchain) SubmeterTransacoes(transacoes ...Transacao) {
+	for _, tx := range transacoes {
+		bc.mu.Lock()
+		adicionada := bc.mempool.Adicionar(tx, bc.estado.Nonces, time.Now())
+		bc.mu.Unlock()
+		if adicionada {
+			go bc.NotificarTransacao(tx)
+		}
+	}
+}
+
+// NotificarTransacao anuncia aos peers uma transação nova.
+func (bc *Blockchain) NotificarTransacao(tx Transacao) {
+	bc.anunciar(ItemInventario{Tipo: invTransacao, Hash: tx.ID})
+}
+
+func (bc *Blockchain) ReceberTransacao(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	if r.Method == "OPTIONS" {
+		return
+	}
+	var tx Transacao
+	if err := json.NewDecoder(r.Body).Decode(&tx); err != nil {
+		http.Error(w, "Dados inválidos", http.StatusBadRequest)
+		return
+	}
+	bc.peers.marcarConhecido(bc.origemDoPeer(r), tx.ID)
+	nova, err := bc.receberTransacao(tx)
+	switch {
+	case err != nil:
+		fmt.Fprintf(w, "Transação recebida é inválida: %v\n", err)
+	case !nova:
+		fmt.Fprintln(w, "Transação já conhecida")
+	default:
+		fmt.Fprintln(w, "Transação adicionada ao mempool")
+	}
+}
+
+// receberTransacao confere uma transação vinda de um peer, a inclui no
+// mempool e a repassa aos demais peers. nova é false se ela já era
+// conhecida.
+func (bc *Blockchain) receberTransacao(tx Transacao) (nova bool, err error) {
+	if err := validarTransacaoAssinada(tx); err != nil {
+		return false, err
+	}
+	if tx.ChainID != bc.genesis.ChainID {
+		return false, rejeitar(MotivoChainID, "transação assinada para a rede %q, esta é %q", tx.ChainID, bc.genesis.ChainID)
+	}
+	bc.mu.Lock()
+	_, confirmada := bc.txConfirmadas[tx.ID]
+	adicionada := !confirmada && bc.mempool.Adicionar(tx, bc.estado.Nonces, time.Now())
+	bc.mu.Unlock()
+	if !adicionada {
+		return false, nil
+	}
+	log.Printf("Transação %s (%s) recebida de peer", tx.ID, tx.Tipo)
+	go bc.anunciar(ItemInventario{Tipo: invTransacao, Hash: tx.ID})
+	return true, nil
+}
+
+func (bc *Blockchain) HandleMempool(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	if r.Method == "OPTIONS" {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(bc.mempool.Pendentes())
+}
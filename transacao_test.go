@@ -0,0 +1,158 @@
+package main
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func transacaoAssinada(t *testing.T, carteira *Carteira, nonce uint64, tipo string, dados interface{}) Transacao {
+	t.Helper()
+	tx, err := NovaTransacao(tipo, dados)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx.ChainID = GenesisPadrao.ChainID
+	carteira.Assinar(&tx, nonce)
+	return tx
+}
+
+// novoBlockchainComSaldos cria um nó cujo gênesis já dá saldo às carteiras,
+// porque sem emissores ninguém deposita.
+func novoBlockchainComSaldos(t *testing.T, saldos map[*Carteira]Quantia) *Blockchain {
+	t.Helper()
+	bc, err := CarregarBlockchain(nil, NovoArmazenamentoMemoria(), genesisComSaldos(saldos))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bc
+}
+
+// estadoComSaldos devolve o estado depois do gênesis com os saldos.
+func estadoComSaldos(t *testing.T, saldos map[*Carteira]Quantia) *EstadoMundo {
+	t.Helper()
+	estado := NovoEstadoMundo()
+	if err := estado.Aplicar(genesisComSaldos(saldos).Bloco()); err != nil {
+		t.Fatal(err)
+	}
+	return estado
+}
+
+func genesisComSaldos(saldos map[*Carteira]Quantia) EspecificacaoGenesis {
+	especificacao := GenesisPadrao
+	especificacao.Saldos = make(map[string]Quantia)
+	for carteira, valor := range saldos {
+		especificacao.Saldos[carteira.Endereco] = valor
+	}
+	return especificacao
+}
+
+// Testa que várias transações pendentes são mineradas em um único bloco
+func TestMinerarVariasTransacoesNoMesmoBloco(t *testing.T) {
+	carteira, _ := NovaCarteira()
+	bc := novoBlockchainComSaldos(t, map[*Carteira]Quantia{carteira: Reais(51)})
+	for i := 0; i < 51; i++ {
+		bc.SubmeterTransacoes(transacaoAssinada(t, carteira, uint64(i), "ajustar_saldo", map[string]interface{}{"usuario": carteira.Endereco, "valor": -1.0}))
+	}
+
+	bloco, ok := bc.MinerarPendentes()
+	if !ok {
+		t.Fatal("Esperado um bloco minerado")
+	}
+	if len(bloco.Transacoes) != 51 || len(bc.Blocos) != 2 {
+		t.Fatalf("Esperado 1 bloco com 51 transações, obtido %d bloco(s) com %d", len(bc.Blocos)-1, len(bloco.Transacoes))
+	}
+	if bc.mempool.Tamanho() != 0 {
+		t.Errorf("Mempool deveria estar vazio, tem %d", bc.mempool.Tamanho())
+	}
+	if !bc.ValidarBlockchain() {
+		t.Error("Blockchain deveria ser válida")
+	}
+}
+
+// Testa as provas de inclusão para todas as posições em árvores de vários tamanhos
+func TestProvaMerkle(t *testing.T) {
+	for n := 1; n <= 9; n++ {
+		ids := make([]string, n)
+		for i := range ids {
+			ids[i] = "tx" + strconv.Itoa(i)
+		}
+		raiz := raizMerkle(ids)
+		for i, id := range ids {
+			if !VerificarProvaMerkle(id, caminhoMerkle(ids, i), raiz) {
+				t.Errorf("Prova inválida para a folha %d de %d", i, n)
+			}
+		}
+		if VerificarProvaMerkle("outra", caminhoMerkle(ids, 0), raiz) {
+			t.Errorf("Prova não deveria valer para transação fora da árvore (%d folhas)", n)
+		}
+	}
+}
+
+// Testa que alterar uma transação invalida o bloco mesmo mantendo o cabeçalho
+func TestBlocoComTransacaoAlteradaRejeitado(t *testing.T) {
+	carteira, _ := NovaCarteira()
+	bc := novoBlockchainComSaldos(t, map[*Carteira]Quantia{carteira: Reais(10)})
+	bloco := bc.AdicionarTransacao(transacaoAssinada(t, carteira, 0, "ajustar_saldo", map[string]interface{}{"usuario": carteira.Endereco, "valor": -10.0}))
+
+	alterado := bloco
+	alterado.Transacoes = []Transacao{bloco.Transacoes[0]}
+	alterado.Transacoes[0].Dados = `{"usuario":"alice","valor":1000000}`
+	if bc.ValidarBloco(alterado) {
+		t.Error("Bloco com dados de transação alterados deveria ser inválido")
+	}
+
+	carteira.Assinar(&alterado.Transacoes[0], 0)
+	if bc.ValidarBloco(alterado) {
+		t.Error("Bloco com raiz de Merkle divergente deveria ser inválido")
+	}
+}
+
+// Testa que o mempool recusa nonces usados, repetidos ou muito adiantados, expira as paradas e, cheio, tira as mais adiantadas
+func TestLimitesDoMempool(t *testing.T) {
+	m := NovoMempool()
+	agora := time.Now()
+	nova := func(carteira *Carteira, nonce uint64) Transacao {
+		return transacaoAssinada(t, carteira, nonce, "criar_evento", Evento{Nome: "E" + strconv.FormatUint(nonce, 10), Opcoes: []string{"X", "Y"}})
+	}
+	alice, _ := NovaCarteira()
+	nonces := map[string]uint64{alice.Endereco: 3}
+	if m.Adicionar(nova(alice, 2), nonces, agora) || m.Adicionar(nova(alice, 3+maxAdiantadasPorConta), nonces, agora) {
+		t.Error("Nonce já usado ou adiantado demais não deveria entrar")
+	}
+	if !m.Adicionar(nova(alice, 3), nonces, agora) {
+		t.Fatal("Transação com o próximo nonce deveria entrar")
+	}
+	outra := transacaoAssinada(t, alice, 3, "criar_evento", Evento{Nome: "Outra", Opcoes: []string{"X", "Y"}})
+	if m.Adicionar(outra, nonces, agora) {
+		t.Error("Segunda transação com o mesmo nonce da conta não deveria entrar")
+	}
+	if !m.Adicionar(nova(alice, 4), nonces, agora.Add(validadeMempool+time.Minute)) || m.Tamanho() != 1 {
+		t.Errorf("A transação parada deveria expirar, mempool com %d", m.Tamanho())
+	}
+
+	// Enche o mempool com contas descartáveis, cada uma até o limite de adiantamento
+	m = NovoMempool()
+	nonces = map[string]uint64{}
+	var carteira *Carteira
+	for i := 0; i < limiteMempool; i++ {
+		if i%maxAdiantadasPorConta == 0 {
+			carteira, _ = NovaCarteira()
+		}
+		m.Adicionar(nova(carteira, uint64(i%maxAdiantadasPorConta)), nonces, agora)
+	}
+	if m.Tamanho() != limiteMempool {
+		t.Fatalf("Mempool deveria estar cheio, tem %d", m.Tamanho())
+	}
+	bob, _ := NovaCarteira()
+	if m.Adicionar(nova(bob, maxAdiantadasPorConta-1), nonces, agora) {
+		t.Error("Transação tão adiantada quanto as pendentes não deveria tirar nenhuma")
+	}
+	legitima := nova(bob, 0)
+	if !m.Adicionar(legitima, nonces, agora) || m.Tamanho() != limiteMempool {
+		t.Fatal("Transação pronta para mineração deveria tomar o lugar de uma adiantada")
+	}
+	if _, existe := m.Obter(legitima.ID); !existe {
+		t.Error("Transação legítima deveria estar no mempool")
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+// MotivoRejeicao identifica por que um bloco ou transação foi recusado. Os
+// valores são estáveis e aparecem nas respostas HTTP e nos logs.
+type MotivoRejeicao string
+
+const (
+	MotivoGenesisDiferente    MotivoRejeicao = "genesis_diferente"
+	MotivoEncadeamento        MotivoRejeicao = "encadeamento_invalido"
+	MotivoDificuldade         MotivoRejeicao = "dificuldade_invalida"
+	MotivoTimestamp           MotivoRejeicao = "timestamp_invalido"
+	MotivoHashInvalido        MotivoRejeicao = "hash_ou_prova_invalidos"
+	MotivoNonce               MotivoRejeicao = "nonce_invalido"
+	MotivoTransacaoMalformada MotivoRejeicao = "transacao_malformada"
+	MotivoNaoAutorizado       MotivoRejeicao = "nao_autorizado"
+	MotivoSaldoInsuficiente   MotivoRejeicao = "saldo_insuficiente"
+	MotivoValorInvalido       MotivoRejeicao = "valor_invalido"
+	MotivoEventoInvalido      MotivoRejeicao = "evento_invalido"
+	MotivoEventoInexistente   MotivoRejeicao = "evento_inexistente"
+	MotivoOpcaoInvalida       MotivoRejeicao = "opcao_invalida"
+	MotivoEventoConcluido     MotivoRejeicao = "evento_ja_concluido"
+	MotivoEventoCancelado     MotivoRejeicao = "evento_cancelado"
+	MotivoEventoDisputado     MotivoRejeicao = "evento_em_disputa"
+	MotivoApostasAbertas      MotivoRejeicao = "apostas_abertas"
+	MotivoApostasEncerradas   MotivoRejeicao = "apostas_encerradas"
+	MotivoVotacaoEncerrada    MotivoRejeicao = "votacao_encerrada"
+	MotivoPrazoContestacao    MotivoRejeicao = "contestacao_encerrada"
+	MotivoPropostaInvalida    MotivoRejeicao = "proposta_invalida"
+	MotivoPropostaInexistente MotivoRejeicao = "proposta_inexistente"
+	MotivoDelegacaoInvalida   MotivoRejeicao = "delegacao_invalida"
+	MotivoDelegacaoCircular   MotivoRejeicao = "delegacao_circular"
+	MotivoVersao              MotivoRejeicao = "versao_invalida"
+	MotivoChainID             MotivoRejeicao = "chain_id_diferente"
+)
+
+// ErroValidacao é o erro devolvido pela validação de consenso. Bloco e
+// Transacao são preenchidos à medida que o erro sobe até quem validou a
+// cadeia.
+type ErroValidacao struct {
+	Motivo    MotivoRejeicao
+	Bloco     int
+	Transacao string
+	Detalhe   string
+}
+
+func (e *ErroValidacao) Error() string {
+	mensagem := fmt.Sprintf("%s: %s", e.Motivo, e.Detalhe)
+	if e.Transacao != "" {
+		mensagem = fmt.Sprintf("transação %s: %s", e.Transacao, mensagem)
+	}
+	if e.Bloco > 0 {
+		mensagem = fmt.Sprintf("bloco %d: %s", e.Bloco, mensagem)
+	}
+	return mensagem
+}
+
+func rejeitar(motivo MotivoRejeicao, formato string, args ...interface{}) *ErroValidacao {
+	return &ErroValidacao{Motivo: motivo, Detalhe: fmt.Sprintf(formato, args...)}
+}
+
+// comBloco anota o índice do bloco em erros de validação.
+func comBloco(err error, indice int) error {
+	var erro *ErroValidacao
+	if errors.As(err, &erro) && erro.Bloco == 0 {
+		erro.Bloco = indice
+	}
+	return err
+}
+
+// motivoDe devolve o motivo de um erro de validação, ou "" para outros erros
+// (falha de disco, por exemplo).
+func motivoDe(err error) MotivoRejeicao {
+	var erro *ErroValidacao
+	if errors.As(err, &erro) {
+		return erro.Motivo
+	}
+	return ""
+}
+
+// validarCadeia confere uma cadeia completa a partir do gênesis: cabeçalhos,
+// prova de trabalho, dificuldade, transações e as regras da aplicação
+// reaplicadas bloco a bloco.
+func (bc *Blockchain) validarCadeia(blocos []Bloco) error {
+	// Uma cadeia de outra rede nunca é aceita, por mais longa que seja
+	if len(blocos) == 0 || blocos[0].HashAtual != bc.hashGenesis || calculaHash(blocos[0]) != bc.hashGenesis {
+		return rejeitar(MotivoGenesisDiferente, "gênesis não corresponde ao da rede %s", bc.genesis.ChainID)
+	}
+	// O estado é aplicado junto com os cabeçalhos porque o tempo alvo do
+	// ajuste de dificuldade é um parâmetro governável
+	estado := NovoEstadoMundo()
+	if err := estado.Aplicar(blocos[0]); err != nil {
+		return err
+	}
+	for i := 1; i < len(blocos); i++ {
+		if err := bc.validarCabecalho(blocos[i], blocos[i-1], bc.dificuldadeNaCadeia(blocos, i, estado)); err != nil {
+			return comBloco(err, i)
+		}
+		if err := estado.Aplicar(blocos[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validarCabecalho confere o que não depende do estado da aplicação.
+func (bc *Blockchain) validarCabecalho(bloco, pai Bloco, dificuldadeEsperada int) error {
+	if bloco.Indice != pai.Indice+1 || bloco.HashAnterior != pai.HashAtual {
+		return rejeitar(MotivoEncadeamento, "bloco não aponta para o pai %s", pai.HashAtual)
+	}
+	if err := bc.validarVersao(bloco, pai); err != nil {
+		return err
+	}
+	if bloco.Dificuldade != dificuldadeEsperada {
+		return rejeitar(MotivoDificuldade, "dificuldade %d, esperada %d", bloco.Dificuldade, dificuldadeEsperada)
+	}
+	if !timestampValido(bloco, pai) {
+		return rejeitar(MotivoTimestamp, "timestamp %s inválido", bloco.Timestamp)
+	}
+	if !bc.ValidarBloco(bloco) {
+		return rejeitar(MotivoHashInvalido, "hash, prova de trabalho ou transações inválidos")
+	}
+	return nil
+}
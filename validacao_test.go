@@ -0,0 +1,169 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func inserirNaPonta(bc *Blockchain, transacoes ...Transacao) error {
+	bloco := minerarSobrePonta(bc, transacoes...)
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	return bc.inserirBloco(bloco)
+}
+
+// Testa que blocos que violam as regras da aplicação são rejeitados com o motivo certo
+func TestRegrasDaAplicacaoNoConsenso(t *testing.T) {
+	alice, _ := NovaCarteira()
+	bob, _ := NovaCarteira()
+	bc := novoBlockchainComSaldos(t, map[*Carteira]Quantia{alice: Reais(40), bob: Reais(10)})
+	if err := inserirNaPonta(bc,
+		transacaoAssinada(t, alice, 0, "criar_evento", Evento{Nome: "Final", Opcoes: []string{"X", "Y"}}),
+		transacaoAssinada(t, alice, 1, "apostar", Aposta{Usuario: alice.Endereco, Valor: Reais(30), EventoID: 1, Opcao: "X"}),
+		transacaoAssinada(t, bob, 0, "apostar", Aposta{Usuario: bob.Endereco, Valor: Reais(10), EventoID: 1, Opcao: "Y"}),
+	); err != nil {
+		t.Fatal(err)
+	}
+
+	// A mesma transação assinada para outra rede não pode ser repetida aqui
+	outraRede := transacaoAssinada(t, bob, 1, "votar", Voto{Usuario: bob.Endereco, EventoID: 1, Opcao: "X"})
+	outraRede.ChainID = "outra-rede"
+	bob.Assinar(&outraRede, 1)
+	semRede := outraRede
+	semRede.ChainID = ""
+	bob.Assinar(&semRede, 1)
+
+	casos := []struct {
+		nome   string
+		tx     Transacao
+		motivo MotivoRejeicao
+	}{
+		{"assinada para outra rede", outraRede, MotivoChainID},
+		{"assinada sem rede", semRede, MotivoChainID},
+		{"crédito em outra conta", transacaoAssinada(t, bob, 1, "ajustar_saldo", map[string]interface{}{"usuario": alice.Endereco, "valor": 1e6}), MotivoNaoAutorizado},
+		{"saque acima do saldo", transacaoAssinada(t, bob, 1, "ajustar_saldo", map[string]interface{}{"usuario": bob.Endereco, "valor": -1.0}), MotivoSaldoInsuficiente},
+		{"evento inexistente", transacaoAssinada(t, bob, 1, "concluir_evento", map[string]interface{}{"evento_id": 7, "opcao_vencedora": "X"}), MotivoEventoInexistente},
+		{"opção inexistente", transacaoAssinada(t, bob, 1, "votar", Voto{Usuario: bob.Endereco, EventoID: 1, Opcao: "Z"}), MotivoOpcaoInvalida},
+		{"conclusão por quem não resolve", transacaoAssinada(t, bob, 1, "concluir_evento", map[string]interface{}{"evento_id": 1, "opcao_vencedora": "Y"}), MotivoNaoAutorizado},
+		{"tipo desconhecido", transacaoAssinada(t, bob, 1, "Evento1", "Resultado1"), MotivoTransacaoMalformada},
+		{"nonce repetido", transacaoAssinada(t, bob, 0, "votar", Voto{Usuario: bob.Endereco, EventoID: 1, Opcao: "X"}), MotivoNonce},
+	}
+	for _, caso := range casos {
+		if err := inserirNaPonta(bc, caso.tx); motivoDe(err) != caso.motivo {
+			t.Errorf("%s: esperado motivo %q, obtido %v", caso.nome, caso.motivo, err)
+		}
+	}
+
+	// Alice criou e resolve o evento, com a caução de resolução. Bob vence:
+	// recebe de volta o que apostou mais o que a alice perdeu
+	conclusao := transacaoAssinada(t, alice, 2, "concluir_evento", map[string]interface{}{"evento_id": 1, "opcao_vencedora": "Y"})
+	if err := inserirNaPonta(bc, conclusao); err != nil {
+		t.Fatal(err)
+	}
+	if evento, _ := bc.estado.Evento(1); evento.Premios[bob.Endereco] != Reais(40) {
+		t.Errorf("Prêmio do vencedor esperado 40, obtido %v", evento.Premios)
+	}
+	if err := inserirNaPonta(bc, transacaoAssinada(t, alice, 3, "concluir_evento", map[string]interface{}{"evento_id": 1, "opcao_vencedora": "X"})); motivoDe(err) != MotivoEventoConcluido {
+		t.Errorf("Segunda conclusão deveria ser rejeitada, obtido %v", err)
+	}
+	if err := bc.VerificarEstado(); err != nil {
+		t.Error(err)
+	}
+}
+
+// Testa que a sincronização rejeita uma cadeia cujo bloco cunha saldo para outra conta
+func TestCadeiaComCreditoIndevidoRejeitada(t *testing.T) {
+	peer := NovoBlockchain(nil)
+	ladrao, _ := NovaCarteira()
+	vitima, _ := NovaCarteira()
+	bloco := minerarSobrePonta(peer, transacaoAssinada(t, ladrao, 0, "ajustar_saldo", map[string]interface{}{"usuario": vitima.Endereco, "valor": 1e6}))
+
+	bc := NovoBlockchain(nil)
+	err := bc.validarCadeia(append(append([]Bloco{}, peer.Blocos...), bloco))
+	if motivoDe(err) != MotivoNaoAutorizado {
+		t.Errorf("Esperado motivo %q, obtido %v", MotivoNaoAutorizado, err)
+	}
+	if bc.ValidarNovaBlockchain(append(append([]Bloco{}, peer.Blocos...), bloco)) {
+		t.Error("Cadeia com crédito indevido não deveria ser aceita")
+	}
+}
+
+// Testa que no gênesis padrão, sem emissores, ninguém credita saldo, nem na própria conta, e que com emissores só eles creditam
+func TestCreditoSoPorEmissores(t *testing.T) {
+	bc := NovoBlockchain(nil)
+	conta, _ := NovaCarteira()
+	proprio := transacaoAssinada(t, conta, 0, "ajustar_saldo", map[string]interface{}{"usuario": conta.Endereco, "valor": 1e6})
+	if err := inserirNaPonta(bc, proprio); motivoDe(err) != MotivoNaoAutorizado {
+		t.Errorf("Crédito na própria conta sem emissores deveria ser recusado, obtido %v", err)
+	}
+
+	emissor, _ := NovaCarteira()
+	especificacao := GenesisPadrao
+	especificacao.Emissores = []string{emissor.Endereco}
+	comEmissor, err := CarregarBlockchain(nil, NovoArmazenamentoMemoria(), especificacao)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := inserirNaPonta(comEmissor, proprio); motivoDe(err) != MotivoNaoAutorizado {
+		t.Errorf("Crédito na própria conta de quem não é emissor deveria ser recusado, obtido %v", err)
+	}
+	if err := inserirNaPonta(comEmissor, transacaoAssinada(t, emissor, 0, "ajustar_saldo", map[string]interface{}{"usuario": conta.Endereco, "valor": 10.0})); err != nil {
+		t.Fatal(err)
+	}
+	if saldo := comEmissor.CalcularSaldo(conta.Endereco); saldo != Reais(10) {
+		t.Errorf("Depósito do emissor deveria creditar 10, obtido %s", saldo)
+	}
+}
+
+// Testa que um bloco que repete a transação do gênesis depois da altura 0 não cunha saldo
+func TestGenesisForaDoInicioRejeitado(t *testing.T) {
+	bc := NovoBlockchain(nil)
+	bc.AdicionarRegistro("Evento1")
+	ladrao, _ := NovaCarteira()
+	especificacao := GenesisPadrao
+	especificacao.Saldos = map[string]Quantia{ladrao.Endereco: Reais(1000000)}
+	resultado, _ := json.Marshal(especificacao)
+	bloco := minerarSobrePonta(bc)
+	bloco.Evento, bloco.Resultado = "genesis", string(resultado)
+	bloco.Nonce, bloco.HashAtual = provaDeTrabalho(bloco, bloco.Dificuldade)
+
+	bc.mu.Lock()
+	err := bc.inserirBloco(bloco)
+	bc.mu.Unlock()
+	if err == nil || pontaDe(bc) == bloco.HashAtual {
+		t.Fatal("Bloco com a transação do gênesis fora do início deveria ser rejeitado")
+	}
+	if saldo := bc.CalcularSaldo(ladrao.Endereco); saldo != 0 {
+		t.Errorf("Nenhum saldo deveria ser cunhado, obtido %s", saldo)
+	}
+}
+
+// Testa que operações sem assinatura, soltas no bloco ou como transação, não debitam a conta de ninguém
+func TestOperacaoSemAssinaturaRejeitada(t *testing.T) {
+	vitima, _ := NovaCarteira()
+	bc := novoBlockchainComSaldos(t, map[*Carteira]Quantia{vitima: Reais(500)})
+	debito, _ := json.Marshal(map[string]interface{}{"usuario": vitima.Endereco, "valor": -500.0})
+
+	solto := minerarSobrePonta(bc)
+	solto.Evento, solto.Resultado = "ajustar_saldo", string(debito)
+	solto.Nonce, solto.HashAtual = provaDeTrabalho(solto, solto.Dificuldade)
+	bc.mu.Lock()
+	err := bc.inserirBloco(solto)
+	bc.mu.Unlock()
+	if err == nil {
+		t.Error("Bloco sem transações assinadas deveria ser rejeitado")
+	}
+
+	semAssinatura := Transacao{Tipo: "ajustar_saldo", Dados: string(debito), ChainID: bc.genesis.ChainID}
+	semAssinatura.ID = calculaIDTransacao(semAssinatura)
+	bc.mu.Lock()
+	err = bc.estado.Aplicar(blocoEm(time.Now(), semAssinatura))
+	bc.mu.Unlock()
+	if motivoDe(err) != MotivoNaoAutorizado {
+		t.Errorf("Transação sem assinatura deveria ser recusada pelo estado, obtido %v", err)
+	}
+	if saldo := bc.CalcularSaldo(vitima.Endereco); saldo != Reais(500) {
+		t.Errorf("Saldo da vítima deveria continuar 500, obtido %s", saldo)
+	}
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"math/big"
+	"time"
+)
+
+// Pesos de voto de um evento resolvido por votação.
+const (
+	// PesoConta conta um voto por conta.
+	PesoConta = "conta"
+	// PesoAposta pondera o voto pelo total que a conta apostou no evento;
+	// quem não apostou não vota.
+	PesoAposta = "aposta"
+)
+
+// Apuracao é a contagem dos votos de um evento resolvido por votação. Pesos
+// são número de votos (PesoConta) ou centavos apostados (PesoAposta).
+// Votantes conta as contas representadas, diretamente ou por delegação, e
+// Detalhe mostra como cada uma foi contada.
+type Apuracao struct {
+	Votantes  int                    `json:"votantes"`
+	Pesos     map[string]int64       `json:"pesos"`
+	Vencedora string                 `json:"vencedora,omitempty"`
+	Detalhe   map[string]VotoApurado `json:"detalhe,omitempty"`
+}
+
+// VotoApurado é o peso que uma conta deu a uma opção. Cadeia lista as contas
+// por onde o voto passou até quem votou, que é a última; vazia se a própria
+// conta votou.
+type VotoApurado struct {
+	Opcao  string   `json:"opcao"`
+	Peso   int64    `json:"peso"`
+	Cadeia []string `json:"cadeia,omitempty"`
+}
+
+func validarVotacao(resolvedores *Resolvedores) *ErroValidacao {
+	if resolvedores.Peso != PesoConta && resolvedores.Peso != PesoAposta {
+		return rejeitar(MotivoEventoInvalido, "peso de voto %q desconhecido", resolvedores.Peso)
+	}
+	if resolvedores.JanelaVotacao <= 0 {
+		return rejeitar(MotivoEventoInvalido, "janela de votação deve ser positiva")
+	}
+	if resolvedores.Quorum < 1 {
+		return rejeitar(MotivoEventoInvalido, "quórum deve ser de pelo menos um votante")
+	}
+	if resolvedores.Maioria <= 50 || resolvedores.Maioria > 100 {
+		return rejeitar(MotivoEventoInvalido, "maioria de %d%% deve estar entre 51 e 100", resolvedores.Maioria)
+	}
+	return nil
+}
+
+func resolvidoPorVotacao(evento *Evento) bool {
+	return evento.Resolvedores != nil && evento.Resolvedores.Tipo == ResolucaoVotacao
+}
+
+// fimVotacao é o instante em que a votação fecha: o prazo das apostas mais a
+// janela de votação.
+func fimVotacao(evento *Evento) time.Time {
+	prazo, _ := time.Parse(time.RFC3339, evento.FechaApostas)
+	return prazo.Add(time.Duration(evento.Resolvedores.JanelaVotacao) * time.Second)
+}
+
+// pesoDoVoto devolve quanto vale o voto da conta no evento.
+func pesoDoVoto(evento *Evento, conta string) int64 {
+	if evento.Resolvedores.Peso == PesoConta {
+		return 1
+	}
+	var apostado int64
+	for _, apostas := range evento.Votos {
+		for _, aposta := range apostas {
+			if aposta.Usuario == conta {
+				apostado += int64(aposta.Valor)
+			}
+		}
+	}
+	return apostado
+}
+
+// votar registra o voto da conta, substituindo um voto anterior dela. Só vale
+// entre o travamento das apostas e o fim da janela de votação.
+func (e *EstadoMundo) votar(evento *Evento, conta, opcao string, instante time.Time, alteracoes *alteracoesBloco) *ErroValidacao {
+	if err := exigirSituacao(evento, SituacaoTravado); err != nil {
+		return err
+	}
+	if !instante.Before(fimVotacao(evento)) {
+		return rejeitar(MotivoVotacaoEncerrada, "votação do evento %d encerrada em %s", evento.ID, fimVotacao(evento).Format(time.RFC3339))
+	}
+	// Quem não tem peso próprio vota se representar alguém por delegação
+	if conta == "" || (pesoDoVoto(evento, conta) <= 0 && !e.representa(evento, conta)) {
+		return rejeitar(MotivoNaoAutorizado, "conta %q não tem peso na votação do evento %d", conta, evento.ID)
+	}
+	e.registrarVoto(evento, conta, opcao, alteracoes)
+	return nil
+}
+
+// registrarVoto guarda o voto da conta no evento. Cada conta tem um único
+// voto por evento: um voto novo substitui o anterior.
+func (e *EstadoMundo) registrarVoto(evento *Evento, conta, opcao string, alteracoes *alteracoesBloco) {
+	votacao := make(map[string]string, len(evento.Votacao)+1)
+	for votante, anterior := range evento.Votacao {
+		votacao[votante] = anterior
+	}
+	votacao[conta] = opcao
+	e.registrarEvento(evento, alteracoes)
+	evento.Votacao = votacao
+}
+
+// apurar conta os votos e aponta a vencedora se o quórum e a maioria forem
+// atingidos. Quem não votou pesa na opção do primeiro da sua cadeia de
+// delegação, na categoria do evento, que votou; sem ninguém que votou, não
+// conta.
+func (e *EstadoMundo) apurar(evento *Evento) Apuracao {
+	apuracao := Apuracao{Pesos: make(map[string]int64), Detalhe: make(map[string]VotoApurado)}
+	var total int64
+	for eleitor := range e.eleitores(evento) {
+		peso := pesoDoVoto(evento, eleitor)
+		if peso <= 0 {
+			continue
+		}
+		voto := VotoApurado{Peso: peso}
+		if opcao, votou := evento.Votacao[eleitor]; votou {
+			voto.Opcao = opcao
+		} else {
+			cadeia := e.cadeiaDelegacao(eleitor, evento.Categoria)
+			for i, delegado := range cadeia {
+				if opcao, votou := evento.Votacao[delegado]; votou {
+					voto.Opcao, voto.Cadeia = opcao, cadeia[:i+1]
+					break
+				}
+			}
+			if voto.Opcao == "" {
+				continue
+			}
+		}
+		apuracao.Detalhe[eleitor] = voto
+		apuracao.Pesos[voto.Opcao] += peso
+		total += peso
+		apuracao.Votantes++
+	}
+	if apuracao.Votantes < evento.Resolvedores.Quorum || total == 0 {
+		return apuracao
+	}
+	// peso*100 >= maioria*total, sem divisão; big.Int evita estouro com
+	// votos ponderados por valores altos
+	exigido := new(big.Int).Mul(big.NewInt(total), big.NewInt(int64(evento.Resolvedores.Maioria)))
+	for _, opcao := range evento.Opcoes {
+		if new(big.Int).Mul(big.NewInt(apuracao.Pesos[opcao]), big.NewInt(100)).Cmp(exigido) >= 0 {
+			apuracao.Vencedora = opcao
+		}
+	}
+	return apuracao
+}
+
+// apurarVotacoes liquida os eventos cuja janela de votação terminou até o
+// instante do bloco. Sem quórum ou maioria, o evento é cancelado e as apostas
+// devolvidas.
+func (e *EstadoMundo) apurarVotacoes(instante time.Time, alteracoes *alteracoesBloco) {
+	for id := 1; id <= len(e.Eventos); id++ {
+		evento := e.Eventos[id]
+		if !resolvidoPorVotacao(evento) || evento.Situacao != SituacaoTravado || instante.Before(fimVotacao(evento)) {
+			continue
+		}
+		apuracao := e.apurar(evento)
+		if apuracao.Vencedora == "" || e.liquidar(evento, apuracao.Vencedora, instante, alteracoes) != nil {
+			apuracao.Vencedora = ""
+			if e.cancelar(evento, alteracoes) != nil {
+				continue
+			}
+		}
+		evento.Apuracao = &apuracao
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// Testa a votação ponderada pelo valor apostado: janela depois do travamento, maioria qualificada e liquidação automática
+func TestVotacaoPonderadaLiquidaEvento(t *testing.T) {
+	alice, _ := NovaCarteira()
+	bob, _ := NovaCarteira()
+	curioso, _ := NovaCarteira()
+	estado := estadoComSaldos(t, map[*Carteira]Quantia{alice: Reais(30), bob: Reais(10)})
+	inicio := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	prazo := inicio.Add(time.Hour)
+	fim := prazo.Add(10 * time.Minute)
+	votacao := &Resolvedores{Tipo: ResolucaoVotacao, Peso: PesoAposta, JanelaVotacao: 600, Quorum: 2, Maioria: 60}
+	if err := estado.Aplicar(blocoEm(inicio,
+		transacaoAssinada(t, alice, 0, "criar_evento", Evento{Nome: "Final", Opcoes: []string{"X", "Y"}, FechaApostas: prazo.Format(time.RFC3339), Resolvedores: votacao}),
+		transacaoAssinada(t, alice, 1, "apostar", Aposta{Usuario: alice.Endereco, Valor: Reais(30), EventoID: 1, Opcao: "X"}),
+		transacaoAssinada(t, bob, 0, "apostar", Aposta{Usuario: bob.Endereco, Valor: Reais(10), EventoID: 1, Opcao: "Y"}),
+	)); err != nil {
+		t.Fatal(err)
+	}
+
+	votar := func(carteira *Carteira, nonce uint64, opcao string) Transacao {
+		return transacaoAssinada(t, carteira, nonce, "votar", Voto{Usuario: carteira.Endereco, EventoID: 1, Opcao: opcao})
+	}
+	casos := []struct {
+		nome     string
+		instante time.Time
+		tx       Transacao
+		motivo   MotivoRejeicao
+	}{
+		{"voto antes do travamento", inicio.Add(time.Minute), votar(alice, 2, "X"), MotivoApostasAbertas},
+		{"voto sem aposta", prazo, votar(curioso, 0, "Y"), MotivoNaoAutorizado},
+		{"conclusão manual", prazo, transacaoAssinada(t, alice, 2, "concluir_evento", map[string]interface{}{"evento_id": 1, "opcao_vencedora": "X"}), MotivoNaoAutorizado},
+	}
+	for _, caso := range casos {
+		if err := estado.Aplicar(blocoEm(caso.instante, caso.tx)); motivoDe(err) != caso.motivo {
+			t.Errorf("%s: esperado %q, obtido %v", caso.nome, caso.motivo, err)
+		}
+	}
+
+	// Bob vota primeiro em X e muda para Y: vale o último voto
+	if err := estado.Aplicar(blocoEm(prazo, votar(alice, 2, "X"), votar(bob, 1, "X"), votar(bob, 2, "Y"))); err != nil {
+		t.Fatal(err)
+	}
+	if evento, _ := estado.Evento(1); evento.Situacao != SituacaoTravado || evento.Votacao[bob.Endereco] != "Y" {
+		t.Fatalf("Votos deveriam ser registrados com o evento travado, obtido %+v", evento)
+	}
+
+	// O primeiro bloco depois da janela apura: X tem 30 de 40 (75%)
+	if err := estado.Aplicar(blocoEm(fim)); err != nil {
+		t.Fatal(err)
+	}
+	evento, _ := estado.Evento(1)
+	if evento.Situacao != SituacaoResolvido || evento.Resultado != "X" || evento.Apuracao == nil || evento.Apuracao.Pesos["X"] != int64(Reais(30)) {
+		t.Fatalf("Evento deveria ser liquidado pela votação, obtido %+v", evento)
+	}
+	if evento.Premios[alice.Endereco] != Reais(40) {
+		t.Errorf("Vencedora deveria receber 40, obtido %v", evento.Premios)
+	}
+	if err := estado.Aplicar(blocoEm(fim, votar(bob, 3, "Y"))); motivoDe(err) != MotivoEventoConcluido {
+		t.Errorf("Voto depois da apuração deveria ser recusado, obtido %v", err)
+	}
+
+	estado.Desfazer()
+	if evento, _ := estado.Evento(1); evento.Situacao != SituacaoTravado || evento.Apuracao != nil || estado.Saldos[alice.Endereco] != 0 {
+		t.Errorf("Desfazer a apuração deveria voltar o evento a travado, obtido %+v", evento)
+	}
+}
+
+// Testa que sem quórum a votação cancela o evento e devolve as apostas
+func TestVotacaoSemQuorumCancelaEvento(t *testing.T) {
+	alice, _ := NovaCarteira()
+	estado := estadoComSaldos(t, map[*Carteira]Quantia{alice: Reais(5)})
+	inicio := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	prazo := inicio.Add(time.Hour)
+	votacao := &Resolvedores{Tipo: ResolucaoVotacao, Peso: PesoConta, JanelaVotacao: 60, Quorum: 3, Maioria: 51}
+	if err := estado.Aplicar(blocoEm(inicio,
+		transacaoAssinada(t, alice, 0, "criar_evento", Evento{Nome: "Final", Opcoes: []string{"X", "Y"}, FechaApostas: prazo.Format(time.RFC3339), Resolvedores: votacao}),
+		transacaoAssinada(t, alice, 1, "apostar", Aposta{Usuario: alice.Endereco, Valor: Reais(5), EventoID: 1, Opcao: "X"}),
+	)); err != nil {
+		t.Fatal(err)
+	}
+	if err := estado.Aplicar(blocoEm(prazo, transacaoAssinada(t, alice, 2, "votar", Voto{Usuario: alice.Endereco, EventoID: 1, Opcao: "X"}))); err != nil {
+		t.Fatal(err)
+	}
+	if err := estado.Aplicar(blocoEm(prazo.Add(time.Minute))); err != nil {
+		t.Fatal(err)
+	}
+	evento, _ := estado.Evento(1)
+	if evento.Situacao != SituacaoCancelado || evento.Apuracao.Votantes != 1 || estado.Saldos[alice.Endereco] != Reais(5) {
+		t.Errorf("Evento sem quórum deveria ser cancelado com devolução, obtido %+v", evento)
+	}
+}
+
+// Testa que votações sem prazo de apostas ou com parâmetros inválidos são recusadas
+func TestVotacaoInvalida(t *testing.T) {
+	criador, _ := NovaCarteira()
+	prazo := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	valida := Resolvedores{Tipo: ResolucaoVotacao, Peso: PesoConta, JanelaVotacao: 60, Quorum: 1, Maioria: 51}
+	semPrazo, maioriaSimples, pesoDesconhecido := valida, valida, valida
+	maioriaSimples.Maioria = 50
+	pesoDesconhecido.Peso = "saldo"
+	casos := map[string]Evento{
+		"sem prazo":         {Nome: "Final", Opcoes: []string{"X", "Y"}, Resolvedores: &semPrazo},
+		"maioria simples":   {Nome: "Final", Opcoes: []string{"X", "Y"}, FechaApostas: prazo, Resolvedores: &maioriaSimples},
+		"peso desconhecido": {Nome: "Final", Opcoes: []string{"X", "Y"}, FechaApostas: prazo, Resolvedores: &pesoDesconhecido},
+	}
+	for nome, evento := range casos {
+		estado := NovoEstadoMundo()
+		tx := transacaoAssinada(t, criador, 0, "criar_evento", evento)
+		if err := estado.Aplicar(blocoEm(time.Now(), tx)); motivoDe(err) != MotivoEventoInvalido {
+			t.Errorf("%s: esperado %q, obtido %v", nome, MotivoEventoInvalido, err)
+		}
+	}
+}